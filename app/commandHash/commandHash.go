@@ -0,0 +1,239 @@
+// Package commandHash remembers where the commands found in PATH live, like
+// bash's command hash table, so running a command doesn't stat every PATH
+// directory each time.
+//
+// Two caches are kept:
+//   - the executables of each PATH directory, read again only when the
+//     modification time of the directory changes, so a search costs one stat
+//     per directory up to the one holding the command
+//   - the hash table itself: command name -> path and the number of hits,
+//     listed by `hash`. Like in bash, a hashed command is run from where it
+//     was found without searching PATH again, as long as its directory is
+//     unchanged (one stat); `hash -r` picks up a command installed in an
+//     earlier PATH directory
+//
+// Both are dropped when PATH changes. The shell is single threaded (commands,
+// traps and completion all run on the main goroutine), so there is no locking.
+package commandHash
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Entry is a command of the hash table.
+type Entry struct {
+	Name string
+	Path string
+	Hits int // how many times the command was looked up since hashed
+	// Pinned entries were set with `hash -p` and are not checked anymore.
+	Pinned bool
+}
+
+// directory is the cached content of a PATH directory.
+type directory struct {
+	modTime     time.Time
+	executables map[string]struct{}
+}
+
+type table struct {
+	path        string // the PATH value the caches were built for
+	entries     map[string]*Entry
+	directories map[string]*directory
+}
+
+var hashed = &table{
+	entries:     make(map[string]*Entry),
+	directories: make(map[string]*directory),
+}
+
+// Lookup returns the path of the executable run for name, the first one found
+// in PATH (or the one pinned with `hash -p`), and hashes it. A name
+// containing '/' is not searched. ok is false when nothing is found.
+func Lookup(name string) (path string, ok bool) {
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+	hashed.checkPath()
+
+	entry, known := hashed.entries[name]
+	if known && hashed.current(entry) {
+		entry.Hits++
+		return entry.Path, true
+	}
+
+	path, ok = search(name)
+	if !ok {
+		delete(hashed.entries, name)
+		return "", false
+	}
+
+	if !known || entry.Path != path {
+		entry = &Entry{Name: name, Path: path}
+		hashed.entries[name] = entry
+	}
+	entry.Hits++
+	return path, true
+}
+
+// Find returns the path Lookup would return for name without hashing it or
+// counting a hit, e.g. to tell whether a command being typed exists.
+func Find(name string) (path string, ok bool) {
+	if strings.Contains(name, "/") {
+		return "", false
+	}
+	hashed.checkPath()
+	if entry, known := hashed.entries[name]; known && hashed.current(entry) {
+		return entry.Path, true
+	}
+	return search(name)
+}
+
+// Hashed returns the hash table entry of name, without looking it up.
+func Hashed(name string) (Entry, bool) {
+	hashed.checkPath()
+	entry, ok := hashed.entries[name]
+	if !ok {
+		return Entry{}, false
+	}
+	return *entry, true
+}
+
+// Remember searches name in PATH and hashes it without counting a hit
+// (`hash name`). It returns false when the command is not found.
+func Remember(name string) bool {
+	hashed.checkPath()
+	path, ok := search(name)
+	if ok {
+		hashed.entries[name] = &Entry{Name: name, Path: path}
+	}
+	return ok
+}
+
+// Pin hashes name to path without searching PATH (`hash -p path name`).
+func Pin(name, path string) {
+	hashed.checkPath()
+	hashed.entries[name] = &Entry{Name: name, Path: path, Pinned: true}
+}
+
+// Forget removes name from the hash table (`hash -d`). It returns false when
+// name was not hashed.
+func Forget(name string) bool {
+	hashed.checkPath()
+	_, ok := hashed.entries[name]
+	delete(hashed.entries, name)
+	return ok
+}
+
+// Clear empties the hash table and the directory caches (`hash -r`).
+func Clear() {
+	clear(hashed.entries)
+	clear(hashed.directories)
+}
+
+// Entries returns the hash table sorted by name.
+func Entries() []Entry {
+	hashed.checkPath()
+	entries := make([]Entry, 0, len(hashed.entries))
+	for _, entry := range hashed.entries {
+		entries = append(entries, *entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// Names returns the names of the executables in PATH starting with prefix,
+// for command completion. Names found in several directories are repeated.
+func Names(prefix string) []string {
+	hashed.checkPath()
+	var names []string
+	for _, dir := range pathDirectories() {
+		for name := range hashed.scan(dir).executables {
+			if strings.HasPrefix(name, prefix) {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// checkPath drops the caches when PATH changed since they were built.
+func (t *table) checkPath() {
+	if path := os.Getenv("PATH"); path != t.path {
+		t.path = path
+		Clear()
+	}
+}
+
+// current reports whether entry can be used without searching PATH: it is
+// pinned, or the directory it was found in wasn't modified since it was
+// scanned, so the executable is still there.
+func (t *table) current(entry *Entry) bool {
+	if entry.Pinned {
+		return true
+	}
+	cached, ok := t.directories[filepath.Dir(entry.Path)]
+	if !ok {
+		return false
+	}
+	info, err := os.Stat(filepath.Dir(entry.Path))
+	return err == nil && cached.modTime.Equal(info.ModTime())
+}
+
+// search returns the first executable called name in the PATH directories.
+func search(name string) (string, bool) {
+	for _, dir := range pathDirectories() {
+		if _, ok := hashed.scan(dir).executables[name]; ok {
+			return filepath.Join(dir, name), true
+		}
+	}
+	return "", false
+}
+
+// scan returns the executables of dir, reading the directory again only when
+// it was modified since the last scan.
+func (t *table) scan(dir string) *directory {
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		delete(t.directories, dir)
+		return &directory{}
+	}
+
+	if cached, ok := t.directories[dir]; ok && cached.modTime.Equal(info.ModTime()) {
+		return cached
+	}
+
+	scanned := &directory{modTime: info.ModTime(), executables: make(map[string]struct{})}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		if isExecutable(filepath.Join(dir, entry.Name())) {
+			scanned.executables[entry.Name()] = struct{}{}
+		}
+	}
+	t.directories[dir] = scanned
+	return scanned
+}
+
+// pathDirectories returns the directories of PATH, cleaned so that they match
+// the directory of the paths found in them; an empty entry is the current
+// directory.
+func pathDirectories() []string {
+	dirs := filepath.SplitList(os.Getenv("PATH"))
+	for i, dir := range dirs {
+		dirs[i] = filepath.Clean(dir)
+	}
+	return dirs
+}
+
+// isExecutable reports whether path is a file (following symlinks) with an
+// execute permission bit.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode().Perm()&0o111 != 0
+}
@@ -0,0 +1,169 @@
+package commandHash
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// pathOf creates the directories first and second, puts them in PATH and
+// starts with empty caches.
+func pathOf(t *testing.T) (first, second string) {
+	t.Helper()
+	root := t.TempDir()
+	first, second = filepath.Join(root, "first"), filepath.Join(root, "second")
+	os.Mkdir(first, 0o755)
+	os.Mkdir(second, 0o755)
+	t.Setenv("PATH", first+":"+second)
+	Clear()
+	return first, second
+}
+
+// install creates an executable (or, with mode 0o644, a plain file) and marks
+// its directory as modified. Timestamps can be coarser than the test is fast,
+// so the directory gets a time of its own.
+func install(t *testing.T, dir, name string, mode os.FileMode) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), mode); err != nil {
+		t.Fatal(err)
+	}
+	touch(t, dir)
+}
+
+// touch moves the modification time of dir forward.
+func touch(t *testing.T, dir string) {
+	t.Helper()
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	later := info.ModTime().Add(time.Second)
+	os.Chtimes(dir, later, later)
+}
+
+func TestLookup(t *testing.T) {
+	first, second := pathOf(t)
+	install(t, second, "tool", 0o755)
+	install(t, second, "data", 0o644)
+
+	if path, ok := Lookup("tool"); !ok || path != filepath.Join(second, "tool") {
+		t.Fatalf("Lookup(tool) = %q, %v", path, ok)
+	}
+	Lookup("tool")
+	if entry, ok := Hashed("tool"); !ok || entry.Hits != 2 {
+		t.Errorf("Hashed(tool) = %+v, %v, want 2 hits", entry, ok)
+	}
+
+	for _, name := range []string{"data", "missing", "second/tool", ""} {
+		if path, ok := Lookup(name); ok {
+			t.Errorf("Lookup(%q) = %q, want nothing", name, path)
+		}
+	}
+
+	// Like bash, the hashed command is kept while its directory is unchanged,
+	// even when an earlier PATH directory gets one of the same name
+	install(t, first, "tool", 0o755)
+	if path, _ := Lookup("tool"); path != filepath.Join(second, "tool") {
+		t.Errorf("Lookup(tool) after installing another one = %q, want the hashed one", path)
+	}
+	if path, _ := Find("tool"); path != filepath.Join(second, "tool") {
+		t.Errorf("Find(tool) = %q, want the hashed one", path)
+	}
+
+	// Its directory changed: PATH is searched again
+	touch(t, second)
+	if path, _ := Lookup("tool"); path != filepath.Join(first, "tool") {
+		t.Errorf("Lookup(tool) after its directory changed = %q", path)
+	}
+	if entry, _ := Hashed("tool"); entry.Hits != 1 {
+		t.Errorf("the hits of the new path = %d, want 1", entry.Hits)
+	}
+
+	// A removed command is forgotten
+	os.Remove(filepath.Join(first, "tool"))
+	os.Remove(filepath.Join(second, "tool"))
+	touch(t, first)
+	touch(t, second)
+	if path, ok := Lookup("tool"); ok {
+		t.Errorf("Lookup(tool) after removing it = %q", path)
+	}
+	if _, ok := Hashed("tool"); ok {
+		t.Errorf("tool is still hashed after being removed")
+	}
+}
+
+func TestFindDoesNotHash(t *testing.T) {
+	_, second := pathOf(t)
+	install(t, second, "tool", 0o755)
+
+	if path, ok := Find("tool"); !ok || path != filepath.Join(second, "tool") {
+		t.Errorf("Find(tool) = %q, %v", path, ok)
+	}
+	if _, ok := Hashed("tool"); ok {
+		t.Errorf("Find hashed tool")
+	}
+}
+
+func TestTableManagement(t *testing.T) {
+	first, second := pathOf(t)
+	install(t, first, "b", 0o755)
+	install(t, second, "a", 0o755)
+
+	if !Remember("a") || Remember("missing") {
+		t.Errorf("Remember found the wrong commands")
+	}
+	Pin("b", "/elsewhere/b")
+	if path, _ := Lookup("b"); path != "/elsewhere/b" {
+		t.Errorf("Lookup of a pinned command = %q", path)
+	}
+
+	want := []Entry{
+		{Name: "a", Path: filepath.Join(second, "a")},
+		{Name: "b", Path: "/elsewhere/b", Hits: 1, Pinned: true},
+	}
+	if got := Entries(); !slices.Equal(got, want) {
+		t.Errorf("Entries() = %+v, want %+v", got, want)
+	}
+
+	if !Forget("a") || Forget("a") {
+		t.Errorf("Forget(a) didn't report the entry once")
+	}
+
+	// A new PATH drops everything
+	t.Setenv("PATH", second)
+	if entries := Entries(); len(entries) != 0 {
+		t.Errorf("Entries() after changing PATH = %+v", entries)
+	}
+
+	Remember("a")
+	Clear()
+	if entries := Entries(); len(entries) != 0 {
+		t.Errorf("Entries() after Clear = %+v", entries)
+	}
+}
+
+func TestNames(t *testing.T) {
+	first, second := pathOf(t)
+	install(t, first, "git", 0o755)
+	install(t, first, "gitk", 0o755)
+	install(t, second, "git", 0o755)
+	install(t, second, "gist", 0o644)
+	install(t, second, "go", 0o755)
+	os.Mkdir(filepath.Join(second, "gizmo"), 0o755)
+
+	names := Names("gi")
+	slices.Sort(names)
+	if want := []string{"git", "git", "gitk"}; !slices.Equal(names, want) {
+		t.Errorf("Names(gi) = %q, want %q", names, want)
+	}
+}
+
+func TestPathDirectories(t *testing.T) {
+	t.Setenv("PATH", "/usr/bin/:/bin::./tools/../bin")
+	want := []string{"/usr/bin", "/bin", ".", "bin"}
+	if got := pathDirectories(); !slices.Equal(got, want) {
+		t.Errorf("pathDirectories() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"shelly/app/completion"
+	"shelly/app/executer"
+)
+
+// completer computes the Tab completions of the prompt.
+var completer = &completion.Engine{
+	Programmable: executer.ProgrammableCompletion,
+	Builtins:     executer.CommandNames,
+	Variables:    executer.VariableNames,
+	Lookup:       executer.LookupVariable,
+}
@@ -0,0 +1,126 @@
+// Package completion computes the candidates of Tab completion.
+//
+// It is plain Go, independent of the line editor: the editor only calls
+// Engine.Complete (see package lineEditor) and displays what it returns, so
+// the logic can be exercised without a terminal.
+package completion
+
+import (
+	"shelly/app/parser/lexer"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Result is the outcome of a completion.
+type Result struct {
+	Candidates []string // sorted, without duplicates
+	// Filenames is set when the candidates are paths. Complete already
+	// appends '/' to the directories; the line editor may show only the last
+	// component of the paths when listing them.
+	Filenames bool
+}
+
+// Engine completes command lines. The shell provides what the package can't
+// know by itself through its hooks; a nil hook is skipped.
+type Engine struct {
+	// Programmable returns the candidates of the `complete` spec of the
+	// command being completed. ok is false when no spec applies.
+	Programmable func(ctx Context) (result Result, ok bool)
+	// Builtins returns the names of the commands implemented by the shell.
+	Builtins func() []string
+	// Variables returns the names of the shell variables (the environment
+	// is read directly).
+	Variables func() []string
+	// Lookup resolves the parameters and tilde prefixes of the words being
+	// completed; the environment is used when nil.
+	Lookup lexer.VariableLookup
+}
+
+// Complete returns the candidates for the word between start and end of line,
+// depending on its position: command names where a command starts, file
+// names after a redirection, variable names after '$' and, for arguments,
+// what the `complete` spec of the command says, directories for cd and pushd
+// and file names otherwise.
+//
+// The word is dequoted before looking for candidates and they are quoted
+// back like it. start is where the line editor starts the word; it may be
+// after the actual start, e.g. after an open quote, and the candidates are
+// then cut to replace line[start:end] only.
+func (e *Engine) Complete(line string, start, end int) Result {
+	ctx := NewContext(line, end)
+
+	var result Result
+	if ctx.Position == PositionVariable {
+		result.Candidates = e.completeVariable(ctx.Word)
+	} else {
+		typed := ctx.Word
+		ctx.Word = dequote(typed, e.Lookup)
+		result = e.completeWord(ctx)
+		result.Candidates = requote(typed, ctx.Word, result.Candidates, result.Filenames)
+	}
+	result.Candidates = Sorted(result.Candidates)
+
+	if skip := line[ctx.Start:max(start, ctx.Start)]; skip != "" {
+		kept := result.Candidates[:0]
+		for _, candidate := range result.Candidates {
+			if rest, ok := strings.CutPrefix(candidate, skip); ok {
+				kept = append(kept, rest)
+			}
+		}
+		result.Candidates = kept
+	}
+	return result
+}
+
+// completeWord returns the raw candidates for the dequoted word ctx.Word.
+func (e *Engine) completeWord(ctx Context) Result {
+	switch ctx.Position {
+	case PositionCommand:
+		var builtins []string
+		if e.Builtins != nil {
+			builtins = e.Builtins()
+		}
+		return Result{Candidates: Commands(ctx.Word, builtins)}
+	case PositionRedirect:
+		return Result{Candidates: Files(ctx.Word, false), Filenames: true}
+	}
+
+	if e.Programmable != nil {
+		if result, ok := e.Programmable(ctx); ok {
+			return result
+		}
+	}
+
+	switch ctx.Words[0] {
+	case "cd", "pushd":
+		return Result{Candidates: Files(ctx.Word, true), Filenames: true}
+	}
+	return Result{Candidates: Files(ctx.Word, false), Filenames: true}
+}
+
+// completeVariable completes a parameter reference, word being "$NAME" or
+// "${NAME".
+func (e *Engine) completeVariable(word string) []string {
+	prefix, suffix := "$", ""
+	if strings.HasPrefix(word, "${") {
+		prefix, suffix = "${", "}"
+	}
+
+	var shellVariables []string
+	if e.Variables != nil {
+		shellVariables = e.Variables()
+	}
+
+	var candidates []string
+	for _, name := range Variables(word[len(prefix):], shellVariables) {
+		candidates = append(candidates, prefix+name+suffix)
+	}
+	return candidates
+}
+
+// Sorted sorts candidates and removes the duplicates.
+func Sorted(candidates []string) []string {
+	sort.Strings(candidates)
+	return slices.Compact(candidates)
+}
@@ -0,0 +1,119 @@
+package completion
+
+import (
+	"shelly/app/parser/lexer"
+	"shelly/app/parser/token"
+	"strings"
+)
+
+// Position tells what the word being completed is, from the words before it.
+type Position int
+
+const (
+	PositionCommand  Position = iota // a command name: first word, after |, ;, &&, || or (
+	PositionArgument                 // an argument of Context.Words[0]
+	PositionRedirect                 // the file of a redirection (>, 2>, >>)
+	PositionVariable                 // a parameter reference ($NAME, ${NAME)
+)
+
+// Context is the command line being completed.
+type Context struct {
+	Line     string
+	Point    int      // cursor position in Line
+	Position Position // what the word being completed is
+	// Words are the words of the simple command the cursor is in, without
+	// redirections (COMP_WORDS), and Index the index of the word being
+	// completed (COMP_CWORD).
+	Words []string
+	Index int
+	// Word is the part of the word being completed before the cursor, as
+	// typed (with its quotes), starting at Start in Line.
+	Word  string
+	Start int
+}
+
+// NewContext finds out what the word ending at end of line is, using the
+// shell's lexer on the text before it: the operators and redirections end or
+// interrupt the command the cursor is in.
+func NewContext(line string, end int) Context {
+	start := WordStart(line, end)
+	ctx := Context{
+		Line:  line,
+		Point: end,
+		Word:  line[start:end],
+		Start: start,
+	}
+
+	afterRedirect := false
+	lex := lexer.NewLexer(line[:start])
+	for tok := lex.NextToken(); tok.Type != token.TokenEOF; tok = lex.NextToken() {
+		switch tok.Type {
+		case token.TokenPipe, token.TokenAnd, token.TokenOr, token.TokenSemicolon:
+			ctx.Words = nil
+			afterRedirect = false
+		case token.TokenRedirectOut, token.TokenRedirectErr,
+			token.TokenAppendRedirectOut, token.TokenAppendRedirectErr:
+			afterRedirect = true
+		default:
+			if !afterRedirect && !(tok.Value == "(" && !tok.Quoted) {
+				ctx.Words = append(ctx.Words, tok.Value)
+			}
+			afterRedirect = false
+		}
+	}
+	ctx.Index = len(ctx.Words)
+
+	before := strings.TrimRight(line[:start], " \t")
+	switch {
+	case isVariablePrefix(ctx.Word):
+		ctx.Position = PositionVariable
+	case afterRedirect || (start > 0 && line[start-1] == '>'):
+		// `cmd >file` is lexed as a word, but the editor splits the word at '>'
+		ctx.Position = PositionRedirect
+	case ctx.Index == 0 || strings.HasSuffix(before, "("):
+		ctx.Position = PositionCommand
+		ctx.Words, ctx.Index = nil, 0
+	default:
+		ctx.Position = PositionArgument
+	}
+
+	// The rest of the command, up to the next operator
+	current := ctx.Word
+	rest := line[end:]
+	if rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+		// The cursor is in the middle of a word
+		restWord, after, _ := strings.Cut(rest, " ")
+		current += restWord
+		rest = after
+	}
+	ctx.Words = append(ctx.Words, current)
+
+	lex = lexer.NewLexer(rest)
+	afterRedirect = false
+	for tok := lex.NextToken(); tok.Type == token.TokenWord ||
+		tok.Type == token.TokenRedirectOut || tok.Type == token.TokenRedirectErr ||
+		tok.Type == token.TokenAppendRedirectOut || tok.Type == token.TokenAppendRedirectErr; tok = lex.NextToken() {
+		if tok.Type == token.TokenWord && !afterRedirect {
+			ctx.Words = append(ctx.Words, tok.Value)
+		}
+		afterRedirect = tok.Type != token.TokenWord
+	}
+	return ctx
+}
+
+// isVariablePrefix reports whether word is the beginning of a parameter
+// reference: '$' or "${" followed by name characters only.
+func isVariablePrefix(word string) bool {
+	name, ok := strings.CutPrefix(word, "$")
+	if !ok {
+		return false
+	}
+	name = strings.TrimPrefix(name, "{")
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		if ch != '_' && !(ch >= 'a' && ch <= 'z') && !(ch >= 'A' && ch <= 'Z') && !(ch >= '0' && ch <= '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package completion
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNewContext(t *testing.T) {
+	tests := []struct {
+		line     string // the cursor is at '^' if there is one, else at the end
+		position Position
+		words    []string
+		index    int
+		word     string
+	}{
+		{line: "", position: PositionCommand, words: []string{""}},
+		{line: "gi", position: PositionCommand, words: []string{"gi"}, word: "gi"},
+		{line: "git ", position: PositionArgument, words: []string{"git", ""}, index: 1},
+		{line: "git co", position: PositionArgument, words: []string{"git", "co"}, index: 1, word: "co"},
+		{line: "git commit -m x", position: PositionArgument, words: []string{"git", "commit", "-m", "x"}, index: 3, word: "x"},
+		{line: "ls | gr", position: PositionCommand, words: []string{"gr"}, word: "gr"},
+		{line: "make && ./run", position: PositionCommand, words: []string{"./run"}, word: "./run"},
+		{line: "false || ec", position: PositionCommand, words: []string{"ec"}, word: "ec"},
+		{line: "cd /tmp; l", position: PositionCommand, words: []string{"l"}, word: "l"},
+		{line: "(cd", position: PositionCommand, words: []string{"cd"}, word: "cd"},
+		{line: "ls | grep x", position: PositionArgument, words: []string{"grep", "x"}, index: 1, word: "x"},
+		{line: "echo hi > ou", position: PositionRedirect, words: []string{"echo", "hi", "ou"}, index: 2, word: "ou"},
+		{line: "echo hi 2>> lo", position: PositionRedirect, words: []string{"echo", "hi", "lo"}, index: 2, word: "lo"},
+		{line: "cat > out fi", position: PositionArgument, words: []string{"cat", "fi"}, index: 1, word: "fi"},
+		{line: "echo $HO", position: PositionVariable, words: []string{"echo", "$HO"}, index: 1, word: "$HO"},
+		{line: "echo ${PA", position: PositionVariable, words: []string{"echo", "${PA"}, index: 1, word: "${PA"},
+		{line: "echo '|' x", position: PositionArgument, words: []string{"echo", "|", "x"}, index: 2, word: "x"},
+		{line: "echo 'a b' c", position: PositionArgument, words: []string{"echo", "a b", "c"}, index: 2, word: "c"},
+		{line: "cp a^ b", position: PositionArgument, words: []string{"cp", "a", "b"}, index: 1, word: "a"},
+		{line: "cp a^bc d", position: PositionArgument, words: []string{"cp", "abc", "d"}, index: 1, word: "a"},
+		{line: "git ^status | less", position: PositionArgument, words: []string{"git", "status"}, index: 1},
+	}
+
+	for _, test := range tests {
+		line, end := test.line, len(test.line)
+		if i := strings.IndexByte(line, '^'); i >= 0 {
+			line, end = line[:i]+line[i+1:], i
+		}
+
+		ctx := NewContext(line, end)
+		if ctx.Position != test.position || !slices.Equal(ctx.Words, test.words) || ctx.Index != test.index || ctx.Word != test.word {
+			t.Errorf("NewContext(%q, %d) = position %d, words %q, index %d, word %q; want position %d, words %q, index %d, word %q",
+				line, end, ctx.Position, ctx.Words, ctx.Index, ctx.Word,
+				test.position, test.words, test.index, test.word)
+		}
+	}
+}
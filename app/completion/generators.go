@@ -0,0 +1,71 @@
+package completion
+
+import (
+	"os"
+	"path/filepath"
+	"shelly/app/commandHash"
+	"strings"
+)
+
+// Files returns the paths starting with prefix, only the directories when
+// dirsOnly is set. Names starting with '.' are only proposed when the prefix
+// asks for them.
+func Files(prefix string, dirsOnly bool) []string {
+	dir, base := filepath.Split(prefix)
+	readDir := dir
+	if readDir == "" {
+		readDir = "."
+	}
+
+	entries, err := os.ReadDir(readDir)
+	if err != nil {
+		return nil
+	}
+
+	var candidates []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, base) || (name[0] == '.' && !strings.HasPrefix(base, ".")) {
+			continue
+		}
+		if dirsOnly {
+			// Follow symlinks: a link to a directory is a directory
+			info, err := os.Stat(filepath.Join(readDir, name))
+			if err != nil || !info.IsDir() {
+				continue
+			}
+		}
+		candidates = append(candidates, dir+name)
+	}
+	return candidates
+}
+
+// Commands returns the builtins and the executables in PATH whose name starts
+// with prefix.
+func Commands(prefix string, builtins []string) []string {
+	return append(Words(prefix, builtins), commandHash.Names(prefix)...)
+}
+
+// Variables returns the names of the environment variables and of the given
+// shell variables starting with prefix.
+func Variables(prefix string, shellVariables []string) []string {
+	candidates := Words(prefix, shellVariables)
+	for _, env := range os.Environ() {
+		name, _, _ := strings.Cut(env, "=")
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates
+}
+
+// Words returns the words starting with prefix.
+func Words(prefix string, words []string) []string {
+	var candidates []string
+	for _, word := range words {
+		if strings.HasPrefix(word, prefix) {
+			candidates = append(candidates, word)
+		}
+	}
+	return candidates
+}
@@ -0,0 +1,189 @@
+package completion
+
+import (
+	"os"
+	"shelly/app/parser/lexer"
+	"strings"
+)
+
+// wordBreaks are the characters that end a word outside of quotes: the
+// blanks and the characters of the shell operators. They must match the word
+// break characters given to the line editor.
+const wordBreaks = " \t\n|&;<>("
+
+// Characters escaped with a backslash in completed words outside of quotes,
+// and inside double quotes.
+const (
+	unquotedSpecials = " \t\n\\\"'<>;|&()#$`?*[!{}"
+	doubleSpecials   = "\\\"$`"
+)
+
+// IsQuoted reports whether the character at index of line is quoted by a
+// backslash or by quotes, following the lexer's rules: a backslash quotes the
+// next character except inside single quotes. The line editor uses it to
+// tell a word break from a quoted blank like in `my\ file`.
+func IsQuoted(line string, index int) bool {
+	quote := byte(0)
+	for i := 0; i < len(line) && i <= index; i++ {
+		ch := line[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			}
+		case ch == '\\':
+			if i+1 == index {
+				return true
+			}
+			i++
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		}
+		if i == index {
+			return quote != 0 && ch != quote
+		}
+	}
+	return false
+}
+
+// WordStart returns where the word ending at end of line starts: after the
+// last word break that is not quoted. Line editors replace line[WordStart:end]
+// with the candidates of Engine.Complete.
+func WordStart(line string, end int) int {
+	start := 0
+	quote := byte(0)
+	for i := 0; i < end; i++ {
+		ch := line[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			}
+		case ch == '\\':
+			i++
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case strings.IndexByte(wordBreaks, ch) >= 0:
+			start = i + 1
+		}
+	}
+	return min(start, end)
+}
+
+// openQuote returns the quote left open at the end of word, 0 if none.
+func openQuote(word string) byte {
+	quote := byte(0)
+	for i := 0; i < len(word); i++ {
+		ch := word[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+			}
+		case ch == '\\':
+			i++
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		}
+	}
+	return quote
+}
+
+// dequote returns the text a word typed at the prompt stands for, removing
+// quotes and escapes and expanding the tilde prefix and parameters with
+// lookup, like the shell would. An open quote is closed first.
+func dequote(word string, lookup lexer.VariableLookup) string {
+	if word == "" {
+		return ""
+	}
+	if quote := openQuote(word); quote != 0 {
+		word += string(quote)
+	} else if strings.HasSuffix(word, "\\") && !strings.HasSuffix(word, "\\\\") {
+		word = word[:len(word)-1]
+	}
+
+	tok := lexer.NewExpandingLexer(word).NextToken()
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	return lexer.ExpandWord(tok.Value, lookup)
+}
+
+// requote turns candidates for the dequoted word raw back into what replaces
+// the typed word: the typed text is kept as is and the rest of the candidate
+// is appended, quoted like the end of the typed word (backslashes, inside
+// double or single quotes). Candidates that don't extend raw are dropped.
+//
+// With filenames, directories get a trailing '/' and the other candidates
+// close the open quote.
+func requote(typed, raw string, candidates []string, filenames bool) []string {
+	quote := openQuote(typed)
+	requoted := make([]string, 0, len(candidates))
+
+	for _, candidate := range candidates {
+		rest, ok := strings.CutPrefix(candidate, raw)
+		if !ok {
+			continue
+		}
+
+		var builder strings.Builder
+		builder.WriteString(typed)
+		writeQuoted(&builder, rest, quote)
+
+		if filenames {
+			if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+				if !strings.HasSuffix(candidate, "/") {
+					builder.WriteByte('/')
+				}
+			} else if quote != 0 {
+				builder.WriteByte(quote)
+			}
+		}
+		requoted = append(requoted, builder.String())
+	}
+	return requoted
+}
+
+// Quote returns text escaped with backslashes so that it is read back as one
+// word, e.g. a file name inserted in the command line.
+func Quote(text string) string {
+	var builder strings.Builder
+	writeQuoted(&builder, text, 0)
+	return builder.String()
+}
+
+// writeQuoted appends text quoted for the given quote context (0 outside of
+// quotes). The builder holds the word so far, if any.
+func writeQuoted(builder *strings.Builder, text string, quote byte) {
+	specials := unquotedSpecials
+	switch quote {
+	case '\'':
+		// A single quote can't be escaped inside single quotes: close them,
+		// add an escaped quote and open them again
+		builder.WriteString(strings.ReplaceAll(text, "'", `'\''`))
+		return
+	case '"':
+		specials = doubleSpecials
+	}
+
+	for i := 0; i < len(text); i++ {
+		// '~' starting the word would be read as a tilde prefix
+		tilde := text[i] == '~' && quote == 0 && builder.Len() == 0
+		if strings.IndexByte(specials, text[i]) >= 0 || tilde {
+			builder.WriteByte('\\')
+		}
+		builder.WriteByte(text[i])
+	}
+}
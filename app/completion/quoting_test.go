@@ -0,0 +1,139 @@
+package completion
+
+import (
+	"slices"
+	"testing"
+)
+
+// noVariables is a lookup for which no parameter is set.
+func noVariables(string) (string, bool) { return "", false }
+
+func TestWordStart(t *testing.T) {
+	tests := []struct {
+		line string
+		want int
+	}{
+		{"", 0},
+		{"ls", 0},
+		{"ls fi", 3},
+		{"ls my\\ fi", 3},
+		{"ls 'my fi", 3},
+		{"ls \"a b\" \"my fi", 9},
+		{"ls |gr", 4},
+		{"echo x>fi", 7},
+		{"echo 'a;b", 5},
+		{"echo \"it's", 5},
+	}
+	for _, test := range tests {
+		if got := WordStart(test.line, len(test.line)); got != test.want {
+			t.Errorf("WordStart(%q) = %d, want %d", test.line, got, test.want)
+		}
+	}
+}
+
+func TestIsQuoted(t *testing.T) {
+	tests := []struct {
+		line  string
+		index int
+		want  bool
+	}{
+		{"a b", 1, false},
+		{"a\\ b", 2, true},
+		{"'a b'", 2, true},
+		{"\"a b\"", 2, true},
+		{"'a' b", 3, false},
+		{"'a\\' b", 4, false},
+		{"\"a\\\" b\"", 4, true},
+		{"\\\\ b", 2, false},
+	}
+	for _, test := range tests {
+		if got := IsQuoted(test.line, test.index); got != test.want {
+			t.Errorf("IsQuoted(%q, %d) = %v, want %v", test.line, test.index, got, test.want)
+		}
+	}
+}
+
+func TestDequote(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "DIR" {
+			return "/data", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		word, want string
+	}{
+		{"", ""},
+		{"file", "file"},
+		{"my\\ fi", "my fi"},
+		{"'my fi", "my fi"},
+		{"\"my fi", "my fi"},
+		{"'it'\\''s", "it's"},
+		{"\"a\\\"b", "a\"b"},
+		{"$DIR/f", "/data/f"},
+		{"'$DIR", "$DIR"},
+		{"trailing\\", "trailing"},
+	}
+	for _, test := range tests {
+		if got := dequote(test.word, lookup); got != test.want {
+			t.Errorf("dequote(%q) = %q, want %q", test.word, got, test.want)
+		}
+	}
+}
+
+func TestRequote(t *testing.T) {
+	tests := []struct {
+		typed, raw string
+		candidates []string
+		want       []string
+	}{
+		{"my\\ ", "my ", []string{"my file", "other"}, []string{"my\\ file"}},
+		{"'my ", "my ", []string{"my file's"}, []string{"'my file'\\''s"}},
+		{"\"my ", "my ", []string{"my $HOME"}, []string{"\"my \\$HOME"}},
+		{"a", "a", []string{"a b", "a;b"}, []string{"a\\ b", "a\\;b"}},
+	}
+	for _, test := range tests {
+		if got := requote(test.typed, test.raw, test.candidates, false); !slices.Equal(got, test.want) {
+			t.Errorf("requote(%q, %q, %q) = %q, want %q", test.typed, test.raw, test.candidates, got, test.want)
+		}
+	}
+}
+
+// TestQuoteRoundTrip checks that what Quote inserts in the command line is
+// read back by the shell as the text quoted.
+func TestQuoteRoundTrip(t *testing.T) {
+	texts := []string{
+		"plain",
+		"my file",
+		"tab\there",
+		"new\nline",
+		"it's",
+		`say "hi"`,
+		`back\slash`,
+		"$HOME",
+		"${HOME}",
+		"`cmd`",
+		"a;b&c|d",
+		"<in>out",
+		"(x)",
+		"#comment",
+		"*.go",
+		"what?",
+		"[abc]",
+		"!bang",
+		"{a,b}",
+		"~user",
+		"a~b",
+		"=equal",
+	}
+	for _, text := range texts {
+		quoted := Quote(text)
+		if got := dequote(quoted, noVariables); got != text {
+			t.Errorf("dequote(Quote(%q)) = %q (quoted as %q)", text, got, quoted)
+		}
+		if start := WordStart(quoted, len(quoted)); start != 0 {
+			t.Errorf("Quote(%q) = %q is split at %d", text, quoted, start)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package executer
+
+import (
+	"os"
+	"path/filepath"
+	"shelly/app/completion"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	completeUsage = "complete: usage: complete [-pr] [-dfcv] [-W wordlist] [-F function] [name ...]\n"
+	compgenUsage  = "compgen: usage: compgen [-dfcv] [-W wordlist] [-F function] [word]\n"
+)
+
+// completionSpec is how the arguments of a command are completed, as set by
+// `complete`. The candidates of every action are merged.
+type completionSpec struct {
+	actions  []byte // 'd' directories, 'f' files, 'c' commands, 'v' variables
+	wordList string // -W: words split on blanks
+	function string // -F: command printing the candidates
+}
+
+// completionSpecs maps command names to their completion.
+var completionSpecs = make(map[string]completionSpec)
+
+// handleComplete implements the complete builtin:
+//
+//	complete [-dfcv] [-W words] [-F func] name...   set how to complete the
+//	                                                 arguments of the commands
+//	complete -p [name...]                            print the specs (the default)
+//	complete -r [name...]                            remove the specs (all of them
+//	                                                 without names)
+//
+// -d, -f, -c and -v complete directories, files, commands and variable names.
+// -F runs func with the command name, the word being completed and the word
+// before it as arguments, and COMP_WORDS, COMP_CWORD, COMP_LINE and
+// COMP_POINT set (see runCompletionFunction). Shelly has no shell functions,
+// so func is any command line: its candidates are the lines it prints. Reading COMPREPLY instead will need
+// array assignments, which the shell doesn't have yet.
+func handleComplete(args []string, outFd, errFd uintptr) int {
+	var print, remove bool
+	spec, args, ok := parseCompletionFlags("complete", args, func(flag byte) bool {
+		switch flag {
+		case 'p':
+			print = true
+		case 'r':
+			remove = true
+		default:
+			return false
+		}
+		return true
+	}, errFd)
+	if !ok {
+		writeStringToFd(errFd, completeUsage)
+		return 2
+	}
+
+	defining := len(spec.actions) > 0 || spec.wordList != "" || spec.function != ""
+	if remove {
+		if len(args) == 0 {
+			clear(completionSpecs)
+			return 0
+		}
+		status := 0
+		for _, name := range args {
+			if _, ok := completionSpecs[name]; !ok {
+				writeStringToFd(errFd, "complete: "+name+": no completion specification\n")
+				status = 1
+			}
+			delete(completionSpecs, name)
+		}
+		return status
+	}
+
+	if print || !defining {
+		return printCompletionSpecs(args, outFd, errFd)
+	}
+
+	if len(args) == 0 {
+		writeStringToFd(errFd, completeUsage)
+		return 2
+	}
+	for _, name := range args {
+		completionSpecs[name] = spec
+	}
+	return 0
+}
+
+// handleCompgen implements `compgen [-dfcv] [-W words] [-F func] [word]`,
+// which prints the candidates the options generate for word, one per line. It
+// fails when there is none.
+func handleCompgen(args []string, outFd, errFd uintptr) int {
+	spec, args, ok := parseCompletionFlags("compgen", args, nil, errFd)
+	if !ok || len(args) > 1 {
+		writeStringToFd(errFd, compgenUsage)
+		return 2
+	}
+
+	word := ""
+	if len(args) == 1 {
+		word = args[0]
+	}
+
+	candidates := spec.generate(completion.Context{Words: []string{word}, Word: word})
+	if len(candidates) == 0 {
+		return 1
+	}
+	writeStringToFd(outFd, strings.Join(candidates, "\n")+"\n")
+	return 0
+}
+
+// parseCompletionFlags reads the options shared by complete and compgen.
+// extra handles the options only one of them knows, it returns false for an
+// invalid option.
+func parseCompletionFlags(name string, args []string, extra func(byte) bool, errFd uintptr) (completionSpec, []string, bool) {
+	var spec completionSpec
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			switch flag := arg[i]; flag {
+			case 'd', 'f', 'c', 'v':
+				if !slices.Contains(spec.actions, flag) {
+					spec.actions = append(spec.actions, flag)
+				}
+			case 'W', 'F':
+				var value string
+				if i+1 < len(arg) {
+					value = arg[i+1:]
+				} else if len(args) > 0 {
+					value = args[0]
+					args = args[1:]
+				} else {
+					writeStringToFd(errFd, name+": -"+string(flag)+": option requires an argument\n")
+					return spec, nil, false
+				}
+				if flag == 'W' {
+					spec.wordList = value
+				} else {
+					spec.function = value
+				}
+				i = len(arg)
+			default:
+				if extra == nil || !extra(flag) {
+					writeStringToFd(errFd, name+": -"+string(flag)+": invalid option\n")
+					return spec, nil, false
+				}
+			}
+		}
+	}
+
+	return spec, args, true
+}
+
+// printCompletionSpecs prints the given specs (all of them when names is
+// empty) as the complete commands that define them.
+func printCompletionSpecs(names []string, outFd, errFd uintptr) int {
+	status := 0
+	if len(names) == 0 {
+		for name := range completionSpecs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var builder strings.Builder
+	for _, name := range names {
+		spec, ok := completionSpecs[name]
+		if !ok {
+			writeStringToFd(errFd, "complete: "+name+": no completion specification\n")
+			status = 1
+			continue
+		}
+
+		builder.WriteString("complete")
+		for _, action := range spec.actions {
+			builder.WriteString(" -")
+			builder.WriteByte(action)
+		}
+		if spec.wordList != "" {
+			builder.WriteString(" -W " + singleQuote(spec.wordList))
+		}
+		if spec.function != "" {
+			builder.WriteString(" -F " + quoteWord(spec.function))
+		}
+		builder.WriteString(" " + quoteWord(name) + "\n")
+	}
+	writeStringToFd(outFd, builder.String())
+	return status
+}
+
+// ProgrammableCompletion returns the candidates of the `complete` spec of the
+// command being completed. ok is false when there is none and the default
+// completion should be used.
+func ProgrammableCompletion(ctx completion.Context) (result completion.Result, ok bool) {
+	spec, ok := completionSpecs[ctx.Words[0]]
+	if !ok {
+		spec, ok = completionSpecs[filepath.Base(ctx.Words[0])]
+	}
+	if !ok {
+		return completion.Result{}, false
+	}
+
+	return completion.Result{
+		Candidates: spec.generate(ctx),
+		Filenames:  slices.Contains(spec.actions, 'f') || slices.Contains(spec.actions, 'd'),
+	}, true
+}
+
+// CommandNames returns the builtins and keywords of the shell.
+func CommandNames() []string {
+	names := make([]string, 0, len(shellBuiltins)+len(shellKeywords))
+	for name := range shellBuiltins {
+		names = append(names, name)
+	}
+	for name := range shellKeywords {
+		names = append(names, name)
+	}
+	return names
+}
+
+// VariableNames returns the names of the shell variables and arrays.
+func VariableNames() []string {
+	names := make([]string, 0, len(state.variables)+len(state.arrays))
+	for name := range state.variables {
+		names = append(names, name)
+	}
+	for name := range state.arrays {
+		names = append(names, name)
+	}
+	return names
+}
+
+// generate returns the sorted, de-duplicated candidates of the spec for the
+// word being completed.
+func (spec completionSpec) generate(ctx completion.Context) []string {
+	var candidates []string
+
+	for _, action := range spec.actions {
+		switch action {
+		case 'd':
+			candidates = append(candidates, completion.Files(ctx.Word, true)...)
+		case 'f':
+			candidates = append(candidates, completion.Files(ctx.Word, false)...)
+		case 'c':
+			candidates = append(candidates, completion.Commands(ctx.Word, CommandNames())...)
+		case 'v':
+			candidates = append(candidates, completion.Variables(ctx.Word, VariableNames())...)
+		}
+	}
+
+	candidates = append(candidates, completion.Words(ctx.Word, strings.Fields(spec.wordList))...)
+
+	if spec.function != "" {
+		candidates = append(candidates, runCompletionFunction(spec.function, ctx)...)
+	}
+
+	return completion.Sorted(candidates)
+}
+
+// runCompletionFunction runs the -F command of a spec and collects the lines
+// it writes as candidates. $? and PIPESTATUS are preserved, and like in bash
+// the command runs without `set -e` and `set -x` and doesn't trigger the ERR
+// and DEBUG traps: completing must neither exit the shell nor print anything.
+//
+// COMP_WORDS is an array in the shell (${COMP_WORDS[1]}). The environment
+// has no arrays, so the command's processes get the words newline separated.
+func runCompletionFunction(function string, ctx completion.Context) []string {
+	output, err := os.CreateTemp("", "shelly-complete-*")
+	if err != nil {
+		return nil
+	}
+	defer os.Remove(output.Name())
+	defer output.Close()
+
+	previous := ""
+	if ctx.Index > 0 {
+		previous = ctx.Words[ctx.Index-1]
+	}
+
+	variables := map[string]string{
+		"COMP_LINE":  ctx.Line,
+		"COMP_POINT": strconv.Itoa(ctx.Point),
+		"COMP_CWORD": strconv.Itoa(ctx.Index),
+	}
+	// Exported too, so that external programs can use them
+	for name, value := range variables {
+		state.variables[name] = value
+		os.Setenv(name, value)
+	}
+	setArray("COMP_WORDS", ctx.Words)
+	os.Setenv("COMP_WORDS", strings.Join(ctx.Words, "\n"))
+
+	savedStatus, savedPipeStatus := state.lastStatus, state.pipeStatus
+	savedErrexit, savedXtrace := state.options.errexit, state.options.xtrace
+	state.options.errexit, state.options.xtrace = false, false
+	// As while a trap action runs, ERR and DEBUG traps don't fire
+	traps.mu.Lock()
+	savedRunning := traps.running
+	traps.running = true
+	traps.mu.Unlock()
+
+	// The shell's stdout is the file while the command runs, so everything
+	// it prints is collected, whatever its shape (`a; b`, pipelines)
+	if savedStdout, err := syscall.Dup(syscall.Stdout); err == nil {
+		syscall.CloseOnExec(savedStdout)
+		if syscall.Dup3(int(output.Fd()), syscall.Stdout, 0) == nil {
+			RunString(function + " " + singleQuote(ctx.Words[0]) + " " + singleQuote(ctx.Word) + " " +
+				singleQuote(previous))
+			syscall.Dup3(savedStdout, syscall.Stdout, 0)
+		}
+		syscall.Close(savedStdout)
+	}
+
+	traps.mu.Lock()
+	traps.running = savedRunning
+	traps.mu.Unlock()
+	state.options.errexit, state.options.xtrace = savedErrexit, savedXtrace
+	state.lastStatus = savedStatus
+	setPipeStatus(savedPipeStatus)
+
+	for name := range variables {
+		delete(state.variables, name)
+		os.Unsetenv(name)
+	}
+	unsetArray("COMP_WORDS")
+	os.Unsetenv("COMP_WORDS")
+
+	content, err := os.ReadFile(output.Name())
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			candidates = append(candidates, line)
+		}
+	}
+	return candidates
+}
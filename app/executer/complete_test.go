@@ -0,0 +1,38 @@
+package executer
+
+import (
+	"os"
+	"shelly/app/completion"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+func TestRunCompletionFunction(t *testing.T) {
+	var before syscall.Stat_t
+	syscall.Fstat(syscall.Stdout, &before)
+
+	// Every command of the line is collected, and the programs it runs see
+	// the words in their environment
+	function := `echo first; echo "${COMP_WORDS[2]}" | tr b B; sh -c 'printf "%s\n" "$COMP_WORDS" "$COMP_CWORD" "$0:$1:$2"'`
+	ctx := completion.NewContext("foo a b", len("foo a b"))
+	got := runCompletionFunction(function, ctx)
+	want := []string{"first", "B", "foo", "a", "b", "2", "foo:b:a"}
+	if !slices.Equal(got, want) {
+		t.Errorf("runCompletionFunction = %q, want %q", got, want)
+	}
+
+	var after syscall.Stat_t
+	syscall.Fstat(syscall.Stdout, &after)
+	if before.Dev != after.Dev || before.Ino != after.Ino {
+		t.Errorf("the shell's stdout wasn't restored")
+	}
+	for _, name := range []string{"COMP_WORDS", "COMP_CWORD", "COMP_LINE", "COMP_POINT"} {
+		if _, ok := os.LookupEnv(name); ok {
+			t.Errorf("%s is still exported", name)
+		}
+	}
+	if _, ok := state.arrays["COMP_WORDS"]; ok {
+		t.Errorf("the COMP_WORDS array is still set")
+	}
+}
@@ -0,0 +1,447 @@
+package executer
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"shelly/app/parser/ast"
+	"shelly/app/pattern"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// Exit statuses of test, [ and [[: true, false, and usage/syntax error.
+const (
+	conditionTrue  = 0
+	conditionFalse = 1
+	conditionError = 2
+)
+
+// condition is a parsed expression; evaluating it may fail at runtime
+// (e.g. a non-numeric operand to -eq).
+type condition func() (bool, error)
+
+// conditionParser turns the words of a test expression into a condition.
+//
+// The same recursive descent serves `test`/`[` and `[[ ]]`; the extended
+// flag switches to the `[[` dialect where && and || replace -a and -o, and
+// == / =~ do pattern and regex matching.
+//
+// Grammar (lowest precedence first):
+//
+//	or      := and ( ('-o' | '||') and )*
+//	and     := not ( ('-a' | '&&') not )*
+//	not     := '!' not | primary
+//	primary := '(' or ')' | word binop word | unop word | word
+type conditionParser struct {
+	words []string
+	// per word, the right-hand side of == and =~; only known for [[ ]]
+	patterns, regexes []string
+	pos               int
+	extended          bool
+}
+
+// handleTest implements the `test` builtin.
+func handleTest(args []string, errFd uintptr) int {
+	return evaluateTestBuiltin("test", args, errFd)
+}
+
+// handleBracketTest implements `[`, which is `test` with a mandatory closing `]`.
+func handleBracketTest(args []string, errFd uintptr) int {
+	if len(args) == 0 || args[len(args)-1] != "]" {
+		writeStringToFd(errFd, "[: missing `]'\n")
+		return conditionError
+	}
+
+	return evaluateTestBuiltin("[", args[:len(args)-1], errFd)
+}
+
+// handleConditionalCommand evaluates a `[[ ... ]]` compound command.
+func handleConditionalCommand(cmd ast.SimpleCommand, errFd uintptr) int {
+	conditional := cmd.Conditional
+	if conditional == nil {
+		// Re-run from plain arguments (e.g. inside a pipeline subshell), quoting
+		// information is not available any more.
+		if len(cmd.Args) < 2 || cmd.Args[len(cmd.Args)-1] != "]]" {
+			writeStringToFd(errFd, "[[: missing `]]'\n")
+			return conditionError
+		}
+		conditional = &ast.ConditionalCommand{Words: cmd.Args[1 : len(cmd.Args)-1]}
+	}
+
+	parser := &conditionParser{
+		words:    conditional.Words,
+		patterns: conditional.Patterns,
+		regexes:  conditional.Regexes,
+		extended: true,
+	}
+
+	return parser.run("[[", errFd)
+}
+
+func evaluateTestBuiltin(name string, args []string, errFd uintptr) int {
+	// `test` with no arguments is false
+	if len(args) == 0 {
+		return conditionFalse
+	}
+
+	parser := &conditionParser{words: args}
+	return parser.run(name, errFd)
+}
+
+// run parses and evaluates the whole expression, reporting errors on errFd.
+func (p *conditionParser) run(name string, errFd uintptr) int {
+	cond, err := p.parseOr()
+	if err == nil && p.pos < len(p.words) {
+		err = fmt.Errorf("%s: unexpected argument", p.words[p.pos])
+	}
+
+	var result bool
+	if err == nil {
+		result, err = cond()
+	}
+
+	if err != nil {
+		writeStringToFd(errFd, name+": "+err.Error()+"\n")
+		return conditionError
+	}
+
+	if result {
+		return conditionTrue
+	}
+	return conditionFalse
+}
+
+func (p *conditionParser) parseOr() (condition, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekIs(p.orOperator()) {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		lhs := left
+		left = func() (bool, error) {
+			ok, err := lhs()
+			if err != nil || ok {
+				return ok, err
+			}
+			return right()
+		}
+	}
+
+	return left, nil
+}
+
+func (p *conditionParser) parseAnd() (condition, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peekIs(p.andOperator()) {
+		p.pos++
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		lhs := left
+		left = func() (bool, error) {
+			ok, err := lhs()
+			if err != nil || !ok {
+				return ok, err
+			}
+			return right()
+		}
+	}
+
+	return left, nil
+}
+
+func (p *conditionParser) parseNot() (condition, error) {
+	// A lone "!" is just a non-empty string
+	if p.peekIs("!") && p.pos+1 < len(p.words) && !p.isBinaryOperatorAt(p.pos+1) {
+		p.pos++
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func() (bool, error) {
+			ok, err := inner()
+			return !ok, err
+		}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *conditionParser) parsePrimary() (condition, error) {
+	if p.pos >= len(p.words) {
+		return nil, fmt.Errorf("argument expected")
+	}
+
+	word := p.words[p.pos]
+
+	// word binop word takes priority so that `[ "(" = "(" ]` and
+	// `[ -f = -f ]` compare strings.
+	if p.pos+2 < len(p.words) && p.isBinaryOperatorAt(p.pos+1) {
+		left, op, right := word, p.words[p.pos+1], p.pos+2
+		p.pos += 3
+		return p.binaryCondition(left, op, right), nil
+	}
+
+	if word == "(" && p.pos+1 < len(p.words) {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekIs(")") {
+			return nil, fmt.Errorf("missing `)'")
+		}
+		p.pos++
+		return inner, nil
+	}
+
+	if isUnaryTestOperator(word) && p.pos+1 < len(p.words) {
+		operand := p.words[p.pos+1]
+		p.pos += 2
+		return unaryCondition(word, operand), nil
+	}
+
+	if p.extended && strings.HasPrefix(word, "-") && len(word) == 2 && p.pos+1 >= len(p.words) {
+		return nil, fmt.Errorf("unexpected argument `%s' to conditional unary operator", word)
+	}
+
+	// A single word is true when it is not empty
+	p.pos++
+	return func() (bool, error) { return word != "", nil }, nil
+}
+
+// binaryCondition builds the condition for `left op right`, right being the
+// index of the right-hand side word.
+func (p *conditionParser) binaryCondition(left, op string, rightIndex int) condition {
+	right := p.words[rightIndex]
+	switch op {
+	case "=", "==":
+		if p.extended {
+			glob := p.patternAt(rightIndex)
+			return func() (bool, error) { return pattern.Match(glob, left), nil }
+		}
+		return func() (bool, error) { return left == right, nil }
+	case "!=":
+		if p.extended {
+			glob := p.patternAt(rightIndex)
+			return func() (bool, error) { return !pattern.Match(glob, left), nil }
+		}
+		return func() (bool, error) { return left != right, nil }
+	case "<":
+		return func() (bool, error) { return left < right, nil }
+	case ">":
+		return func() (bool, error) { return left > right, nil }
+	case "=~":
+		expr := p.regexAt(rightIndex)
+		return func() (bool, error) { return matchRegex(left, expr) }
+	case "-eq", "-ne", "-lt", "-le", "-gt", "-ge":
+		return func() (bool, error) { return compareIntegers(left, op, right) }
+	case "-nt", "-ot", "-ef":
+		return func() (bool, error) { return compareFiles(left, op, right), nil }
+	}
+
+	return func() (bool, error) { return false, fmt.Errorf("%s: binary operator expected", op) }
+}
+
+// unaryCondition builds the condition for a file or string test.
+func unaryCondition(op, operand string) condition {
+	return func() (bool, error) {
+		switch op {
+		case "-z":
+			return operand == "", nil
+		case "-n":
+			return operand != "", nil
+		case "-v":
+			_, ok := LookupVariable(operand)
+			return ok, nil
+		case "-r":
+			return syscall.Access(operand, accessRead) == nil, nil
+		case "-w":
+			return syscall.Access(operand, accessWrite) == nil, nil
+		case "-x":
+			return syscall.Access(operand, accessExecute) == nil, nil
+		case "-L", "-h":
+			info, err := os.Lstat(operand)
+			return err == nil && info.Mode()&os.ModeSymlink != 0, nil
+		}
+
+		info, err := os.Stat(operand)
+		if err != nil {
+			return false, nil
+		}
+
+		mode := info.Mode()
+		switch op {
+		case "-e", "-a":
+			return true, nil
+		case "-f":
+			return mode.IsRegular(), nil
+		case "-d":
+			return mode.IsDir(), nil
+		case "-s":
+			return info.Size() > 0, nil
+		case "-p":
+			return mode&os.ModeNamedPipe != 0, nil
+		case "-S":
+			return mode&os.ModeSocket != 0, nil
+		case "-b":
+			return mode&os.ModeDevice != 0 && mode&os.ModeCharDevice == 0, nil
+		case "-c":
+			return mode&os.ModeCharDevice != 0, nil
+		}
+
+		return false, fmt.Errorf("%s: unary operator expected", op)
+	}
+}
+
+// access(2) modes
+const (
+	accessExecute = 0x1
+	accessWrite   = 0x2
+	accessRead    = 0x4
+)
+
+func compareIntegers(left, op, right string) (bool, error) {
+	a, err := strconv.ParseInt(strings.TrimSpace(left), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", left)
+	}
+	b, err := strconv.ParseInt(strings.TrimSpace(right), 10, 64)
+	if err != nil {
+		return false, fmt.Errorf("%s: integer expression expected", right)
+	}
+
+	switch op {
+	case "-eq":
+		return a == b, nil
+	case "-ne":
+		return a != b, nil
+	case "-lt":
+		return a < b, nil
+	case "-le":
+		return a <= b, nil
+	case "-gt":
+		return a > b, nil
+	default: // -ge
+		return a >= b, nil
+	}
+}
+
+// compareFiles implements -nt, -ot and -ef. Like bash, a file that exists is
+// newer than one that doesn't.
+func compareFiles(left, op, right string) bool {
+	leftInfo, leftErr := os.Stat(left)
+	rightInfo, rightErr := os.Stat(right)
+
+	switch op {
+	case "-nt":
+		if leftErr != nil {
+			return false
+		}
+		return rightErr != nil || leftInfo.ModTime().After(rightInfo.ModTime())
+	case "-ot":
+		if rightErr != nil {
+			return false
+		}
+		return leftErr != nil || leftInfo.ModTime().Before(rightInfo.ModTime())
+	default: // -ef
+		return leftErr == nil && rightErr == nil && os.SameFile(leftInfo, rightInfo)
+	}
+}
+
+// matchRegex implements `[[ s =~ re ]]`. On a match the whole match and each
+// capture group are stored in BASH_REMATCH; otherwise BASH_REMATCH is emptied.
+// The quoted parts of the expression are already escaped to match literally.
+// Like bash, the expression is a POSIX extended regular expression: the
+// leftmost-longest match wins and Perl-only syntax such as \d or (?i) is
+// rejected.
+func matchRegex(s, expr string) (bool, error) {
+	re, err := regexp.CompilePOSIX(expr)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid regular expression", expr)
+	}
+
+	groups := re.FindStringSubmatch(s)
+	if groups == nil {
+		setArray("BASH_REMATCH", nil)
+		return false, nil
+	}
+
+	setArray("BASH_REMATCH", groups)
+	return true, nil
+}
+
+func isUnaryTestOperator(op string) bool {
+	switch op {
+	case "-e", "-a", "-f", "-d", "-s", "-x", "-r", "-w", "-L", "-h",
+		"-p", "-S", "-b", "-c", "-z", "-n", "-v":
+		return true
+	}
+	return false
+}
+
+func (p *conditionParser) isBinaryOperatorAt(i int) bool {
+	if i >= len(p.words) {
+		return false
+	}
+
+	switch p.words[i] {
+	case "=", "==", "!=", "<", ">",
+		"-eq", "-ne", "-lt", "-le", "-gt", "-ge",
+		"-nt", "-ot", "-ef":
+		return true
+	case "=~":
+		return p.extended
+	}
+	return false
+}
+
+func (p *conditionParser) orOperator() string {
+	if p.extended {
+		return "||"
+	}
+	return "-o"
+}
+
+func (p *conditionParser) andOperator() string {
+	if p.extended {
+		return "&&"
+	}
+	return "-a"
+}
+
+func (p *conditionParser) peekIs(word string) bool {
+	return p.pos < len(p.words) && p.words[p.pos] == word
+}
+
+// patternAt returns word i as a pattern. Without the expanded patterns (plain
+// arguments), the word is a pattern as is.
+func (p *conditionParser) patternAt(i int) string {
+	if i < len(p.patterns) {
+		return p.patterns[i]
+	}
+	return p.words[i]
+}
+
+// regexAt returns word i as a regular expression, see patternAt.
+func (p *conditionParser) regexAt(i int) string {
+	if i < len(p.regexes) {
+		return p.regexes[i]
+	}
+	return p.words[i]
+}
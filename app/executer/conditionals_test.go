@@ -0,0 +1,195 @@
+package executer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// devNull swallows the error messages of the tests that expect errors.
+func devNull(t *testing.T) uintptr {
+	t.Helper()
+	file, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Close() })
+	return file.Fd()
+}
+
+func TestTestBuiltin(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	empty := filepath.Join(dir, "empty")
+	script := filepath.Join(dir, "script")
+	old := filepath.Join(dir, "old")
+	link := filepath.Join(dir, "link")
+	for path, content := range map[string]string{file: "data", empty: "", script: "#!/bin/sh", old: "old"} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.Chmod(script, 0o755)
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(old, past, past)
+	os.Symlink(file, link)
+
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, conditionFalse},
+		{[]string{""}, conditionFalse},
+		{[]string{"word"}, conditionTrue},
+		{[]string{"-z", ""}, conditionTrue},
+		{[]string{"-n", ""}, conditionFalse},
+		{[]string{"!"}, conditionTrue},
+		{[]string{"!", ""}, conditionTrue},
+		{[]string{"!", "-z", ""}, conditionFalse},
+
+		// Strings and integers
+		{[]string{"a", "=", "a"}, conditionTrue},
+		{[]string{"a", "==", "b"}, conditionFalse},
+		{[]string{"a", "!=", "b"}, conditionTrue},
+		{[]string{"a", "<", "b"}, conditionTrue},
+		{[]string{"a", ">", "b"}, conditionFalse},
+		{[]string{"a*", "=", "abc"}, conditionFalse},
+		{[]string{"10", "-eq", "10"}, conditionTrue},
+		{[]string{" 10 ", "-eq", "10"}, conditionTrue},
+		{[]string{"9", "-lt", "10"}, conditionTrue},
+		{[]string{"-1", "-ge", "0"}, conditionFalse},
+		{[]string{"3", "-ne", "3"}, conditionFalse},
+		{[]string{"a", "-eq", "1"}, conditionError},
+
+		// Files
+		{[]string{"-e", file}, conditionTrue},
+		{[]string{"-e", filepath.Join(dir, "missing")}, conditionFalse},
+		{[]string{"-f", file}, conditionTrue},
+		{[]string{"-f", dir}, conditionFalse},
+		{[]string{"-d", dir}, conditionTrue},
+		{[]string{"-s", file}, conditionTrue},
+		{[]string{"-s", empty}, conditionFalse},
+		{[]string{"-x", script}, conditionTrue},
+		{[]string{"-x", file}, conditionFalse},
+		{[]string{"-L", link}, conditionTrue},
+		{[]string{"-L", file}, conditionFalse},
+		{[]string{file, "-nt", old}, conditionTrue},
+		{[]string{file, "-ot", old}, conditionFalse},
+		{[]string{old, "-nt", filepath.Join(dir, "missing")}, conditionTrue},
+		{[]string{link, "-ef", file}, conditionTrue},
+
+		// Precedence: ! binds tighter than -a, which binds tighter than -o
+		{[]string{"a", "-o", "", "-a", ""}, conditionTrue},
+		{[]string{"", "-a", "a", "-o", "a"}, conditionTrue},
+		{[]string{"!", "", "-a", ""}, conditionFalse},
+		{[]string{"(", "a", "-o", "", ")", "-a", ""}, conditionFalse},
+		{[]string{"!", "(", "a", "=", "b", ")"}, conditionTrue},
+
+		// Operators as operands
+		{[]string{"-f", "=", "-f"}, conditionTrue},
+		{[]string{"(", "=", "("}, conditionTrue},
+
+		// Syntax errors
+		{[]string{"(", "a"}, conditionError},
+		{[]string{"a", "b"}, conditionError},
+		{[]string{"a", "-foo", "b"}, conditionError},
+	}
+
+	errFd := devNull(t)
+	for _, test := range tests {
+		if got := handleTest(test.args, errFd); got != test.want {
+			t.Errorf("test %q = %d, want %d", test.args, got, test.want)
+		}
+	}
+}
+
+func TestBracketTest(t *testing.T) {
+	errFd := devNull(t)
+	if got := handleBracketTest([]string{"a", "=", "a", "]"}, errFd); got != conditionTrue {
+		t.Errorf("[ a = a ] = %d, want %d", got, conditionTrue)
+	}
+	if got := handleBracketTest([]string{"a", "=", "a"}, errFd); got != conditionError {
+		t.Errorf("[ a = a without ] = %d, want %d", got, conditionError)
+	}
+}
+
+func TestConditionalCommand(t *testing.T) {
+	t.Setenv("PAT", "a*")
+	t.Setenv("DOT", "a.c")
+
+	tests := []struct {
+		line string
+		want int
+	}{
+		{`[[ abc == a* ]]`, conditionTrue},
+		{`[[ abc != a* ]]`, conditionFalse},
+		{`[[ abc == "a*" ]]`, conditionFalse},
+		{`[[ 'a*' == "a*" ]]`, conditionTrue},
+		{`[[ abc == a\* ]]`, conditionFalse},
+		{`[[ foobar == "foo"* ]]`, conditionTrue},
+		{`[[ foo*bar == "foo*"* ]]`, conditionTrue},
+		{`[[ fooxbar == "foo*"* ]]`, conditionFalse},
+		{`[[ abc == $PAT ]]`, conditionTrue},
+		{`[[ abc == "$PAT" ]]`, conditionFalse},
+		{`[[ a* == "$PAT" ]]`, conditionTrue},
+		{`[[ a/b == a*b ]]`, conditionTrue},
+		{`[[ b == [abc] ]]`, conditionTrue},
+
+		{`[[ a && b ]]`, conditionTrue},
+		{`[[ a && "" ]]`, conditionFalse},
+		{`[[ "" || a ]]`, conditionTrue},
+		{`[[ ! "" ]]`, conditionTrue},
+		{`[[ a || "" && "" ]]`, conditionTrue},
+		{`[[ ( a || "" ) && "" ]]`, conditionFalse},
+		{`[[ b > a ]]`, conditionTrue},
+		{`[[ -n ]]`, conditionError},
+
+		{`[[ abc =~ ^a.c$ ]]`, conditionTrue},
+		{`[[ abc =~ "a.c" ]]`, conditionFalse},
+		{`[[ a.c =~ ^"a."c$ ]]`, conditionTrue},
+		{`[[ abc =~ ^"a."c$ ]]`, conditionFalse},
+		{`[[ abc =~ a\.c ]]`, conditionFalse},
+		{`[[ abc =~ $DOT ]]`, conditionTrue},
+		{`[[ abc =~ "$DOT" ]]`, conditionFalse},
+		{`[[ a+b =~ ^"a+"b$ ]]`, conditionTrue},
+		{`[[ a =~ (?i)A ]]`, conditionError},
+	}
+
+	for _, test := range tests {
+		if got := RunString(test.line + " 2> /dev/null"); got != test.want {
+			t.Errorf("%s = %d, want %d", test.line, got, test.want)
+		}
+	}
+}
+
+func TestConditionalRematch(t *testing.T) {
+	// '|' can't be written unquoted inside [[ ]]
+	t.Setenv("RE", "(a|ab)(c|bcd)")
+
+	tests := []struct {
+		line string
+		want []string
+	}{
+		// Leftmost-longest, as in POSIX regular expressions
+		{`[[ xabcd =~ $RE ]]`, []string{"abcd", "a", "bcd"}},
+		{`[[ key=value =~ ^([a-z]+)=(.*)$ ]]`, []string{"key=value", "key", "value"}},
+		{`[[ abc =~ z ]]`, nil},
+	}
+
+	for _, test := range tests {
+		RunString(test.line)
+		if got := state.arrays["BASH_REMATCH"]; !slices.Equal(got, test.want) {
+			t.Errorf("%s: BASH_REMATCH = %q, want %q", test.line, got, test.want)
+		}
+	}
+}
+
+func TestConditionalSyntaxErrors(t *testing.T) {
+	for _, line := range []string{`[[ a == ]]`, `[[ ( a ]]`, `[[ a b ]]`} {
+		if got := RunString(line + " 2> /dev/null"); got != conditionError {
+			t.Errorf("%s = %d, want %d", line, got, conditionError)
+		}
+	}
+}
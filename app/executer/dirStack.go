@@ -0,0 +1,329 @@
+package executer
+
+import (
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+)
+
+// The directory stack follows bash: entry 0 is always the current directory
+// ($PWD) and state.dirStack holds entries 1..n. Because entry 0 is not stored,
+// a plain `cd` simply replaces the top of the stack.
+
+// fullDirStack returns the whole stack, current directory first.
+func fullDirStack() []string {
+	stack := make([]string, 0, len(state.dirStack)+1)
+	stack = append(stack, currentLogicalDirectory())
+	return append(stack, state.dirStack...)
+}
+
+// handlePushd implements `pushd [-n] [dir | +N | -N]`.
+//
+//   - pushd dir   changes to dir and pushes the previous directory
+//   - pushd       swaps the two top entries
+//   - pushd +N/-N rotates the stack so entry N (counted from the left or the
+//     right) becomes the current directory
+//
+// With -n the stack is changed without changing directory.
+// On success the stack is printed like `dirs`.
+func handlePushd(args []string, outFd, errFd uintptr) int {
+	noChdir, args := parseNoChdirFlag(args)
+	if len(args) > 1 {
+		writeStringToFd(errFd, "pushd: too many arguments\n")
+		return 1
+	}
+
+	stack := fullDirStack()
+
+	switch {
+	case len(args) == 0:
+		if len(stack) < 2 {
+			writeStringToFd(errFd, "pushd: no other directory\n")
+			return 1
+		}
+		stack[0], stack[1] = stack[1], stack[0]
+	case isStackIndex(args[0]):
+		idx, ok := resolveStackIndex(args[0], len(stack))
+		if !ok {
+			writeStringToFd(errFd, "pushd: "+args[0]+": directory stack index out of range\n")
+			return 1
+		}
+		stack = append(stack[idx:], stack[:idx]...)
+	default:
+		if noChdir {
+			// The new directory goes right below the current one
+			state.dirStack = append([]string{args[0]}, state.dirStack...)
+			printDirStack(outFd, false, false, false)
+			return 0
+		}
+		stack = append([]string{args[0]}, stack...)
+	}
+
+	if !noChdir {
+		if _, err := changeDirectory(stack[0], false); err != nil {
+			writeStringToFd(errFd, "pushd: "+stack[0]+": "+describeError(err)+"\n")
+			return 1
+		}
+		// Record where we really ended up (e.g. a relative dir is now absolute)
+		stack[0] = currentLogicalDirectory()
+	}
+
+	state.dirStack = stack[1:]
+	printDirStack(outFd, false, false, false)
+	return 0
+}
+
+// handlePopd implements `popd [-n] [+N | -N]`. Without an index it removes
+// the top entry and changes to the new top; +N/-N remove that entry instead.
+func handlePopd(args []string, outFd, errFd uintptr) int {
+	noChdir, args := parseNoChdirFlag(args)
+	if len(args) > 1 {
+		writeStringToFd(errFd, "popd: too many arguments\n")
+		return 1
+	}
+
+	stack := fullDirStack()
+	if len(stack) < 2 {
+		writeStringToFd(errFd, "popd: directory stack empty\n")
+		return 1
+	}
+
+	idx := 0
+	if len(args) == 1 {
+		var ok bool
+		if !isStackIndex(args[0]) {
+			writeStringToFd(errFd, "popd: "+args[0]+": invalid argument\n")
+			return 1
+		}
+		idx, ok = resolveStackIndex(args[0], len(stack))
+		if !ok {
+			writeStringToFd(errFd, "popd: "+args[0]+": directory stack index out of range\n")
+			return 1
+		}
+	}
+
+	// With -n the current directory stays, so the first entry that can be
+	// removed is the one below it.
+	if noChdir && idx == 0 {
+		idx = 1
+	}
+
+	stack = append(stack[:idx], stack[idx+1:]...)
+
+	if idx == 0 {
+		if _, err := changeDirectory(stack[0], false); err != nil {
+			writeStringToFd(errFd, "popd: "+stack[0]+": "+describeError(err)+"\n")
+			return 1
+		}
+	}
+
+	state.dirStack = stack[1:]
+	printDirStack(outFd, false, false, false)
+	return 0
+}
+
+// handleDirs implements `dirs [-clpv] [+N | -N]`.
+//
+//   - -c clears the stack
+//   - -l prints full paths instead of abbreviating $HOME as ~
+//   - -p prints one entry per line
+//   - -v prints one numbered entry per line
+//   - +N/-N prints only that entry
+func handleDirs(args []string, outFd, errFd uintptr) int {
+	var clearStack, long, perLine, verbose bool
+	index := ""
+
+	for _, arg := range args {
+		if isStackIndex(arg) {
+			index = arg
+			continue
+		}
+
+		if len(arg) < 2 || arg[0] != '-' {
+			writeStringToFd(errFd, "dirs: "+arg+": invalid argument\n")
+			writeStringToFd(errFd, "dirs: usage: dirs [-clpv] [+N] [-N]\n")
+			return 1
+		}
+
+		for _, flag := range arg[1:] {
+			switch flag {
+			case 'c':
+				clearStack = true
+			case 'l':
+				long = true
+			case 'p':
+				perLine = true
+			case 'v':
+				verbose = true
+			default:
+				writeStringToFd(errFd, "dirs: -"+string(flag)+": invalid option\n")
+				writeStringToFd(errFd, "dirs: usage: dirs [-clpv] [+N] [-N]\n")
+				return 1
+			}
+		}
+	}
+
+	if clearStack {
+		state.dirStack = nil
+		return 0
+	}
+
+	if index != "" {
+		stack := fullDirStack()
+		idx, ok := resolveStackIndex(index, len(stack))
+		if !ok {
+			writeStringToFd(errFd, "dirs: "+index+": directory stack index out of range\n")
+			return 1
+		}
+		entry := stack[idx]
+		if !long {
+			entry = abbreviateHome(entry)
+		}
+		if verbose {
+			entry = formatStackLine(idx, entry)
+		}
+		writeStringToFd(outFd, entry+"\n")
+		return 0
+	}
+
+	printDirStack(outFd, long, perLine, verbose)
+	return 0
+}
+
+// printDirStack writes the stack like `dirs`: space separated by default, one
+// entry per line when perLine is set, and numbered when numbered is set.
+func printDirStack(outFd uintptr, long, perLine, numbered bool) {
+	var builder strings.Builder
+	for i, entry := range fullDirStack() {
+		if !long {
+			entry = abbreviateHome(entry)
+		}
+
+		switch {
+		case numbered:
+			builder.WriteString(formatStackLine(i, entry))
+			builder.WriteByte('\n')
+		case perLine:
+			builder.WriteString(entry)
+			builder.WriteByte('\n')
+		default:
+			if i > 0 {
+				builder.WriteByte(' ')
+			}
+			builder.WriteString(entry)
+		}
+	}
+
+	if !perLine && !numbered {
+		builder.WriteByte('\n')
+	}
+
+	writeStringToFd(outFd, builder.String())
+}
+
+func formatStackLine(idx int, entry string) string {
+	number := strconv.Itoa(idx)
+	if len(number) < 2 {
+		number = " " + number
+	}
+	return number + "  " + entry
+}
+
+// abbreviateHome replaces a leading $HOME with ~.
+func abbreviateHome(path string) string {
+	home := os.Getenv("HOME")
+	if home == "" || home == "/" {
+		return path
+	}
+	if path == home {
+		return "~"
+	}
+	if strings.HasPrefix(path, home+"/") {
+		return "~" + path[len(home):]
+	}
+	return path
+}
+
+// parseNoChdirFlag strips the -n option shared by pushd and popd.
+func parseNoChdirFlag(args []string) (bool, []string) {
+	noChdir := false
+	for len(args) > 0 && (args[0] == "-n" || args[0] == "--") {
+		if args[0] == "--" {
+			return noChdir, args[1:]
+		}
+		noChdir = true
+		args = args[1:]
+	}
+	return noChdir, args
+}
+
+// isStackIndex reports whether arg looks like +N or -N.
+func isStackIndex(arg string) bool {
+	if len(arg) < 2 || (arg[0] != '+' && arg[0] != '-') {
+		return false
+	}
+	_, err := strconv.Atoi(arg[1:])
+	return err == nil
+}
+
+// resolveStackIndex turns +N (from the left, starting at 0) or -N (from the
+// right) into a position in a stack of the given size.
+func resolveStackIndex(arg string, size int) (int, bool) {
+	n, err := strconv.Atoi(arg[1:])
+	if err != nil || n < 0 || n >= size {
+		return 0, false
+	}
+	if arg[0] == '-' {
+		return size - 1 - n, true
+	}
+	return n, true
+}
+
+// expandTildePrefix resolves a tilde prefix (the part of a word before the
+// first '/'):
+//
+//   - ~        $HOME
+//   - ~user    the home directory of user
+//   - ~+ / ~-  $PWD / $OLDPWD
+//   - ~N, ~+N  entry N of the directory stack, ~-N counts from the bottom
+//
+// A prefix that can't be resolved is returned unchanged, like bash.
+func expandTildePrefix(prefix string) string {
+	rest := prefix[1:]
+
+	switch rest {
+	case "":
+		if home := os.Getenv("HOME"); home != "" {
+			return home
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			return home
+		}
+		return prefix
+	case "+":
+		return currentLogicalDirectory()
+	case "-":
+		if oldPwd := os.Getenv("OLDPWD"); oldPwd != "" {
+			return oldPwd
+		}
+		return prefix
+	}
+
+	index := rest
+	if index[0] != '+' && index[0] != '-' {
+		index = "+" + index
+	}
+	if isStackIndex(index) {
+		stack := fullDirStack()
+		if idx, ok := resolveStackIndex(index, len(stack)); ok {
+			return stack[idx]
+		}
+		return prefix
+	}
+
+	if u, err := user.Lookup(rest); err == nil {
+		return u.HomeDir
+	}
+	return prefix
+}
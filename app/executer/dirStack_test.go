@@ -0,0 +1,190 @@
+package executer
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+)
+
+// withDirStack sets the entries below the current directory for one test.
+func withDirStack(t *testing.T, entries ...string) {
+	t.Helper()
+	saved := state.dirStack
+	state.dirStack = entries
+	t.Cleanup(func() { state.dirStack = saved })
+}
+
+func TestResolveStackIndex(t *testing.T) {
+	tests := []struct {
+		arg  string
+		size int
+		want int
+		ok   bool
+	}{
+		{"+0", 3, 0, true},
+		{"+2", 3, 2, true},
+		{"-0", 3, 2, true},
+		{"-2", 3, 0, true},
+		{"+3", 3, 0, false},
+		{"-3", 3, 0, false},
+		{"+-1", 3, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := resolveStackIndex(test.arg, test.size)
+		if got != test.want || ok != test.ok {
+			t.Errorf("resolveStackIndex(%q, %d) = %d, %v, want %d, %v", test.arg, test.size, got, ok, test.want, test.ok)
+		}
+	}
+
+	for arg, want := range map[string]bool{"+1": true, "-1": true, "+": false, "1": false, "-x": false, "-n": false} {
+		if got := isStackIndex(arg); got != want {
+			t.Errorf("isStackIndex(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
+
+func TestPushdPopd(t *testing.T) {
+	root := directoryTree(t)
+	real := filepath.Join(root, "real")
+	sub := filepath.Join(real, "sub")
+	withDirStack(t)
+	t.Setenv("HOME", real)
+
+	result := callBuiltin(t, handlePushd, "real")
+	if result.status != 0 || result.stdout != "~ "+root+"\n" || os.Getenv("PWD") != real {
+		t.Fatalf("pushd real = %+v, PWD %q", result, os.Getenv("PWD"))
+	}
+	callBuiltin(t, handlePushd, "sub")
+
+	// Without arguments pushd swaps the two top entries
+	if result := callBuiltin(t, handlePushd); result.stdout != "~ ~/sub "+root+"\n" || os.Getenv("PWD") != real {
+		t.Errorf("pushd = %+v, PWD %q", result, os.Getenv("PWD"))
+	}
+
+	// +N rotates entry N to the top, -N counts from the bottom
+	if result := callBuiltin(t, handlePushd, "+2"); result.stdout != root+" ~ ~/sub\n" || os.Getenv("PWD") != root {
+		t.Errorf("pushd +2 = %+v, PWD %q", result, os.Getenv("PWD"))
+	}
+	if result := callBuiltin(t, handlePushd, "-0"); result.stdout != "~/sub "+root+" ~\n" || os.Getenv("PWD") != sub {
+		t.Errorf("pushd -0 = %+v, PWD %q", result, os.Getenv("PWD"))
+	}
+
+	// -n changes the stack only
+	if result := callBuiltin(t, handlePushd, "-n", "/tmp"); result.stdout != "~/sub /tmp "+root+" ~\n" || os.Getenv("PWD") != sub {
+		t.Errorf("pushd -n /tmp = %+v, PWD %q", result, os.Getenv("PWD"))
+	}
+	if result := callBuiltin(t, handlePopd, "-n"); result.stdout != "~/sub "+root+" ~\n" || os.Getenv("PWD") != sub {
+		t.Errorf("popd -n = %+v, PWD %q", result, os.Getenv("PWD"))
+	}
+	if result := callBuiltin(t, handlePopd, "+1"); result.stdout != "~/sub ~\n" {
+		t.Errorf("popd +1 = %+v", result)
+	}
+	if result := callBuiltin(t, handlePopd); result.stdout != "~\n" || os.Getenv("PWD") != real {
+		t.Errorf("popd = %+v, PWD %q", result, os.Getenv("PWD"))
+	}
+
+	errors := []struct {
+		builtin func([]string, uintptr, uintptr) int
+		args    []string
+		stderr  string
+	}{
+		{handlePopd, nil, "popd: directory stack empty\n"},
+		{handlePushd, nil, "pushd: no other directory\n"},
+		{handlePushd, []string{"+1"}, "pushd: +1: directory stack index out of range\n"},
+		{handlePushd, []string{"a", "b"}, "pushd: too many arguments\n"},
+		{handlePushd, []string{"missing"}, "pushd: missing: No such file or directory\n"},
+	}
+	for _, test := range errors {
+		if result := callBuiltin(t, test.builtin, test.args...); result.status != 1 || result.stderr != test.stderr {
+			t.Errorf("%q: got %+v, want stderr %q", test.args, result, test.stderr)
+		}
+	}
+}
+
+func TestDirs(t *testing.T) {
+	root := directoryTree(t)
+	t.Setenv("HOME", root)
+	withDirStack(t, root+"/real", "/tmp")
+
+	tests := []struct {
+		args   []string
+		stdout string
+	}{
+		{nil, "~ ~/real /tmp\n"},
+		{[]string{"-l"}, root + " " + root + "/real /tmp\n"},
+		{[]string{"-p"}, "~\n~/real\n/tmp\n"},
+		{[]string{"-v"}, " 0  ~\n 1  ~/real\n 2  /tmp\n"},
+		{[]string{"+1"}, "~/real\n"},
+		{[]string{"-0"}, "/tmp\n"},
+		{[]string{"-v", "-1"}, " 1  ~/real\n"},
+	}
+	for _, test := range tests {
+		if result := callBuiltin(t, handleDirs, test.args...); result.status != 0 || result.stdout != test.stdout {
+			t.Errorf("dirs %q = %+v, want stdout %q", test.args, result, test.stdout)
+		}
+	}
+
+	if result := callBuiltin(t, handleDirs, "+3"); result.status != 1 {
+		t.Errorf("dirs +3 = %+v, want status 1", result)
+	}
+	if result := callBuiltin(t, handleDirs, "-x"); result.status != 1 {
+		t.Errorf("dirs -x = %+v, want status 1", result)
+	}
+	if callBuiltin(t, handleDirs, "-c"); len(state.dirStack) != 0 {
+		t.Errorf("dirs -c left %q", state.dirStack)
+	}
+}
+
+func TestExpandTildePrefix(t *testing.T) {
+	root := directoryTree(t)
+	t.Setenv("HOME", "/home/me")
+	t.Setenv("OLDPWD", "/old")
+	withDirStack(t, "/one", "/two")
+
+	tests := []struct {
+		prefix, want string
+	}{
+		{"~", "/home/me"},
+		{"~+", root},
+		{"~-", "/old"},
+		{"~0", root},
+		{"~1", "/one"},
+		{"~+2", "/two"},
+		{"~-0", "/two"},
+		{"~-2", root},
+		{"~3", "~3"},
+		{"~no-such-user", "~no-such-user"},
+	}
+	for _, test := range tests {
+		if got := expandTildePrefix(test.prefix); got != test.want {
+			t.Errorf("expandTildePrefix(%q) = %q, want %q", test.prefix, got, test.want)
+		}
+	}
+
+	if u, err := user.Current(); err == nil {
+		if got := expandTildePrefix("~" + u.Username); got != u.HomeDir {
+			t.Errorf("expandTildePrefix(~%s) = %q, want %q", u.Username, got, u.HomeDir)
+		}
+	}
+
+	t.Setenv("OLDPWD", "")
+	if got := expandTildePrefix("~-"); got != "~-" {
+		t.Errorf("expandTildePrefix(~-) without OLDPWD = %q", got)
+	}
+}
+
+func TestAbbreviateHome(t *testing.T) {
+	t.Setenv("HOME", "/home/me")
+	tests := map[string]string{
+		"/home/me":     "~",
+		"/home/me/src": "~/src",
+		"/home/meta":   "/home/meta",
+		"/tmp":         "/tmp",
+	}
+	for path, want := range tests {
+		if got := abbreviateHome(path); got != want {
+			t.Errorf("abbreviateHome(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package executer
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"shelly/app/syscallHelpers"
+	"strings"
+	"syscall"
+)
+
+// The shell keeps two views of the current directory, like bash:
+//   - the logical one in $PWD, which remembers the symlinks used to get there
+//   - the physical one known by the kernel (syscall.Getwd), with symlinks resolved
+//
+// `cd -L` (the default) and `pwd -L` work with the logical path, while -P
+// switches both to the physical one.
+
+// InitWorkingDirectory exports PWD at startup, keeping an inherited value if it
+// still points at the current directory.
+func InitWorkingDirectory() {
+	os.Setenv("PWD", currentLogicalDirectory())
+}
+
+// currentLogicalDirectory returns $PWD when it is an absolute path naming the
+// current directory, falling back to the physical path otherwise.
+func currentLogicalDirectory() string {
+	if pwd := os.Getenv("PWD"); filepath.IsAbs(pwd) {
+		pwdInfo, err := os.Stat(pwd)
+		if err == nil {
+			dotInfo, err := os.Stat(".")
+			if err == nil && os.SameFile(pwdInfo, dotInfo) {
+				return pwd
+			}
+		}
+	}
+
+	physical, err := syscall.Getwd()
+	if err != nil {
+		return os.Getenv("PWD")
+	}
+	return physical
+}
+
+// handleCd implements `cd [-L|-P] [dir]`.
+//
+//   - no dir goes to $HOME
+//   - "-" goes to $OLDPWD and prints it
+//   - a relative dir is searched in $CDPATH first; when found there the new
+//     directory is printed
+//
+// $PWD and $OLDPWD are updated in the environment on success.
+func handleCd(args []string, outFd, errFd uintptr) int {
+	physical, args, ok := parseDirectoryFlags("cd", args, errFd)
+	if !ok {
+		return 2
+	}
+
+	if len(args) > 1 {
+		writeStringToFd(errFd, "cd: too many arguments\n")
+		return 1
+	}
+
+	var target string
+	printTarget := false
+
+	switch {
+	case len(args) == 0:
+		home := os.Getenv("HOME")
+		if home == "" {
+			writeStringToFd(errFd, "cd: HOME not set\n")
+			return 1
+		}
+		target = home
+	case args[0] == "-":
+		oldPwd := os.Getenv("OLDPWD")
+		if oldPwd == "" {
+			writeStringToFd(errFd, "cd: OLDPWD not set\n")
+			return 1
+		}
+		target = oldPwd
+		printTarget = true
+	default:
+		target = args[0]
+		if found, fromCdPath := searchCdPath(target); found != "" {
+			target = found
+			printTarget = fromCdPath
+		}
+	}
+
+	newPwd, err := changeDirectory(target, physical)
+	if err != nil {
+		writeStringToFd(errFd, "cd: "+target+": "+describeError(err)+"\n")
+		return 1
+	}
+
+	if printTarget {
+		writeStringToFd(outFd, newPwd)
+		syscallHelpers.WriteWithSyscall(int(outFd), newLineSlice)
+	}
+
+	return 0
+}
+
+// changeDirectory switches to target and updates $PWD and $OLDPWD.
+// It returns the new $PWD.
+func changeDirectory(target string, physical bool) (string, error) {
+	oldPwd := currentLogicalDirectory()
+
+	var newPwd string
+	if !physical {
+		// Resolve ".." against the logical path, so `cd ..` out of a symlinked
+		// directory returns to where we came from.
+		logical := target
+		if !filepath.IsAbs(logical) {
+			logical = filepath.Join(oldPwd, logical)
+		}
+		logical = filepath.Clean(logical)
+
+		if err := os.Chdir(logical); err == nil {
+			newPwd = logical
+		}
+	}
+
+	// Physical mode, or the logical path doesn't exist (bash falls back too)
+	if newPwd == "" {
+		if err := os.Chdir(target); err != nil {
+			return "", err
+		}
+
+		var err error
+		newPwd, err = syscall.Getwd()
+		if err != nil {
+			return "", err
+		}
+	}
+
+	os.Setenv("OLDPWD", oldPwd)
+	os.Setenv("PWD", newPwd)
+
+	return newPwd, nil
+}
+
+// searchCdPath looks dir up in the colon separated $CDPATH. It returns the
+// directory to change to (empty when not found) and whether it came from a
+// non-empty CDPATH entry, in which case cd prints the new directory.
+// Paths starting with "/", "." or ".." never use CDPATH.
+func searchCdPath(dir string) (string, bool) {
+	cdPath := os.Getenv("CDPATH")
+	if cdPath == "" || dir == "" || filepath.IsAbs(dir) ||
+		dir == "." || dir == ".." || strings.HasPrefix(dir, "./") || strings.HasPrefix(dir, "../") {
+		return "", false
+	}
+
+	for _, entry := range strings.Split(cdPath, ":") {
+		candidate := dir
+		if entry != "" {
+			candidate = filepath.Join(entry, dir)
+		}
+
+		if info, err := os.Stat(candidate); err == nil && info.IsDir() {
+			return candidate, entry != ""
+		}
+	}
+
+	return "", false
+}
+
+// handlePWD implements `pwd [-L|-P]`.
+func handlePWD(args []string, outFd, errFd uintptr) int {
+	physical, args, ok := parseDirectoryFlags("pwd", args, errFd)
+	if !ok {
+		return 2
+	}
+
+	if len(args) > 0 {
+		writeStringToFd(errFd, "pwd: too many arguments\n")
+		return 1
+	}
+
+	var currentWorkingDirectory string
+	if physical {
+		var err error
+		currentWorkingDirectory, err = syscall.Getwd()
+		if err != nil {
+			writeStringToFd(errFd, "pwd: "+describeError(err)+"\n")
+			return 1
+		}
+	} else {
+		currentWorkingDirectory = currentLogicalDirectory()
+	}
+
+	writeStringToFd(outFd, currentWorkingDirectory)
+	syscallHelpers.WriteWithSyscall(int(outFd), newLineSlice)
+	return 0
+}
+
+// parseDirectoryFlags consumes the -L and -P options shared by cd and pwd.
+// The last one given wins. A lone "-" is an operand, "--" ends the options.
+func parseDirectoryFlags(name string, args []string, errFd uintptr) (physical bool, rest []string, ok bool) {
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 'L':
+				physical = false
+			case 'P':
+				physical = true
+			default:
+				writeStringToFd(errFd, name+": -"+string(flag)+": invalid option\n")
+				writeStringToFd(errFd, name+": usage: "+name+" [-L|-P]"+usageOperand(name)+"\n")
+				return false, nil, false
+			}
+		}
+		args = args[1:]
+	}
+
+	return physical, args, true
+}
+
+func usageOperand(name string) string {
+	if name == "cd" {
+		return " [dir]"
+	}
+	return ""
+}
+
+// describeError turns a system call error into the capitalized message bash
+// prints, e.g. "No such file or directory".
+func describeError(err error) string {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		message := errno.Error()
+		return strings.ToUpper(message[:1]) + message[1:]
+	}
+	return err.Error()
+}
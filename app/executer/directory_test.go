@@ -0,0 +1,155 @@
+package executer
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseDirectoryFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		physical bool
+		rest     []string
+		ok       bool
+	}{
+		{nil, false, nil, true},
+		{[]string{"dir"}, false, []string{"dir"}, true},
+		{[]string{"-P", "dir"}, true, []string{"dir"}, true},
+		{[]string{"-P", "-L"}, false, []string{}, true},
+		{[]string{"-LP"}, true, []string{}, true},
+		{[]string{"-"}, false, []string{"-"}, true},
+		{[]string{"--", "-P"}, false, []string{"-P"}, true},
+		{[]string{"-x"}, false, nil, false},
+	}
+
+	errFd := devNull(t)
+	for _, test := range tests {
+		physical, rest, ok := parseDirectoryFlags("cd", test.args, errFd)
+		if physical != test.physical || ok != test.ok || (ok && !slices.Equal(rest, test.rest)) {
+			t.Errorf("parseDirectoryFlags(%q) = %v, %q, %v, want %v, %q, %v",
+				test.args, physical, rest, ok, test.physical, test.rest, test.ok)
+		}
+	}
+}
+
+// directoryTree creates root/real/sub and the symlink root/link -> real, and
+// makes root the current directory.
+func directoryTree(t *testing.T) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(root, "real", "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("real", filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(root)
+	t.Setenv("PWD", root)
+	t.Setenv("OLDPWD", "")
+	t.Setenv("CDPATH", "")
+	return root
+}
+
+func TestCdLogicalAndPhysical(t *testing.T) {
+	root := directoryTree(t)
+	link, real := filepath.Join(root, "link"), filepath.Join(root, "real")
+
+	if result := callBuiltin(t, handleCd, "link"); result.status != 0 {
+		t.Fatalf("cd link = %+v", result)
+	}
+	if got := os.Getenv("PWD"); got != link {
+		t.Errorf("PWD after cd link = %q, want %q", got, link)
+	}
+	if got := callBuiltin(t, handlePWD).stdout; got != link+"\n" {
+		t.Errorf("pwd = %q, want %q", got, link+"\n")
+	}
+	if got := callBuiltin(t, handlePWD, "-P").stdout; got != real+"\n" {
+		t.Errorf("pwd -P = %q, want %q", got, real+"\n")
+	}
+
+	// .. goes back through the symlink
+	callBuiltin(t, handleCd, "..")
+	if got := os.Getenv("PWD"); got != root {
+		t.Errorf("PWD after cd .. = %q, want %q", got, root)
+	}
+	if got := os.Getenv("OLDPWD"); got != link {
+		t.Errorf("OLDPWD after cd .. = %q, want %q", got, link)
+	}
+
+	callBuiltin(t, handleCd, "-P", "link")
+	if got := os.Getenv("PWD"); got != real {
+		t.Errorf("PWD after cd -P link = %q, want %q", got, real)
+	}
+}
+
+func TestCdSpecialOperands(t *testing.T) {
+	root := directoryTree(t)
+	sub := filepath.Join(root, "real", "sub")
+
+	t.Setenv("HOME", sub)
+	if result := callBuiltin(t, handleCd); result.status != 0 || os.Getenv("PWD") != sub {
+		t.Errorf("cd = %+v, PWD %q, want %q", result, os.Getenv("PWD"), sub)
+	}
+
+	// cd - swaps PWD and OLDPWD and prints the new directory
+	result := callBuiltin(t, handleCd, "-")
+	if result.status != 0 || result.stdout != root+"\n" || os.Getenv("OLDPWD") != sub {
+		t.Errorf("cd - = %+v, OLDPWD %q", result, os.Getenv("OLDPWD"))
+	}
+
+	t.Setenv("HOME", "")
+	if result := callBuiltin(t, handleCd); result.status != 1 || result.stderr != "cd: HOME not set\n" {
+		t.Errorf("cd without HOME = %+v", result)
+	}
+	if result := callBuiltin(t, handleCd, "a", "b"); result.status != 1 || result.stderr != "cd: too many arguments\n" {
+		t.Errorf("cd a b = %+v", result)
+	}
+	result = callBuiltin(t, handleCd, "missing")
+	if want := "cd: missing: No such file or directory\n"; result.status != 1 || result.stderr != want {
+		t.Errorf("cd missing = %+v, want stderr %q", result, want)
+	}
+	if result := callBuiltin(t, handleCd, "-x"); result.status != 2 {
+		t.Errorf("cd -x = %+v, want status 2", result)
+	}
+}
+
+func TestCdPath(t *testing.T) {
+	root := directoryTree(t)
+	real := filepath.Join(root, "real")
+	sub := filepath.Join(real, "sub")
+
+	tests := []struct {
+		cdPath, dir string
+		want        string
+		fromCdPath  bool
+	}{
+		{"", "sub", "", false},
+		{real, "sub", filepath.Join(real, "sub"), true},
+		{"/nonexistent:" + real, "sub", filepath.Join(real, "sub"), true},
+		{":" + real, "real", "real", false},
+		{real, "./sub", "", false},
+		{real, "../sub", "", false},
+		{real, sub, "", false},
+		{real, "missing", "", false},
+	}
+	for _, test := range tests {
+		t.Setenv("CDPATH", test.cdPath)
+		found, fromCdPath := searchCdPath(test.dir)
+		if found != test.want || fromCdPath != test.fromCdPath {
+			t.Errorf("CDPATH=%q searchCdPath(%q) = %q, %v, want %q, %v",
+				test.cdPath, test.dir, found, fromCdPath, test.want, test.fromCdPath)
+		}
+	}
+
+	// A directory found through CDPATH is printed
+	t.Setenv("CDPATH", real)
+	result := callBuiltin(t, handleCd, "sub")
+	if result.status != 0 || result.stdout != sub+"\n" || os.Getenv("PWD") != sub {
+		t.Errorf("cd sub with CDPATH = %+v, PWD %q", result, os.Getenv("PWD"))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"shelly/app/commandHash"
 	"shelly/app/parser/ast"
 	"strings"
 	"syscall"
@@ -40,7 +41,34 @@ func runExecutableWithFds(cmd ast.SimpleCommand, stdinFd, stdoutFd, stderrFd uin
 	return
 }
 
+// CommandExists reports whether name would run something: a shell keyword,
+// a builtin or an executable. Nothing is hashed, so it can be called on every
+// keystroke.
+func CommandExists(name string) bool {
+	if _, ok := shellKeywords[name]; ok {
+		return true
+	}
+	if _, ok := shellBuiltins[name]; ok {
+		return true
+	}
+	if !strings.Contains(name, "/") {
+		_, ok := commandHash.Find(name)
+		return ok
+	}
+	_, err := findExecutableBinaryInPath(name)
+	return err == nil
+}
+
+// findExecutableBinaryInPath returns the executable run for cmd. Plain names
+// go through the command hash table (see the hash builtin).
 func findExecutableBinaryInPath(cmd string) (string, error) {
+	if !strings.Contains(cmd, "/") {
+		if fullPath, ok := commandHash.Lookup(cmd); ok {
+			return fullPath, nil
+		}
+		return "", fmt.Errorf("%s: command not found", cmd)
+	}
+
 	pathEnvVar, envVarExists := os.LookupEnv("PATH")
 	if !envVarExists {
 		return "", fmt.Errorf("PATH environment variable not set")
@@ -4,18 +4,145 @@ import (
 	"fmt"
 	"os"
 	"shelly/app/nullable"
+	"shelly/app/parser"
 	"shelly/app/parser/ast"
+	"shelly/app/parser/lexer"
+	"shelly/app/parser/token"
 	"syscall"
 )
 
-func RunPipeline(p ast.Pipeline) {
+// RunList runs the pipelines of a command list in order. A pipeline after
+// '&&' only runs when the previous status is zero, one after '||' only when it
+// is non-zero. It returns the status of the last pipeline that ran.
+//
+// Under `set -e` the shell exits as soon as a pipeline fails, except when the
+// failure is tested by '&&' or '||'. Under `set -n` a non-interactive shell
+// only parses the list.
+func RunList(list ast.CommandList) int {
+	status := state.lastStatus
+	shouldRun := true
+
+	if state.options.noexec && !state.interactive {
+		return status
+	}
+
+	// Signals that arrived while waiting at the prompt
+	runPendingTraps()
+
+	for _, item := range list.Items {
+		if shouldRun {
+			runTrap(trapDebug)
+			status = RunPipeline(item.Pipeline)
+
+			// Like bash, a failure that is tested by && or || is not an error
+			if status != 0 && item.Operator == ast.ListSequential {
+				runTrap(trapErr)
+				if state.options.errexit {
+					ExitShell(status)
+				}
+			}
+			runPendingTraps()
+		}
+
+		switch item.Operator {
+		case ast.ListAnd:
+			shouldRun = status == 0
+		case ast.ListOr:
+			shouldRun = status != 0
+		default:
+			shouldRun = true
+		}
+	}
+
+	return status
+}
+
+// RunString parses and runs a command line, e.g. a trap action, and returns
+// its exit status. Syntax errors are reported on stderr with status 2.
+func RunString(input string) int {
+	var lex = lexer.NewExpandingLexer(input)
+	tokens := []token.Token{}
+	for {
+		tok := lex.NextToken()
+		tokens = append(tokens, tok)
+		if tok.Type == token.TokenEOF {
+			break
+		}
+	}
+
+	var cmdParser = parser.NewParser(tokens)
+
+	list, err := cmdParser.Parse()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "shelly: %v\n", err)
+		state.lastStatus = 2
+		return 2
+	}
+
+	return RunList(list)
+}
+
+// RunPipeline runs every command of the pipeline and returns the exit status
+// of the last one, which is also remembered as $?. Under `set -o pipefail` the
+// status is the one of the last command that failed.
+//
+// The status of every command is kept in order in the PIPESTATUS array, see
+// PipeStatus.
+func RunPipeline(p ast.Pipeline) int {
+	expanded, expansionErr := expandPipeline(p)
+	if expansionErr != nil {
+		writeStringToFd(os.Stderr.Fd(), "shelly: "+expansionErr.Error()+"\n")
+		if !state.interactive {
+			ExitShell(expansionErr.exitStatus)
+		}
+		setPipeStatus([]int{1})
+		state.lastStatus = 1
+		return 1
+	}
+
+	if state.options.xtrace {
+		for _, cmd := range expanded.Commands {
+			traceCommand(cmd.Args, os.Stderr.Fd())
+		}
+	}
+
+	statuses := runPipeline(expanded)
+	setPipeStatus(statuses)
+
+	status := pipelineStatus(statuses)
+	state.lastStatus = status
+	return status
+}
+
+// pipelineStatus picks the status of a whole pipeline from the status of each
+// of its commands: the last one, or with pipefail the last non-zero one.
+func pipelineStatus(statuses []int) int {
+	status := statuses[len(statuses)-1]
+	if !state.options.pipefail {
+		return status
+	}
+	for _, stageStatus := range statuses {
+		if stageStatus != 0 {
+			status = stageStatus
+		}
+	}
+	return status
+}
+
+// runPipeline runs the commands and returns the exit status of each of them,
+// in pipeline order. A pipeline that fails to start reports a single status.
+func runPipeline(p ast.Pipeline) []int {
+
+	if len(p.Commands) == 0 {
+		return []int{state.lastStatus}
+	}
 
 	if len(p.Commands) == 1 {
-		RunSingleCommand(p.Commands[0])
+		status, _ := RunSingleCommand(p.Commands[0])
 		// if err != nil {
 		// 	fmt.Printf("failed to run single command: %v\n", err)
 		// }
-		return
+		return []int{status}
 	}
 
 	// default stdout/stderr for the whole pipeline
@@ -25,7 +152,7 @@ func RunPipeline(p ast.Pipeline) {
 	redirectStdoutNullable, redirectStderrNullable, err := setupRedirectsFd(p.Redirects)
 
 	if err != nil {
-		return
+		return []int{1}
 	}
 
 	if redirectStdout, hasValue := redirectStdoutNullable.Get(); hasValue {
@@ -42,6 +169,7 @@ func RunPipeline(p ast.Pipeline) {
 
 	var prevPipeReadFd int = -1
 	var processes []int
+	stagePids := make([]int, 0, len(p.Commands)) // 0 for a null command
 
 	// syscall.Pipe() creates a unidirectional data channel in the kernel.
 	// It returns two file descriptors:
@@ -74,8 +202,8 @@ func RunPipeline(p ast.Pipeline) {
 		pipeCreated := false
 		if i < len(p.Commands)-1 {
 			if err := syscall.Pipe(pipeFd[:]); err != nil {
-				fmt.Println("pipe failed: %v", err)
-				return
+				fmt.Printf("pipe failed: %v\n", err)
+				return []int{1}
 			}
 			pipeCreated = true
 		}
@@ -98,7 +226,7 @@ func RunPipeline(p ast.Pipeline) {
 
 		if err != nil {
 			cleanupPipeline(err, prevPipeReadFd, &pipeFd, pipeCreated, processes)
-			return
+			return []int{1}
 		}
 
 		// Close redirect FDs in parent (they are only used by the child)
@@ -109,6 +237,7 @@ func RunPipeline(p ast.Pipeline) {
 		if pid > 0 {
 			processes = append(processes, pid)
 		}
+		stagePids = append(stagePids, pid)
 
 		// close unused FDs
 		if prevPipeReadFd != -1 {
@@ -121,19 +250,25 @@ func RunPipeline(p ast.Pipeline) {
 		}
 	}
 
-	// wait for all children
-	for _, pid := range processes {
+	// wait for all children, collecting their statuses in pipeline order
+	statuses := make([]int, 0, len(stagePids))
+	for _, pid := range stagePids {
+		if pid == 0 {
+			// A null command succeeds
+			statuses = append(statuses, 0)
+			continue
+		}
 		var status syscall.WaitStatus
 		syscall.Wait4(pid, &status, 0, nil)
+		statuses = append(statuses, exitStatusFromWait(status))
 	}
 
+	return statuses
 }
 
-func RunSingleCommand(cmd ast.SimpleCommand) (err error) {
-	if len(cmd.Args) == 0 {
-		fmt.Println("Didn't find any data in the command")
-	}
-
+// RunSingleCommand runs one command in the shell process (builtins) or in a
+// child it waits for (external programs) and returns its exit status.
+func RunSingleCommand(cmd ast.SimpleCommand) (status int, err error) {
 	// IMPORTANT: use syscall.Stdin/Stdout/Stderr instead of os.Stdin/os.Stdout/os.Stderr.
 	//
 	// Why?
@@ -159,7 +294,7 @@ func RunSingleCommand(cmd ast.SimpleCommand) (err error) {
 	redirectStdoutNullable, redirectStderrNullable, err := setupRedirectsFd(cmd.Redirects)
 
 	if err != nil {
-		return
+		return 1, err
 	}
 
 	if redirectStdout, hasValue := redirectStdoutNullable.Get(); hasValue {
@@ -174,6 +309,11 @@ func RunSingleCommand(cmd ast.SimpleCommand) (err error) {
 		defer syscall.Close(redirectStderr)
 	}
 
+	// Every word expanded to nothing: only the redirections happen
+	if len(cmd.Args) == 0 {
+		return 0, nil
+	}
+
 	cmdName := cmd.Args[0]
 	args := cmd.Args[1:]
 
@@ -181,30 +321,73 @@ func RunSingleCommand(cmd ast.SimpleCommand) (err error) {
 	case "type":
 		handleType(args, stdoutFdPipe)
 	case "exit":
-		successExit := handleExit(args)
-		if successExit {
-			os.Exit(0)
+		status, shouldExit := handleExit(args, stderrFdPipe)
+		if shouldExit {
+			ExitShell(status)
 		}
+		return status, nil
+	case "return":
+		return handleReturn(args, stderrFdPipe), nil
+	case "trap":
+		return handleTrap(args, stdoutFdPipe, stderrFdPipe), nil
 	case "pwd":
-		handlePWD(stdoutFdPipe)
+		return handlePWD(args, stdoutFdPipe, stderrFdPipe), nil
 	case "cd":
-		handleCd(args)
+		return handleCd(args, stdoutFdPipe, stderrFdPipe), nil
 	case "history":
-		handleHistory(args)
+		return handleHistory(args, stdoutFdPipe, stderrFdPipe), nil
+	case "fc":
+		return handleFc(args, stdoutFdPipe, stderrFdPipe), nil
+	case "set":
+		return handleSet(args, stdoutFdPipe, stderrFdPipe), nil
+	case "shopt":
+		return handleShopt(args, stdoutFdPipe, stderrFdPipe), nil
+	case "hash":
+		return handleHash(args, stdoutFdPipe, stderrFdPipe), nil
+	case "complete":
+		return handleComplete(args, stdoutFdPipe, stderrFdPipe), nil
+	case "compgen":
+		return handleCompgen(args, stdoutFdPipe, stderrFdPipe), nil
+	case "pushd":
+		return handlePushd(args, stdoutFdPipe, stderrFdPipe), nil
+	case "popd":
+		return handlePopd(args, stdoutFdPipe, stderrFdPipe), nil
+	case "dirs":
+		return handleDirs(args, stdoutFdPipe, stderrFdPipe), nil
+	case "test":
+		return handleTest(args, stderrFdPipe), nil
+	case "[":
+		return handleBracketTest(args, stderrFdPipe), nil
+	case "[[":
+		return handleConditionalCommand(cmd, stderrFdPipe), nil
 	default:
 		pid, err := runExecutableWithFds(cmd, stdinFdPipe, stdoutFdPipe, stderrFdPipe)
 		if err != nil {
 			fmt.Println(err)
+			return commandNotFoundStatus, nil
 		}
 
-		var status syscall.WaitStatus
-		_, err = syscall.Wait4(pid, &status, 0, nil)
+		var waitStatus syscall.WaitStatus
+		_, err = syscall.Wait4(pid, &waitStatus, 0, nil)
 		if err != nil {
-			return fmt.Errorf("wait4 failed: %w", err)
+			return 1, fmt.Errorf("wait4 failed: %w", err)
 		}
+		return exitStatusFromWait(waitStatus), nil
 	}
 
-	return nil
+	return 0, nil
+}
+
+// Status reported when a command can't be found or executed, like bash.
+const commandNotFoundStatus = 127
+
+// exitStatusFromWait converts a wait status into a shell exit status.
+// A child killed by a signal reports 128 + the signal number.
+func exitStatusFromWait(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
 }
 
 func runCommandWithFds(cmd ast.SimpleCommand, stdinFd, stdoutFd, stderrFd uintptr) (pid int, fdsToClose []int, err error) {
@@ -223,6 +406,12 @@ func runCommandWithFds(cmd ast.SimpleCommand, stdinFd, stdoutFd, stderrFd uintpt
 		fdsToClose = append(fdsToClose, redirectStderr)
 	}
 
+	// Every word expanded to nothing (e.g. a nullglob pattern): like bash,
+	// the stage is a null command, there is nothing to fork (pid 0)
+	if len(cmd.Args) == 0 {
+		return 0, fdsToClose, nil
+	}
+
 	cmdName := cmd.Args[0]
 
 	// Handle builtins inside pipelines by running them in a subshell.
@@ -244,8 +433,7 @@ func runCommandWithFds(cmd ast.SimpleCommand, stdinFd, stdoutFd, stderrFd uintpt
 	//   - The parent shell remains unaffected, and the pipeline executes correctly.
 	//
 	// This ensures builtins integrate seamlessly into pipelines, just like external commands.
-	switch cmdName {
-	case "exit", "cd", "pwd", "type", "history":
+	if isShellBuiltin(cmdName) {
 		// ForkExec explanation:
 		//
 		// ForkExec is a low-level system call in Go that combines two classic Unix steps:
@@ -0,0 +1,138 @@
+package executer
+
+import (
+	"shelly/app/parser/ast"
+	"shelly/app/parser/lexer"
+	"shelly/app/pattern"
+	"strings"
+)
+
+// expansionError stops a pipeline before it runs, e.g. an unset variable under
+// `set -u`. A non-interactive shell exits with exitStatus.
+type expansionError struct {
+	message    string
+	exitStatus int
+}
+
+func (e *expansionError) Error() string {
+	return e.message
+}
+
+// expander resolves the words of one pipeline and remembers the first error.
+type expander struct {
+	err *expansionError
+}
+
+// expandPipeline resolves the parameter references left in the words of a
+// pipeline by the lexer and performs pathname expansion on the arguments. It
+// runs right before the pipeline starts so that it observes the state left by
+// earlier pipelines of the same list.
+//
+// The parsed pipeline is not modified; a copy with expanded words is returned.
+func expandPipeline(p ast.Pipeline) (ast.Pipeline, *expansionError) {
+	e := &expander{}
+	expanded := ast.Pipeline{
+		Commands:  make([]ast.SimpleCommand, len(p.Commands)),
+		Redirects: e.expandRedirects(p.Redirects),
+	}
+
+	for i, cmd := range p.Commands {
+		expanded.Commands[i] = e.expandCommand(cmd)
+	}
+
+	return expanded, e.err
+}
+
+func (e *expander) expandCommand(cmd ast.SimpleCommand) ast.SimpleCommand {
+	expanded := ast.SimpleCommand{
+		Redirects: e.expandRedirects(cmd.Redirects),
+	}
+
+	// Patterns inside [[ ]] are matched by the command, never against files
+	if cmd.Conditional != nil {
+		expanded.Args = e.expandWords(cmd.Args)
+		words := cmd.Conditional.Words
+		expanded.Conditional = &ast.ConditionalCommand{
+			Words:    e.expandWords(words),
+			Patterns: make([]string, len(words)),
+			Regexes:  make([]string, len(words)),
+		}
+		for i, word := range words {
+			expanded.Conditional.Patterns[i] = lexer.ExpandPattern(word, e.lookup)
+			expanded.Conditional.Regexes[i] = lexer.ExpandRegex(word, e.lookup)
+		}
+		return expanded
+	}
+
+	expanded.Args = e.expandArguments(cmd.Args)
+	return expanded
+}
+
+func (e *expander) expandWords(words []string) []string {
+	expanded := make([]string, len(words))
+	for i, word := range words {
+		expanded[i] = lexer.ExpandWord(word, e.lookup)
+	}
+	return expanded
+}
+
+// expandArguments expands words and replaces every word containing an
+// unquoted glob character with the sorted list of matching paths. A glob
+// without matches stays as typed, unless nullglob drops it or failglob makes
+// it an error; `set -f` turns pathname expansion off.
+func (e *expander) expandArguments(words []string) []string {
+	if state.options.noglob {
+		return e.expandWords(words)
+	}
+
+	expanded := make([]string, 0, len(words))
+	for _, word := range words {
+		glob, hasGlob := lexer.ExpandGlobPattern(word, e.lookup)
+		if !hasGlob {
+			expanded = append(expanded, lexer.ExpandWord(word, e.lookup))
+			continue
+		}
+
+		if matches := pattern.Glob(glob, state.options.dotglob); len(matches) > 0 {
+			expanded = append(expanded, matches...)
+			continue
+		}
+
+		switch {
+		case state.options.failglob:
+			e.fail("no match: "+pattern.Unescape(glob), 1)
+		case state.options.nullglob:
+		default:
+			expanded = append(expanded, pattern.Unescape(glob))
+		}
+	}
+	return expanded
+}
+
+func (e *expander) expandRedirects(redirects []ast.Redirect) []ast.Redirect {
+	expanded := make([]ast.Redirect, len(redirects))
+	for i, r := range redirects {
+		expanded[i] = ast.Redirect{Target: lexer.ExpandWord(r.Target, e.lookup), Type: r.Type}
+	}
+	return expanded
+}
+
+// lookup is LookupVariable, plus the `set -u` check and the rejection of
+// references that don't name a parameter.
+func (e *expander) lookup(name string) (string, bool) {
+	if typed, bad := strings.CutPrefix(name, lexer.BadSubstitution); bad {
+		e.fail("${"+typed+"}: bad substitution", 1)
+		return "", false
+	}
+	value, ok := LookupVariable(name)
+	if !ok && state.options.nounset {
+		e.fail(name+": unbound variable", 127)
+	}
+	return value, ok
+}
+
+func (e *expander) fail(message string, exitStatus int) {
+	if e.err == nil {
+		e.err = &expansionError{message: message, exitStatus: exitStatus}
+	}
+}
@@ -0,0 +1,282 @@
+package executer
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"shelly/app/history"
+	"strconv"
+	"strings"
+)
+
+const fcUsage = "fc: usage: fc [-e ename] [-lnr] [first] [last] or fc -s [pat=rep] [command]\n"
+
+// handleFc implements the fc builtin, which lists, edits and re-executes
+// commands from the history:
+//
+//	fc -l [-nr] [first [last]]   list commands (default: the last 16)
+//	fc [-e editor] [first [last]] edit commands (default: the previous one)
+//	                              in $FCEDIT, $EDITOR or vi, then run them
+//	fc -s [pat=rep] [command]    re-run command after replacing pat with rep
+//
+// first and last are history numbers, negative offsets (-1 is the previous
+// command) or the prefix of a command. -n omits the numbers and -r reverses
+// the order of the listing. The re-executed commands are echoed on stderr
+// and take the place of the fc command in the history.
+func handleFc(args []string, outFd, errFd uintptr) int {
+	var list, noNumbers, reverse, substitute bool
+	editor := ""
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' && !isHistoryOffset(args[0]) {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			switch flag := arg[i]; flag {
+			case 'l':
+				list = true
+			case 'n':
+				noNumbers = true
+			case 'r':
+				reverse = true
+			case 's':
+				substitute = true
+			case 'e':
+				if i+1 < len(arg) {
+					editor = arg[i+1:]
+				} else if len(args) > 0 {
+					editor = args[0]
+					args = args[1:]
+				} else {
+					writeStringToFd(errFd, "fc: -e: option requires an argument\n")
+					writeStringToFd(errFd, fcUsage)
+					return 2
+				}
+				i = len(arg)
+			default:
+				writeStringToFd(errFd, "fc: -"+string(flag)+": invalid option\n")
+				writeStringToFd(errFd, fcUsage)
+				return 2
+			}
+		}
+	}
+
+	manager := history.GetHistoryManager()
+
+	// The fc command itself is not a candidate: -1 is the command before it
+	entries := history.GetHistory(-1)
+	if manager.CurrentCommandRecorded() {
+		entries = entries[:len(entries)-1]
+	}
+
+	if substitute || editor == "-" {
+		return fcReexecute(manager, entries, args, errFd)
+	}
+
+	if len(entries) == 0 {
+		writeStringToFd(errFd, "fc: history specification out of range\n")
+		return 1
+	}
+
+	if len(args) > 2 {
+		writeStringToFd(errFd, fcUsage)
+		return 2
+	}
+
+	// Defaults: list the last 16 commands, edit the previous one
+	firstSpec, lastSpec := "-1", ""
+	if list {
+		firstSpec, lastSpec = "-16", "-1"
+	}
+	if len(args) > 0 {
+		firstSpec = args[0]
+		if list {
+			lastSpec = "-1"
+		}
+	}
+	if len(args) > 1 {
+		lastSpec = args[1]
+	}
+
+	first, ok := findFcEntry(entries, firstSpec, list)
+	if !ok {
+		writeStringToFd(errFd, "fc: "+firstSpec+": history specification out of range\n")
+		return 1
+	}
+	last := first
+	if lastSpec != "" {
+		if last, ok = findFcEntry(entries, lastSpec, list); !ok {
+			writeStringToFd(errFd, "fc: "+lastSpec+": history specification out of range\n")
+			return 1
+		}
+	}
+
+	// A range given backwards is listed (or edited) backwards
+	if first > last {
+		first, last = last, first
+		reverse = !reverse
+	}
+	selected := make([]history.HistoryEntry, last-first+1)
+	copy(selected, entries[first:last+1])
+	if reverse {
+		for i, j := 0, len(selected)-1; i < j; i, j = i+1, j-1 {
+			selected[i], selected[j] = selected[j], selected[i]
+		}
+	}
+
+	if list {
+		var builder strings.Builder
+		for _, entry := range selected {
+			if !noNumbers {
+				builder.WriteString(strconv.Itoa(entry.Index))
+			}
+			builder.WriteString("\t ")
+			builder.WriteString(entry.Line)
+			builder.WriteByte('\n')
+		}
+		writeStringToFd(outFd, builder.String())
+		return 0
+	}
+
+	return fcEdit(manager, selected, editor, errFd)
+}
+
+// fcReexecute implements `fc -s [pat=rep] [command]`.
+func fcReexecute(manager *history.HistoryManager, entries []history.HistoryEntry, args []string, errFd uintptr) int {
+	var replacements [][2]string
+	for len(args) > 0 && strings.Contains(args[0], "=") {
+		pat, rep, _ := strings.Cut(args[0], "=")
+		replacements = append(replacements, [2]string{pat, rep})
+		args = args[1:]
+	}
+
+	spec := "-1"
+	if len(args) > 0 {
+		spec = args[0]
+	}
+
+	idx, ok := findFcEntry(entries, spec, false)
+	if !ok {
+		writeStringToFd(errFd, "fc: no command found\n")
+		return 1
+	}
+
+	command := entries[idx].Line
+	for _, replacement := range replacements {
+		if replacement[0] != "" {
+			command = strings.ReplaceAll(command, replacement[0], replacement[1])
+		}
+	}
+
+	return fcRun(manager, []string{command}, errFd)
+}
+
+// fcEdit writes the selected commands to a temporary file, opens it in the
+// editor and runs what was saved.
+func fcEdit(manager *history.HistoryManager, selected []history.HistoryEntry, editor string, errFd uintptr) int {
+	if editor == "" {
+		editor = os.Getenv("FCEDIT")
+	}
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	file, err := os.CreateTemp("", "shelly-fc-*.sh")
+	if err != nil {
+		writeStringToFd(errFd, "fc: cannot create temp file: "+describeError(err)+"\n")
+		return 1
+	}
+	path := file.Name()
+	defer os.Remove(path)
+
+	var builder strings.Builder
+	for _, entry := range selected {
+		builder.WriteString(entry.Line)
+		builder.WriteByte('\n')
+	}
+	_, err = file.WriteString(builder.String())
+	file.Close()
+	if err != nil {
+		writeStringToFd(errFd, "fc: "+path+": "+describeError(err)+"\n")
+		return 1
+	}
+
+	// The editor may have arguments of its own (FCEDIT="code -w"), so let sh
+	// split the command line. It runs as a plain process: set -e, set -x and
+	// the traps of the shell don't apply to it.
+	command := exec.Command("/bin/sh", "-c", editor+` "$1"`, "sh", path)
+	command.Stdin, command.Stdout, command.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := command.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return max(exitErr.ExitCode(), 1)
+		}
+		writeStringToFd(errFd, "fc: "+editor+": "+describeError(err)+"\n")
+		return 1
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		writeStringToFd(errFd, "fc: "+path+": "+describeError(err)+"\n")
+		return 1
+	}
+
+	var commands []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.TrimSpace(line) != "" {
+			commands = append(commands, line)
+		}
+	}
+	return fcRun(manager, commands, errFd)
+}
+
+// fcRun echoes commands on errFd and runs them, recording them in the history
+// instead of the fc command. It returns the status of the last one.
+func fcRun(manager *history.HistoryManager, commands []string, errFd uintptr) int {
+	manager.RemoveCurrentCommand()
+
+	status := 0
+	for _, command := range commands {
+		writeStringToFd(errFd, command+"\n")
+		manager.StoreCommand(command)
+		status = RunString(command)
+	}
+	return status
+}
+
+// findFcEntry resolves a first/last operand of fc to a position in entries:
+// a history number, a negative offset from the end or a command prefix. When
+// clamp is set (listing), numbers outside the history select its ends.
+func findFcEntry(entries []history.HistoryEntry, spec string, clamp bool) (int, bool) {
+	if len(entries) == 0 {
+		return 0, false
+	}
+
+	if n, err := strconv.Atoi(spec); err == nil {
+		position := n - 1
+		if n < 0 {
+			position = len(entries) + n
+		}
+
+		if position < 0 || position >= len(entries) {
+			if !clamp {
+				return 0, false
+			}
+			position = max(0, min(position, len(entries)-1))
+		}
+		return position, true
+	}
+
+	for i := len(entries) - 1; i >= 0; i-- {
+		if strings.HasPrefix(entries[i].Line, spec) {
+			return i, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,121 @@
+package executer
+
+import (
+	"os"
+	"path/filepath"
+	"shelly/app/history"
+	"slices"
+	"testing"
+)
+
+func TestFindFcEntry(t *testing.T) {
+	var entries []history.HistoryEntry
+	for i, line := range []string{"ls -l", "echo a", "git status", "echo b"} {
+		entries = append(entries, history.HistoryEntry{Index: i + 1, Line: line})
+	}
+
+	tests := []struct {
+		spec  string
+		clamp bool
+		want  int
+		ok    bool
+	}{
+		{"1", false, 0, true},
+		{"4", false, 3, true},
+		{"-1", false, 3, true},
+		{"-4", false, 0, true},
+		{"5", false, 0, false},
+		{"-5", false, 0, false},
+		{"5", true, 3, true},
+		{"-16", true, 0, true},
+		{"echo", false, 3, true},
+		{"git", false, 2, true},
+		{"ls", false, 0, true},
+		{"cat", false, 0, false},
+	}
+	for _, test := range tests {
+		got, ok := findFcEntry(entries, test.spec, test.clamp)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("findFcEntry(%q, %v) = %d, %v, want %d, %v", test.spec, test.clamp, got, ok, test.want, test.ok)
+		}
+	}
+
+	if _, ok := findFcEntry(nil, "-1", true); ok {
+		t.Errorf("findFcEntry found an entry in an empty history")
+	}
+}
+
+// fcHistory empties the history and returns a file for the tests' commands
+// to write to.
+func fcHistory(t *testing.T) (*history.HistoryManager, string) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("HISTFILE", filepath.Join(dir, "history"))
+	manager := history.GetHistoryManager()
+	t.Cleanup(manager.Clear)
+	manager.Clear()
+	return manager, filepath.Join(dir, "output")
+}
+
+func TestFcSubstitute(t *testing.T) {
+	tests := []struct {
+		args   []string
+		output string
+	}{
+		{[]string{"-s"}, "two\n"},
+		{[]string{"-s", "two=three"}, "three\n"},
+		{[]string{"-s", "one=1", "echo o"}, "1\n"},
+		{[]string{"-e", "-", "1"}, "one\n"},
+	}
+	for _, test := range tests {
+		manager, output := fcHistory(t)
+		manager.StoreCommand("echo one >> " + output)
+		manager.StoreCommand("echo two >> " + output)
+
+		result := callBuiltin(t, handleFc, test.args...)
+		content, _ := os.ReadFile(output)
+		if result.status != 0 || string(content) != test.output {
+			t.Errorf("fc %q = %+v and wrote %q, want %q", test.args, result, content, test.output)
+			continue
+		}
+
+		// The command run is echoed and recorded in the history
+		lines := manager.Lines()
+		if last := lines[len(lines)-1]; result.stderr != last+"\n" || len(lines) != 3 {
+			t.Errorf("fc %q echoed %q and left %q", test.args, result.stderr, lines)
+		}
+	}
+
+	fcHistory(t)
+	if result := callBuiltin(t, handleFc, "-s", "nothing"); result.status != 1 || result.stderr != "fc: no command found\n" {
+		t.Errorf("fc -s nothing = %+v", result)
+	}
+}
+
+func TestFcEdit(t *testing.T) {
+	manager, output := fcHistory(t)
+	manager.StoreCommand("echo one >> " + output)
+
+	// The editor runs as its own process, whatever the shell options
+	withOptions(t)
+	state.options.errexit = true
+	t.Setenv("FCEDIT", "sed -i s/one/edited/")
+
+	result := callBuiltin(t, handleFc)
+	content, _ := os.ReadFile(output)
+	if result.status != 0 || string(content) != "edited\n" {
+		t.Errorf("fc = %+v and wrote %q", result, content)
+	}
+	if lines := manager.Lines(); !slices.Equal(lines, []string{"echo one >> " + output, "echo edited >> " + output}) {
+		t.Errorf("fc left %q in the history", lines)
+	}
+
+	// Nothing runs when the editor fails
+	t.Setenv("FCEDIT", "exit 3;")
+	if result := callBuiltin(t, handleFc); result.status != 3 || result.stderr != "" {
+		t.Errorf("fc with a failing editor = %+v", result)
+	}
+	if content, _ := os.ReadFile(output); string(content) != "edited\n" {
+		t.Errorf("fc with a failing editor wrote %q", content)
+	}
+}
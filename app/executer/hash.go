@@ -0,0 +1,109 @@
+package executer
+
+import (
+	"shelly/app/commandHash"
+	"strconv"
+	"strings"
+)
+
+const hashUsage = "hash: usage: hash [-r] [-p pathname] [-d] [name ...]\n"
+
+// handleHash implements the hash builtin, which manages the table of the
+// commands found in PATH:
+//
+//	hash                  list the hashed commands and their hits
+//	hash name...          look the names up in PATH and hash them
+//	hash -r               forget every command
+//	hash -d name...       forget the names
+//	hash -p path name...  hash the names to path without searching PATH
+func handleHash(args []string, outFd, errFd uintptr) int {
+	var reset, forget bool
+	pinPath := ""
+	hasPin := false
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+
+		for i := 1; i < len(arg); i++ {
+			switch flag := arg[i]; flag {
+			case 'r':
+				reset = true
+			case 'd':
+				forget = true
+			case 'p':
+				hasPin = true
+				if i+1 < len(arg) {
+					pinPath = arg[i+1:]
+				} else if len(args) > 0 {
+					pinPath = args[0]
+					args = args[1:]
+				} else {
+					writeStringToFd(errFd, "hash: -p: option requires an argument\n")
+					writeStringToFd(errFd, hashUsage)
+					return 2
+				}
+				i = len(arg)
+			default:
+				writeStringToFd(errFd, "hash: -"+string(flag)+": invalid option\n")
+				writeStringToFd(errFd, hashUsage)
+				return 2
+			}
+		}
+	}
+
+	if reset {
+		commandHash.Clear()
+	}
+
+	if len(args) == 0 {
+		if reset || forget || hasPin {
+			return 0
+		}
+		return printHashTable(outFd, errFd)
+	}
+
+	status := 0
+	for _, name := range args {
+		switch {
+		case hasPin:
+			commandHash.Pin(name, pinPath)
+		case forget:
+			if !commandHash.Forget(name) {
+				writeStringToFd(errFd, "hash: "+name+": not found\n")
+				status = 1
+			}
+		case isShellBuiltin(name) || strings.Contains(name, "/"):
+			// Builtins and paths are not looked up in PATH
+		case !commandHash.Remember(name):
+			writeStringToFd(errFd, "hash: "+name+": not found\n")
+			status = 1
+		}
+	}
+	return status
+}
+
+// printHashTable lists the hashed commands like bash.
+func printHashTable(outFd, errFd uintptr) int {
+	entries := commandHash.Entries()
+	if len(entries) == 0 {
+		writeStringToFd(errFd, "hash: hash table empty\n")
+		return 0
+	}
+
+	var builder strings.Builder
+	builder.WriteString("hits\tcommand\n")
+	for _, entry := range entries {
+		hits := strconv.Itoa(entry.Hits)
+		builder.WriteString(strings.Repeat(" ", max(0, 4-len(hits))))
+		builder.WriteString(hits)
+		builder.WriteByte('\t')
+		builder.WriteString(entry.Path)
+		builder.WriteByte('\n')
+	}
+	writeStringToFd(outFd, builder.String())
+	return 0
+}
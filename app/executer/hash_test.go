@@ -0,0 +1,62 @@
+package executer
+
+import (
+	"os"
+	"path/filepath"
+	"shelly/app/commandHash"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "tool"), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir)
+	commandHash.Clear()
+	tool := filepath.Join(dir, "tool")
+
+	if result := callBuiltin(t, handleHash); result.status != 0 || result.stderr != "hash: hash table empty\n" {
+		t.Errorf("hash with an empty table = %+v", result)
+	}
+
+	// Builtins and paths are accepted but not hashed
+	if result := callBuiltin(t, handleHash, "tool", "cd", "./x"); result.status != 0 {
+		t.Errorf("hash tool cd ./x = %+v", result)
+	}
+	commandHash.Lookup("tool")
+	callBuiltin(t, handleHash, "-p", "/opt/other", "other")
+	want := "hits\tcommand\n" +
+		"   0\t/opt/other\n" +
+		"   1\t" + tool + "\n"
+	if result := callBuiltin(t, handleHash); result.stdout != want {
+		t.Errorf("hash printed %q, want %q", result.stdout, want)
+	}
+
+	if result := callBuiltin(t, handleHash, "-d", "other", "nope"); result.status != 1 || result.stderr != "hash: nope: not found\n" {
+		t.Errorf("hash -d other nope = %+v", result)
+	}
+	if result := callBuiltin(t, handleHash, "missing"); result.status != 1 || result.stderr != "hash: missing: not found\n" {
+		t.Errorf("hash missing = %+v", result)
+	}
+	if _, ok := commandHash.Hashed("other"); ok {
+		t.Errorf("hash -d didn't forget other")
+	}
+
+	// -r with names empties the table and hashes them again
+	callBuiltin(t, handleHash, "-r", "tool")
+	if entries := commandHash.Entries(); len(entries) != 1 || entries[0].Hits != 0 {
+		t.Errorf("after hash -r tool: %+v", entries)
+	}
+	callBuiltin(t, handleHash, "-r")
+	if entries := commandHash.Entries(); len(entries) != 0 {
+		t.Errorf("after hash -r: %+v", entries)
+	}
+
+	if result := callBuiltin(t, handleHash, "-x"); result.status != 2 {
+		t.Errorf("hash -x = %+v, want status 2", result)
+	}
+	if result := callBuiltin(t, handleHash, "-p"); result.status != 2 || result.stderr != "hash: -p: option requires an argument\n"+hashUsage {
+		t.Errorf("hash -p = %+v", result)
+	}
+}
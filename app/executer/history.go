@@ -1,126 +1,299 @@
 package executer
 
 import (
-	"fmt"
-	"io"
+	"encoding/json"
+	"errors"
 	"os"
 	"shelly/app/history"
 	"strconv"
-	"unsafe"
+	"strings"
 )
 
-// handleHistory prints the current Readline command history to stdout.
-//
-// It uses the GNU Readline C library's history API to access the in-memory
-// history list. Each line entered by the user is stored as a HIST_ENTRY* in
-// a NULL-terminated array.
+const historyUsage = "history: usage: history [-c] [-d offset] [--json] [n] or history -anrw [filename] or history -ps arg [arg...]\n"
+
+// handleHistory implements the history builtin.
 //
-// Parameters:
-//   - args: Support options
+//	history [n]              print the history, or its last n entries
+//	history -c               clear the history
+//	history -d offset        delete an entry; a negative offset counts from the end
+//	history -d start-end     delete a range of entries
+//	history -a|-n|-r|-w [f]  append new lines to / read new lines from /
+//	                         read / write the history file (default: HISTFILE)
+//	history -p arg...        print the history expansion of each arg
+//	history -s arg...        store the args as one entry, replacing this command
+//	history --json [n]       print the structured history log ($SHELLY_HISTLOG)
 //
-// How it works:
-// 1. Calls C.history_list() to get a pointer to the array of HIST_ENTRY*.
-// 2. If the history list is empty (nil), the function returns immediately.
-// 3. Converts the base pointer of the list to uintptr to allow pointer arithmetic.
-// 4. Iterates through the array:
-//   - Calculates the pointer to the i-th entry using pointer arithmetic.
-//   - Dereferences the pointer to get the HIST_ENTRY*.
-//   - Breaks the loop if the entry is nil (end of list).
-//   - Converts the C string (entry.line) to a Go string and prints it with its index.
-func handleHistory(args []string) {
-
-	if len(args) > 0 {
-		switch args[0] {
-		case "-r":
-			loadHistoryFromFile(args)
-			return
-		case "-w":
-			loadHistoryToFile(args)
-			return
-		case "-a":
-			appendHistoryToFile(args)
-			return
+// Every line is printed with its index and, when HISTTIMEFORMAT is set, the
+// time it was entered formatted with it (strftime syntax).
+func handleHistory(args []string, outFd, errFd uintptr) int {
+	var clearHistory, expand, store, jsonOutput bool
+	var fileOp byte
+	var deleteSpec string
+	hasDelete := false
+
+	// getopt style: options can be combined (-cw) and -d takes a value. Like
+	// in bash, a negative count such as -5 is an invalid option.
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		arg := args[0]
+		args = args[1:]
+		if arg == "--" {
+			break
+		}
+		if arg == "--json" {
+			jsonOutput = true
+			continue
+		}
+
+		for i := 1; i < len(arg); i++ {
+			switch flag := arg[i]; flag {
+			case 'c':
+				clearHistory = true
+			case 'p':
+				expand = true
+			case 's':
+				store = true
+			case 'a', 'n', 'r', 'w':
+				if fileOp != 0 && fileOp != flag {
+					writeStringToFd(errFd, "history: cannot use more than one of -anrw\n")
+					return 1
+				}
+				fileOp = flag
+			case 'd':
+				hasDelete = true
+				if i+1 < len(arg) {
+					deleteSpec = arg[i+1:]
+				} else if len(args) > 0 {
+					deleteSpec = args[0]
+					args = args[1:]
+				} else {
+					writeStringToFd(errFd, "history: -d: option requires an argument\n")
+					writeStringToFd(errFd, historyUsage)
+					return 2
+				}
+				i = len(arg)
+			default:
+				writeStringToFd(errFd, "history: -"+string(flag)+": invalid option\n")
+				writeStringToFd(errFd, historyUsage)
+				return 2
+			}
+		}
+	}
+
+	manager := history.GetHistoryManager()
+
+	if clearHistory {
+		manager.Clear()
+		if !hasDelete && !store && !expand && fileOp == 0 {
+			return 0
+		}
+	}
+
+	if hasDelete {
+		return deleteHistory(manager, deleteSpec, errFd)
+	}
+
+	if store {
+		// This `history -s` command itself is replaced by the args
+		manager.RemoveCurrentCommand()
+		if len(args) > 0 {
+			manager.StoreCommand(strings.Join(args, " "))
 		}
+		return 0
+	}
+
+	if expand {
+		status := 0
+		for _, arg := range args {
+			expansion, err := manager.Expand(arg)
+			if err != nil {
+				writeStringToFd(errFd, "history: "+err.Error()+"\n")
+				status = 1
+				continue
+			}
+			writeStringToFd(outFd, expansion.Line+"\n")
+		}
+		return status
+	}
+
+	if fileOp != 0 {
+		var filename string
+		if len(args) > 0 {
+			filename = args[0]
+		}
+		return historyFileOperation(manager, fileOp, filename, errFd)
+	}
+
+	if clearHistory {
+		return 0
 	}
 
 	// Determine how many entries to print
 	var count int = -1 // default: print all
-	if len(args) > 0 {
+	if len(args) > 1 {
+		writeStringToFd(errFd, "history: too many arguments\n")
+		return 1
+	}
+	if len(args) == 1 {
 		n, err := strconv.Atoi(args[0])
 		if err != nil {
-			fmt.Printf("history: %s: numeric argument required\n", args[0])
-			return
+			writeStringToFd(errFd, "history: "+args[0]+": numeric argument required\n")
+			return 1
 		}
-
-		if n >= 0 {
-			count = n
+		if n < 0 {
+			// `history -- -5`
+			writeStringToFd(errFd, "history: "+args[0]+": invalid option\n")
+			writeStringToFd(errFd, historyUsage)
+			return 2
 		}
+		count = n
 	}
 
-	// historySoFar := history.GetHistory(count)
-
-	// for _, line := range historySoFar {
-	// 	// Print the history index and the line content
-	// 	fmt.Println(line.Index, line.Line)
-	// }
+	if jsonOutput {
+		return printHistoryLog(manager, count, outFd, errFd)
+	}
 
-	history.ForEachHistory(count, PrintHistory)
+	timeFormat, _ := LookupVariable("HISTTIMEFORMAT")
+	var builder strings.Builder
+	for _, entry := range history.GetHistory(count) {
+		builder.WriteString(strconv.Itoa(entry.Index))
+		builder.WriteByte(' ')
+		builder.WriteString(formatHistoryTime(entry, timeFormat))
+		builder.WriteString(entry.Line)
+		builder.WriteByte('\n')
+	}
+	writeStringToFd(outFd, builder.String())
+	return 0
 }
 
-func PrintHistory(idx int, line unsafe.Pointer) {
-	fmt.Fprintf(os.Stdout, "%d ", idx)
-	PrintCStr(os.Stdout, line)
-	fmt.Fprintln(os.Stdout)
+// printHistoryLog prints the last count records of the structured history
+// log as JSON Lines (all of them when count is negative).
+func printHistoryLog(manager *history.HistoryManager, count int, outFd, errFd uintptr) int {
+	records, ok, err := manager.LogRecords(count)
+	if !ok {
+		writeStringToFd(errFd, "history: SHELLY_HISTLOG is not set\n")
+		return 1
+	}
+	if err != nil {
+		writeStringToFd(errFd, "history: "+os.Getenv("SHELLY_HISTLOG")+": "+describeError(err)+"\n")
+		return 1
+	}
+
+	var builder strings.Builder
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			continue
+		}
+		builder.Write(line)
+		builder.WriteByte('\n')
+	}
+	writeStringToFd(outFd, builder.String())
+	return 0
 }
 
-func PrintCStr(w io.Writer, cstr unsafe.Pointer) {
-	ptr := uintptr(cstr)
-	length := 0
-	//C doesn't buffer the string size, so we need to figure out the size. C.strlen could also be used
-	for *(*byte)(unsafe.Pointer(ptr + uintptr(length))) != 0 {
-		length++
+// deleteHistory implements `history -d offset` and `history -d start-end`.
+// Offsets are the indices printed by `history`; negative ones count back
+// from the end, -1 being this very command.
+func deleteHistory(manager *history.HistoryManager, spec string, errFd uintptr) int {
+	total := manager.Len()
+
+	first, last, ok := parseHistoryRange(spec, total)
+	if !ok {
+		writeStringToFd(errFd, "history: "+spec+": history position out of range\n")
+		return 1
 	}
 
-	// Convert to slice pointing directly to C memory (no allocation)
-	b := unsafe.Slice((*byte)(unsafe.Pointer(ptr)), length)
-	w.Write(b)
+	manager.DeleteRange(first, last)
+	return 0
 }
 
-// loadHistoryFromFile loads history entries from a file into the readline history.
-//
-// Usage: history -r [filename]
-// If no filename is provided, defaults to ~/.history or another configured file.
-func loadHistoryFromFile(args []string) {
-	var filename string
-	if len(args) > 1 {
-		filename = args[1]
+// parseHistoryRange turns an offset or start-end range into 0 based
+// positions in a history of the given length.
+func parseHistoryRange(spec string, total int) (first, last int, ok bool) {
+	// The '-' separating a range is the first one after the start offset,
+	// which may itself be negative
+	separator := -1
+	if len(spec) > 1 {
+		if i := strings.IndexByte(spec[1:], '-'); i >= 0 {
+			separator = i + 1
+		}
 	}
 
-	history.GetHistoryManager().ReadHistory(filename)
+	if separator < 0 {
+		position, ok := resolveHistoryOffset(spec, total)
+		return position, position, ok
+	}
+
+	first, ok = resolveHistoryOffset(spec[:separator], total)
+	if !ok {
+		return 0, 0, false
+	}
+	last, ok = resolveHistoryOffset(spec[separator+1:], total)
+	if !ok || last < first {
+		return 0, 0, false
+	}
+	return first, last, true
 }
 
-// loadHistoryToFile saves the current readline history to a file.
-//
-// Usage: history -w [filename]
-// If no filename is provided, nothing happens
-func loadHistoryToFile(args []string) {
-	var filename string
-	if len(args) > 1 {
-		filename = args[1]
+// resolveHistoryOffset converts a history index (1 based, negative counting
+// from the end) into a 0 based position.
+func resolveHistoryOffset(offset string, total int) (int, bool) {
+	n, err := strconv.Atoi(offset)
+	if err != nil || n == 0 {
+		return 0, false
 	}
 
-	history.GetHistoryManager().WriteHistoryToFile(filename)
+	position := n - 1
+	if n < 0 {
+		position = total + n
+	}
+	if position < 0 || position >= total {
+		return 0, false
+	}
+	return position, true
 }
 
-// appendHistoryToFile appends new history entries to a file.a
-//
-// Usage: history -a [filename]
-// If no filename is provided, defaults to ~/.history
-func appendHistoryToFile(args []string) {
-	var filename string
-	if len(args) > 1 {
-		filename = args[1]
+// isHistoryOffset reports whether arg is a negative number, which is an
+// operand rather than an option.
+func isHistoryOffset(arg string) bool {
+	_, err := strconv.Atoi(arg)
+	return err == nil
+}
+
+// historyFileOperation runs -a, -n, -r or -w on filename (the default history
+// file when empty) and reports failures on errFd.
+func historyFileOperation(manager *history.HistoryManager, op byte, filename string, errFd uintptr) int {
+	var err error
+	switch op {
+	case 'a':
+		err = manager.AppendHistoryToFile(filename)
+	case 'n':
+		err = manager.ReadNewHistory(filename)
+	case 'r':
+		err = manager.ReadHistory(filename)
+	case 'w':
+		err = manager.WriteHistoryToFile(filename)
 	}
 
-	history.GetHistoryManager().AppendHistoryToFile(filename)
+	if err != nil {
+		var pathErr *os.PathError
+		if errors.As(err, &pathErr) {
+			filename = pathErr.Path
+		}
+		writeStringToFd(errFd, "history: "+filename+": "+describeError(err)+"\n")
+		return 1
+	}
+	return 0
+}
+
+// formatHistoryTime renders the timestamp shown before a history line when
+// HISTTIMEFORMAT is set. Entries without a timestamp show "??" like in bash.
+func formatHistoryTime(entry history.HistoryEntry, timeFormat string) string {
+	if timeFormat == "" {
+		return ""
+	}
+	if entry.Time.IsZero() {
+		return "??"
+	}
+	return history.FormatTime(timeFormat, entry.Time)
 }
@@ -0,0 +1,100 @@
+package executer
+
+import (
+	"path/filepath"
+	"shelly/app/history"
+	"slices"
+	"testing"
+)
+
+func TestParseHistoryRange(t *testing.T) {
+	tests := []struct {
+		spec        string
+		first, last int
+		ok          bool
+	}{
+		{"1", 0, 0, true},
+		{"5", 4, 4, true},
+		{"6", 0, 0, false},
+		{"0", 0, 0, false},
+		{"-1", 4, 4, true},
+		{"-5", 0, 0, true},
+		{"-6", 0, 0, false},
+		{"2-4", 1, 3, true},
+		{"-3--1", 2, 4, true},
+		{"2--1", 1, 4, true},
+		{"4-2", 0, 0, false},
+		{"2-9", 0, 0, false},
+		{"x", 0, 0, false},
+		{"2-", 0, 0, false},
+		{"-", 0, 0, false},
+	}
+	for _, test := range tests {
+		first, last, ok := parseHistoryRange(test.spec, 5)
+		if ok != test.ok || (ok && (first != test.first || last != test.last)) {
+			t.Errorf("parseHistoryRange(%q, 5) = %d, %d, %v, want %d, %d, %v",
+				test.spec, first, last, ok, test.first, test.last, test.ok)
+		}
+	}
+}
+
+func TestHistoryDelete(t *testing.T) {
+	t.Setenv("HISTFILE", filepath.Join(t.TempDir(), "history"))
+	manager := history.GetHistoryManager()
+	t.Cleanup(manager.Clear)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"-d", "2"}, []string{"a", "c", "d", "e"}},
+		{[]string{"-d", "-1"}, []string{"a", "b", "c", "d"}},
+		{[]string{"-d2-4"}, []string{"a", "e"}},
+		{[]string{"-d", "-3--2"}, []string{"a", "b", "e"}},
+	}
+	for _, test := range tests {
+		manager.Clear()
+		for _, line := range []string{"a", "b", "c", "d", "e"} {
+			manager.StoreCommand(line)
+		}
+		if result := callBuiltin(t, handleHistory, test.args...); result.status != 0 {
+			t.Errorf("history %q = %+v", test.args, result)
+		}
+		if got := manager.Lines(); !slices.Equal(got, test.want) {
+			t.Errorf("history %q left %q, want %q", test.args, got, test.want)
+		}
+	}
+
+	result := callBuiltin(t, handleHistory, "-d", "9")
+	if result.status != 1 || result.stderr != "history: 9: history position out of range\n" {
+		t.Errorf("history -d 9 = %+v", result)
+	}
+}
+
+func TestHistoryCount(t *testing.T) {
+	t.Setenv("HISTFILE", filepath.Join(t.TempDir(), "history"))
+	t.Setenv("HISTTIMEFORMAT", "")
+	manager := history.GetHistoryManager()
+	t.Cleanup(manager.Clear)
+	manager.Clear()
+	for _, line := range []string{"a", "b", "c"} {
+		manager.StoreCommand(line)
+	}
+
+	if result := callBuiltin(t, handleHistory, "2"); result.stdout != "2 b\n3 c\n" {
+		t.Errorf("history 2 printed %q", result.stdout)
+	}
+	if result := callBuiltin(t, handleHistory); result.stdout != "1 a\n2 b\n3 c\n" {
+		t.Errorf("history printed %q", result.stdout)
+	}
+
+	for _, args := range [][]string{{"-5"}, {"--", "-5"}} {
+		result := callBuiltin(t, handleHistory, args...)
+		if result.status != 2 || result.stdout != "" || result.stderr != "history: -5: invalid option\n"+historyUsage {
+			t.Errorf("history %q = %+v", args, result)
+		}
+	}
+	if result := callBuiltin(t, handleHistory, "x"); result.status != 1 {
+		t.Errorf("history x = %+v, want status 1", result)
+	}
+}
@@ -0,0 +1,440 @@
+package executer
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// shellOptions holds the behaviour switches changed with `set` and `shopt`.
+type shellOptions struct {
+	errexit    bool // -e: exit when a pipeline fails outside of a condition
+	histexpand bool // -H: expand !! and friends in lines read at the prompt
+	nounset    bool // -u: expanding an unset variable is an error
+	xtrace     bool // -x: print every command after expansion, prefixed by $PS4
+	pipefail   bool // a pipeline fails when any of its commands fails
+	noexec     bool // -n: parse commands without running them (non-interactive only)
+	noglob     bool // -f: no pathname expansion
+	emacs      bool // emacs keybindings at the prompt (the default)
+	vi         bool // vi keybindings at the prompt
+
+	// shopt options
+	dotglob   bool // globs match names starting with '.'
+	failglob  bool // a glob without matches is an error
+	histshare bool // share the history file live with the other shells
+	nullglob  bool // a glob without matches expands to nothing
+}
+
+// shellOption ties an option name to its switch. letter is the short flag of
+// `set` (0 when the option only has a long name).
+type shellOption struct {
+	name   string
+	letter byte
+	value  *bool
+}
+
+// setOptions are the options of `set`, sorted by name like `set -o` lists them.
+var setOptions = []shellOption{
+	{"emacs", 0, &state.options.emacs},
+	{"errexit", 'e', &state.options.errexit},
+	{"histexpand", 'H', &state.options.histexpand},
+	{"noexec", 'n', &state.options.noexec},
+	{"noglob", 'f', &state.options.noglob},
+	{"nounset", 'u', &state.options.nounset},
+	{"pipefail", 0, &state.options.pipefail},
+	{"vi", 0, &state.options.vi},
+	{"xtrace", 'x', &state.options.xtrace},
+}
+
+// shoptOptions are the extended options of `shopt`, sorted by name.
+var shoptOptions = []shellOption{
+	{"dotglob", 0, &state.options.dotglob},
+	{"failglob", 0, &state.options.failglob},
+	{"histshare", 0, &state.options.histshare},
+	{"nullglob", 0, &state.options.nullglob},
+}
+
+func findOption(options []shellOption, name string) (shellOption, bool) {
+	for _, option := range options {
+		if option.name == name {
+			return option, true
+		}
+	}
+	return shellOption{}, false
+}
+
+// OptionEnabled reports whether the `set -o` or `shopt` option name is on.
+func OptionEnabled(name string) bool {
+	if option, ok := findOption(setOptions, name); ok {
+		return *option.value
+	}
+	if option, ok := findOption(shoptOptions, name); ok {
+		return *option.value
+	}
+	return false
+}
+
+// setOption turns option on or off. emacs and vi are the two editing modes of
+// the prompt: turning one on turns the other off.
+func setOption(option shellOption, enable bool) {
+	*option.value = enable
+	if enable {
+		switch option.name {
+		case "emacs":
+			state.options.vi = false
+		case "vi":
+			state.options.emacs = false
+		}
+	}
+}
+
+func findOptionLetter(letter byte) (shellOption, bool) {
+	for _, option := range setOptions {
+		if option.letter != 0 && option.letter == letter {
+			return option, true
+		}
+	}
+	return shellOption{}, false
+}
+
+// optionFlags returns the value of $-: the letters of the enabled options,
+// plus 'i' in an interactive shell.
+func optionFlags() string {
+	var flags []byte
+	for _, option := range setOptions {
+		if option.letter != 0 && *option.value {
+			flags = append(flags, option.letter)
+		}
+	}
+	if state.interactive {
+		flags = append(flags, 'i')
+	}
+	return string(flags)
+}
+
+// handleSet implements `set [-efnuxH] [+efnuxH] [-o name] [+o name]`.
+//
+//   - -x turns an option on, +x turns it off; letters can be combined (-eu)
+//   - -o name / +o name do the same with the long option name
+//   - -o alone lists the options, +o alone prints them as `set` commands
+//   - without arguments the shell variables are listed
+//
+// Positional parameters are not supported, so operands are an error.
+func handleSet(args []string, outFd, errFd uintptr) int {
+	if len(args) == 0 {
+		printVariables(outFd)
+		return 0
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" {
+			if i+1 < len(args) {
+				writeStringToFd(errFd, "set: positional parameters are not supported\n")
+				return 2
+			}
+			return 0
+		}
+
+		if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			writeStringToFd(errFd, "set: positional parameters are not supported\n")
+			return 2
+		}
+
+		enable := arg[0] == '-'
+		for j := 1; j < len(arg); j++ {
+			if arg[j] != 'o' {
+				option, ok := findOptionLetter(arg[j])
+				if !ok {
+					writeStringToFd(errFd, "set: "+arg[:1]+string(arg[j])+": invalid option\n")
+					writeStringToFd(errFd, "set: usage: set [-efnuxH] [-o option-name]\n")
+					return 2
+				}
+				*option.value = enable
+				continue
+			}
+
+			// -o takes the next argument as option name, or lists the options
+			if i+1 >= len(args) {
+				writeOptions(setOptions, outFd, !enable, "set")
+				continue
+			}
+			i++
+			option, ok := findOption(setOptions, args[i])
+			if !ok {
+				writeStringToFd(errFd, "set: "+args[i]+": invalid option name\n")
+				return 2
+			}
+			setOption(option, enable)
+		}
+	}
+
+	return 0
+}
+
+// handleShopt implements `shopt [-pqsuo] [name ...]`.
+//
+//   - -s / -u enable / disable the named options
+//   - without -s or -u the named (or all) options are listed; the status is 0
+//     only when all of them are on
+//   - -p lists them as reusable `shopt` commands, -q lists nothing
+//   - -o works on the `set -o` options instead
+func handleShopt(args []string, outFd, errFd uintptr) int {
+	var set, unset, reusable, quiet, setO bool
+
+	for len(args) > 0 && len(args[0]) > 1 && args[0][0] == '-' {
+		if args[0] == "--" {
+			args = args[1:]
+			break
+		}
+		for _, flag := range args[0][1:] {
+			switch flag {
+			case 's':
+				set = true
+			case 'u':
+				unset = true
+			case 'p':
+				reusable = true
+			case 'q':
+				quiet = true
+			case 'o':
+				setO = true
+			default:
+				writeStringToFd(errFd, "shopt: -"+string(flag)+": invalid option\n")
+				writeStringToFd(errFd, "shopt: usage: shopt [-pqsu] [-o] [optname ...]\n")
+				return 2
+			}
+		}
+		args = args[1:]
+	}
+
+	if set && unset {
+		writeStringToFd(errFd, "shopt: cannot set and unset shell options simultaneously\n")
+		return 1
+	}
+
+	options := shoptOptions
+	command := "shopt"
+	if setO {
+		options = setOptions
+		command = "set"
+	}
+
+	selected := options
+	if len(args) > 0 {
+		selected = nil
+		for _, name := range args {
+			option, ok := findOption(options, name)
+			if !ok {
+				writeStringToFd(errFd, "shopt: "+name+": invalid shell option name\n")
+				return 1
+			}
+			selected = append(selected, option)
+		}
+	}
+
+	if set || unset {
+		if len(args) == 0 {
+			// Like bash, list the options that are in the requested state
+			var matching []shellOption
+			for _, option := range options {
+				if *option.value == set {
+					matching = append(matching, option)
+				}
+			}
+			if !quiet {
+				writeOptions(matching, outFd, reusable, command)
+			}
+			return 0
+		}
+		for _, option := range selected {
+			setOption(option, set)
+		}
+		return 0
+	}
+
+	status := 0
+	for _, option := range selected {
+		if !*option.value {
+			status = 1
+		}
+	}
+	if !quiet {
+		writeOptions(selected, outFd, reusable, command)
+	}
+	return status
+}
+
+// writeOptions lists options as `name<TAB>on|off`, or with asCommands as the
+// `set`/`shopt` commands that restore their current values.
+func writeOptions(options []shellOption, outFd uintptr, asCommands bool, command string) {
+	var builder strings.Builder
+	for _, option := range options {
+		if asCommands {
+			builder.WriteString(command)
+			switch {
+			case command == "set" && *option.value:
+				builder.WriteString(" -o ")
+			case command == "set":
+				builder.WriteString(" +o ")
+			case *option.value:
+				builder.WriteString(" -s ")
+			default:
+				builder.WriteString(" -u ")
+			}
+			builder.WriteString(option.name)
+			builder.WriteByte('\n')
+			continue
+		}
+
+		builder.WriteString(option.name)
+		if len(option.name) < 15 {
+			builder.WriteString(strings.Repeat(" ", 15-len(option.name)))
+		}
+		builder.WriteByte('\t')
+		if *option.value {
+			builder.WriteString("on\n")
+		} else {
+			builder.WriteString("off\n")
+		}
+	}
+	writeStringToFd(outFd, builder.String())
+}
+
+// printVariables lists the shell and environment variables as name=value.
+func printVariables(outFd uintptr) {
+	values := make(map[string]string)
+	for _, entry := range os.Environ() {
+		if name, value, ok := strings.Cut(entry, "="); ok {
+			values[name] = value
+		}
+	}
+	for name, value := range state.variables {
+		values[name] = value
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var builder strings.Builder
+	for _, name := range names {
+		builder.WriteString(name)
+		builder.WriteByte('=')
+		builder.WriteString(quoteWord(values[name]))
+		builder.WriteByte('\n')
+	}
+	writeStringToFd(outFd, builder.String())
+}
+
+// quoteWord single quotes s when the shell would not read it back as the same
+// word otherwise.
+func quoteWord(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\n'\"\\$`*?[]{}()<>|&;#~!=") {
+		return s
+	}
+	return singleQuote(s)
+}
+
+// traceCommand prints a command for `set -x`: $PS4 (default "+ ") followed by
+// the expanded words.
+func traceCommand(args []string, errFd uintptr) {
+	prefix, ok := LookupVariable("PS4")
+	if !ok {
+		prefix = "+ "
+	}
+
+	var builder strings.Builder
+	builder.WriteString(prefix)
+	for i, arg := range args {
+		if i > 0 {
+			builder.WriteByte(' ')
+		}
+		builder.WriteString(quoteWord(arg))
+	}
+	builder.WriteByte('\n')
+	writeStringToFd(errFd, builder.String())
+}
+
+// Invocation describes the command line the shell was started with.
+type Invocation struct {
+	Command    string // the command given with -c
+	HasCommand bool
+	Script     string   // the script file to run, if any
+	Args       []string // operands after the command or script
+}
+
+// ParseInvocation applies the options given on the shell command line, e.g.
+// `shelly -eu -o pipefail -O nullglob script.sh` or `shelly -x -c 'cmd'`.
+// The options are the ones of `set`, -O/+O take a `shopt` option name.
+// It reports problems on errFd and returns false when the command line is
+// invalid.
+func ParseInvocation(args []string, errFd uintptr) (Invocation, bool) {
+	var invocation Invocation
+
+	// Like bash, history expansion is on by default, but only matters at the
+	// prompt: -c commands and scripts never go through it.
+	state.options.histexpand = true
+
+	i := 0
+	for ; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || arg == "-" {
+			i++
+			break
+		}
+		if len(arg) < 2 || (arg[0] != '-' && arg[0] != '+') {
+			break
+		}
+
+		enable := arg[0] == '-'
+		for j := 1; j < len(arg); j++ {
+			switch arg[j] {
+			case 'c':
+				invocation.HasCommand = enable
+			case 'o', 'O':
+				options, kind := setOptions, "option name"
+				if arg[j] == 'O' {
+					options, kind = shoptOptions, "shell option name"
+				}
+				if i+1 >= len(args) {
+					writeStringToFd(errFd, "shelly: "+arg[:1]+string(arg[j])+": option requires an argument\n")
+					return invocation, false
+				}
+				i++
+				option, ok := findOption(options, args[i])
+				if !ok {
+					writeStringToFd(errFd, "shelly: "+args[i]+": invalid "+kind+"\n")
+					return invocation, false
+				}
+				setOption(option, enable)
+			default:
+				option, ok := findOptionLetter(arg[j])
+				if !ok {
+					writeStringToFd(errFd, "shelly: "+arg[:1]+string(arg[j])+": invalid option\n")
+					writeStringToFd(errFd, "Usage: shelly [-efnuxH] [-o option] [-O shopt_option] [-c command | script] [args ...]\n")
+					return invocation, false
+				}
+				*option.value = enable
+			}
+		}
+	}
+
+	operands := args[i:]
+	if invocation.HasCommand {
+		if len(operands) == 0 {
+			writeStringToFd(errFd, "shelly: -c: option requires an argument\n")
+			return invocation, false
+		}
+		invocation.Command = operands[0]
+		invocation.Args = operands[1:]
+	} else if len(operands) > 0 {
+		invocation.Script = operands[0]
+		invocation.Args = operands[1:]
+	}
+
+	state.interactive = !invocation.HasCommand && invocation.Script == ""
+	return invocation, true
+}
@@ -0,0 +1,167 @@
+package executer
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+// withOptions restores the shell options and the interactive flag after a
+// test.
+func withOptions(t *testing.T) {
+	t.Helper()
+	saved, interactive := state.options, state.interactive
+	t.Cleanup(func() { state.options, state.interactive = saved, interactive })
+}
+
+func TestSet(t *testing.T) {
+	withOptions(t)
+	state.options = shellOptions{emacs: true}
+
+	if result := callBuiltin(t, handleSet, "-eu", "-o", "pipefail", "+o", "emacs"); result.status != 0 {
+		t.Fatalf("set -eu -o pipefail +o emacs = %+v", result)
+	}
+	if want := (shellOptions{errexit: true, nounset: true, pipefail: true}); state.options != want {
+		t.Errorf("options = %+v, want %+v", state.options, want)
+	}
+	if got := optionFlags(); got != "eu" {
+		t.Errorf("$- = %q, want %q", got, "eu")
+	}
+
+	callBuiltin(t, handleSet, "+e", "-o", "vi")
+	if state.options.errexit || !state.options.vi || state.options.emacs {
+		t.Errorf("after set +e -o vi: %+v", state.options)
+	}
+	callBuiltin(t, handleSet, "-o", "emacs")
+	if !state.options.emacs || state.options.vi {
+		t.Errorf("set -o emacs didn't turn vi off: %+v", state.options)
+	}
+
+	result := callBuiltin(t, handleSet, "+o")
+	if !slices.Contains(strings.Split(result.stdout, "\n"), "set -o nounset") || !slices.Contains(strings.Split(result.stdout, "\n"), "set +o xtrace") {
+		t.Errorf("set +o printed %q", result.stdout)
+	}
+	result = callBuiltin(t, handleSet, "-o")
+	if !slices.Contains(strings.Split(result.stdout, "\n"), "pipefail       \ton") {
+		t.Errorf("set -o printed %q", result.stdout)
+	}
+
+	errors := []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"-z"}, "set: -z: invalid option\nset: usage: set [-efnuxH] [-o option-name]\n"},
+		{[]string{"-o", "nope"}, "set: nope: invalid option name\n"},
+		{[]string{"a"}, "set: positional parameters are not supported\n"},
+		{[]string{"--", "a"}, "set: positional parameters are not supported\n"},
+	}
+	for _, test := range errors {
+		if result := callBuiltin(t, handleSet, test.args...); result.status != 2 || result.stderr != test.stderr {
+			t.Errorf("set %q = %+v, want stderr %q", test.args, result, test.stderr)
+		}
+	}
+}
+
+func TestShopt(t *testing.T) {
+	withOptions(t)
+	state.options = shellOptions{emacs: true}
+
+	tests := []struct {
+		args   []string
+		status int
+		stdout string
+	}{
+		{[]string{"-s", "nullglob", "dotglob"}, 0, ""},
+		{[]string{"nullglob"}, 0, "nullglob       \ton\n"},
+		{[]string{"nullglob", "failglob"}, 1, "nullglob       \ton\nfailglob       \toff\n"},
+		{[]string{"-q", "failglob"}, 1, ""},
+		{[]string{"-s"}, 0, "dotglob        \ton\nnullglob       \ton\n"},
+		{[]string{"-p", "-u"}, 0, "shopt -u failglob\nshopt -u histshare\n"},
+		{[]string{"-u", "dotglob"}, 0, ""},
+		{[]string{"-p", "dotglob"}, 1, "shopt -u dotglob\n"},
+		{[]string{"-o", "-s", "xtrace"}, 0, ""},
+		{[]string{"-op", "xtrace", "errexit"}, 1, "set -o xtrace\nset +o errexit\n"},
+	}
+	for _, test := range tests {
+		result := callBuiltin(t, handleShopt, test.args...)
+		if result.status != test.status || result.stdout != test.stdout {
+			t.Errorf("shopt %q = %+v, want %d and %q", test.args, result, test.status, test.stdout)
+		}
+	}
+	if !state.options.nullglob || state.options.dotglob || !state.options.xtrace {
+		t.Errorf("options = %+v", state.options)
+	}
+
+	if result := callBuiltin(t, handleShopt, "-s", "-u", "nullglob"); result.status != 1 {
+		t.Errorf("shopt -s -u = %+v, want status 1", result)
+	}
+	if result := callBuiltin(t, handleShopt, "nope"); result.status != 1 || result.stderr != "shopt: nope: invalid shell option name\n" {
+		t.Errorf("shopt nope = %+v", result)
+	}
+	if result := callBuiltin(t, handleShopt, "-x"); result.status != 2 {
+		t.Errorf("shopt -x = %+v, want status 2", result)
+	}
+}
+
+func TestParseInvocation(t *testing.T) {
+	tests := []struct {
+		args        []string
+		want        Invocation
+		options     shellOptions
+		interactive bool
+	}{
+		{nil, Invocation{}, shellOptions{}, true},
+		{[]string{"-c", "echo hi", "a", "b"}, Invocation{Command: "echo hi", HasCommand: true, Args: []string{"a", "b"}}, shellOptions{}, false},
+		{[]string{"-xc", "ls"}, Invocation{Command: "ls", HasCommand: true, Args: []string{}}, shellOptions{xtrace: true}, false},
+		{[]string{"-eu", "-o", "pipefail", "-O", "nullglob", "script.sh", "-x"}, Invocation{Script: "script.sh", Args: []string{"-x"}},
+			shellOptions{errexit: true, nounset: true, pipefail: true, nullglob: true}, false},
+		{[]string{"+H", "--", "-script"}, Invocation{Script: "-script", Args: []string{}}, shellOptions{}, false},
+		{[]string{"-o", "vi"}, Invocation{}, shellOptions{vi: true, histexpand: true}, true},
+	}
+
+	for _, test := range tests {
+		withOptions(t)
+		state.options = shellOptions{}
+		invocation, ok := ParseInvocation(test.args, devNull(t))
+		if !ok {
+			t.Errorf("ParseInvocation(%q) failed", test.args)
+			continue
+		}
+		if invocation.Command != test.want.Command || invocation.HasCommand != test.want.HasCommand ||
+			invocation.Script != test.want.Script || !slices.Equal(invocation.Args, test.want.Args) {
+			t.Errorf("ParseInvocation(%q) = %+v, want %+v", test.args, invocation, test.want)
+		}
+
+		// histexpand is on unless +H turned it off
+		want := test.options
+		if !slices.Contains(test.args, "+H") {
+			want.histexpand = true
+		}
+		if state.options != want || state.interactive != test.interactive {
+			t.Errorf("ParseInvocation(%q) set %+v, interactive %v, want %+v, %v",
+				test.args, state.options, state.interactive, want, test.interactive)
+		}
+	}
+
+	invalid := []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"-c"}, "shelly: -c: option requires an argument\n"},
+		{[]string{"-o"}, "shelly: -o: option requires an argument\n"},
+		{[]string{"-o", "nope"}, "shelly: nope: invalid option name\n"},
+		{[]string{"-O", "errexit"}, "shelly: errexit: invalid shell option name\n"},
+	}
+	for _, test := range invalid {
+		withOptions(t)
+		result := callBuiltin(t, func(args []string, outFd, errFd uintptr) int {
+			if _, ok := ParseInvocation(args, errFd); ok {
+				return 0
+			}
+			return 2
+		}, test.args...)
+		if result.status != 2 || result.stderr != test.stderr {
+			t.Errorf("ParseInvocation(%q) = %+v, want stderr %q", test.args, result, test.stderr)
+		}
+	}
+}
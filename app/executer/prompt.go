@@ -0,0 +1,101 @@
+package executer
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"shelly/app/history"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Prompt returns the prompt shown before reading a command: $PS1 with its
+// backslash escapes expanded, or "$ " when PS1 is not set. The escapes are
+// the ones of bash:
+//
+//	\u user name        \h, \H  host name up to the first '.', full
+//	\w, \W  working directory (~ for $HOME), its last component
+//	\$  '#' for root, '$' otherwise     \s  shell name    \!  history number
+//	\t, \T, \@, \A  time (24h, 12h, am/pm, 24h without seconds)  \d  date
+//	\n, \r, \a, \e, \\  newline, carriage return, bell, escape, backslash
+//	\[ \]  around characters that take no room (colour sequences)
+//
+// plus \m, the editing mode: "(ins)" or "(cmd)" with `set -o vi`. It expands
+// to modeIndicator, a placeholder the line editor replaces with the mode and
+// keeps up to date as the mode changes (see lineEditor.ModeIndicator).
+func Prompt(modeIndicator string) string {
+	ps1, ok := LookupVariable("PS1")
+	if !ok {
+		return "$ "
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(ps1); i++ {
+		if ps1[i] != '\\' || i+1 >= len(ps1) {
+			builder.WriteByte(ps1[i])
+			continue
+		}
+		i++
+		switch ps1[i] {
+		case 'u':
+			if current, err := user.Current(); err == nil {
+				builder.WriteString(current.Username)
+			}
+		case 'h', 'H':
+			host, _ := os.Hostname()
+			if ps1[i] == 'h' {
+				host, _, _ = strings.Cut(host, ".")
+			}
+			builder.WriteString(host)
+		case 'w':
+			builder.WriteString(abbreviateHome(currentLogicalDirectory()))
+		case 'W':
+			dir := currentLogicalDirectory()
+			if dir != os.Getenv("HOME") && dir != "/" {
+				dir = filepath.Base(dir)
+			}
+			builder.WriteString(abbreviateHome(dir))
+		case '$':
+			if os.Geteuid() == 0 {
+				builder.WriteByte('#')
+			} else {
+				builder.WriteByte('$')
+			}
+		case 's':
+			builder.WriteString("shelly")
+		case '!':
+			builder.WriteString(strconv.Itoa(history.GetHistoryManager().Len() + 1))
+		case 't':
+			builder.WriteString(time.Now().Format("15:04:05"))
+		case 'T':
+			builder.WriteString(time.Now().Format("03:04:05"))
+		case '@':
+			builder.WriteString(time.Now().Format("03:04 PM"))
+		case 'A':
+			builder.WriteString(time.Now().Format("15:04"))
+		case 'd':
+			builder.WriteString(time.Now().Format("Mon Jan 02"))
+		case 'n':
+			builder.WriteByte('\n')
+		case 'r':
+			builder.WriteByte('\r')
+		case 'a':
+			builder.WriteByte('\a')
+		case 'e':
+			builder.WriteByte('\x1b')
+		case '[':
+			builder.WriteByte('\x01')
+		case ']':
+			builder.WriteByte('\x02')
+		case 'm':
+			builder.WriteString(modeIndicator)
+		case '\\':
+			builder.WriteByte('\\')
+		default:
+			builder.WriteByte('\\')
+			builder.WriteByte(ps1[i])
+		}
+	}
+	return builder.String()
+}
@@ -3,14 +3,59 @@ package executer
 import (
 	"fmt"
 	"os"
+	"shelly/app/commandHash"
 	"shelly/app/history"
 	"shelly/app/syscallHelpers"
+	"strconv"
 	"strings"
 	"unsafe"
 )
 
 var newLineSlice = []byte{'\n'}
 
+// shellBuiltins lists the commands implemented inside the shell itself.
+// "echo" is reported as a builtin by `type` like in bash, even though the
+// system binary does the actual work.
+var shellBuiltins = map[string]struct{}{
+	"echo":     {},
+	"exit":     {},
+	"type":     {},
+	"pwd":      {},
+	"cd":       {},
+	"history":  {},
+	"fc":       {},
+	"return":   {},
+	"trap":     {},
+	"test":     {},
+	"[":        {},
+	"pushd":    {},
+	"popd":     {},
+	"dirs":     {},
+	"set":      {},
+	"shopt":    {},
+	"complete": {},
+	"compgen":  {},
+	"hash":     {},
+}
+
+// shellKeywords are reserved words that start compound commands.
+var shellKeywords = map[string]struct{}{
+	"[[": {},
+	"]]": {},
+}
+
+// isShellBuiltin reports whether name has to be run by the shell instead of
+// being looked up in PATH.
+func isShellBuiltin(name string) bool {
+	if name == "echo" {
+		return false
+	}
+	if _, ok := shellBuiltins[name]; ok {
+		return true
+	}
+	return name == "[["
+}
+
 func handleType(args []string, outFd uintptr) {
 
 	if len(args) != 1 {
@@ -19,9 +64,13 @@ func handleType(args []string, outFd uintptr) {
 
 	arg := args[0]
 
-	//We can then have a hashmap holding this
-	switch arg {
-	case "echo", "exit", "type", "pwd", "cd", "history":
+	if _, ok := shellKeywords[arg]; ok {
+		writeStringToFd(outFd, arg)
+		writeStringToFd(outFd, " is a shell keyword\n")
+		return
+	}
+
+	if _, ok := shellBuiltins[arg]; ok {
 		byteArg := unsafe.Slice(unsafe.StringData(arg), len(arg))
 		syscallHelpers.WriteWithSyscall(int(outFd), byteArg)
 
@@ -32,6 +81,12 @@ func handleType(args []string, outFd uintptr) {
 		return
 	}
 
+	// Like bash, tell when the command is known from the hash table
+	if entry, ok := commandHash.Hashed(arg); ok {
+		writeStringToFd(outFd, arg+" is hashed ("+entry.Path+")\n")
+		return
+	}
+
 	fullPath, _ := findExecutableBinaryInPath(arg)
 	if fullPath != "" {
 		//Simple way to write to either console or file
@@ -56,56 +111,54 @@ func handleType(args []string, outFd uintptr) {
 	syscallHelpers.WriteWithSyscall(int(outFd), byteResponse)
 }
 
-func handlePWD(outFd uintptr) {
-	currentWorkingDirectory, _ := os.Getwd()
-	byteCurrentWorkingDirectory := unsafe.Slice(unsafe.StringData(currentWorkingDirectory), len(currentWorkingDirectory))
-	syscallHelpers.WriteWithSyscall(int(outFd), byteCurrentWorkingDirectory)
-	syscallHelpers.WriteWithSyscall(int(outFd), newLineSlice)
-}
-
-func handleCd(args []string) {
-
-	if len(args) != 1 {
-		return
+// handleExit implements `exit [N]`. N defaults to the status of the last
+// command and is reduced to 0-255 like a real process exit code.
+// It returns the status to exit with and whether the shell should exit: with
+// too many arguments bash reports an error and keeps running.
+//
+// Bash refuses the first exit while jobs are running. This shell has no job
+// control: every pipeline runs in the foreground and is waited for before
+// the next command is read, so no job can still be running when exit runs
+// and there is nothing to warn about.
+func handleExit(args []string, errFd uintptr) (status int, shouldExit bool) {
+	if len(args) == 0 {
+		return state.lastStatus, true
 	}
 
-	path := args[0]
-
-	path = substituteHomeDirectoryCharacter(path)
-
-	err := os.Chdir(path)
+	n, err := strconv.ParseInt(strings.TrimSpace(args[0]), 10, 64)
 	if err != nil {
-		fmt.Printf("cd: %s: No such file or directory\n", path)
+		writeStringToFd(errFd, "exit: "+args[0]+": numeric argument required\n")
+		return 2, true
+	}
+
+	if len(args) > 1 {
+		writeStringToFd(errFd, "exit: too many arguments\n")
+		return 1, false
 	}
+
+	return int(n & 0xFF), true
 }
 
-func handleExit(args []string) bool {
+// handleReturn implements `return`. There are no shell functions or sourced
+// scripts to return from, so like bash at the top level it is an error.
+func handleReturn(args []string, errFd uintptr) int {
+	writeStringToFd(errFd, "return: can only `return' from a function or sourced script\n")
+	return 1
+}
 
-	if len(args) != 1 || args[0] != "0" {
-		return false
-	}
+// ExitShell terminates the shell with the given status after running the EXIT
+// trap and saving the session history to the default history file.
+func ExitShell(status int) {
+	// The EXIT trap sees the exit status as $?
+	state.lastStatus = status & 0xFF
+	runExitTrap()
 
 	//Using "" it defaults to the default history file.
 	history.GetHistoryManager().AppendHistoryToFile("")
-	return true
+	os.Exit(status & 0xFF)
 }
 
-func substituteHomeDirectoryCharacter(path string) string {
-	if path == "~" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return path
-		}
-		return home
-	}
-
-	if strings.HasPrefix(path, "~/") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return path
-		}
-		return home + path[1:] // skip the "~"
-	}
-
-	return path
+// writeStringToFd writes s to fd without copying it into a new byte slice.
+func writeStringToFd(fd uintptr, s string) {
+	syscallHelpers.WriteWithSyscall(int(fd), unsafe.Slice(unsafe.StringData(s), len(s)))
 }
@@ -0,0 +1,34 @@
+package executer
+
+import (
+	"os"
+	"testing"
+)
+
+// builtinResult is what a builtin printed and returned.
+type builtinResult struct {
+	status         int
+	stdout, stderr string
+}
+
+// callBuiltin runs a builtin with files as its stdout and stderr.
+func callBuiltin(t *testing.T, builtin func(args []string, outFd, errFd uintptr) int, args ...string) builtinResult {
+	t.Helper()
+	dir := t.TempDir()
+	stdout, err := os.Create(dir + "/stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	stderr, err := os.Create(dir + "/stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stderr.Close()
+
+	status := builtin(args, stdout.Fd(), stderr.Fd())
+
+	out, _ := os.ReadFile(stdout.Name())
+	errOut, _ := os.ReadFile(stderr.Name())
+	return builtinResult{status: status, stdout: string(out), stderr: string(errOut)}
+}
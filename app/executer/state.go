@@ -0,0 +1,116 @@
+package executer
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// shellState holds everything the shell remembers between commands that is
+// not part of the process environment.
+type shellState struct {
+	lastStatus int                 // exit status of the last pipeline ($?)
+	pipeStatus []int               // status of each command of the last pipeline
+	variables  map[string]string   // shell variables that are not exported
+	arrays     map[string][]string // indexed arrays such as BASH_REMATCH
+	dirStack   []string            // pushd stack below the current directory
+	options    shellOptions        // switches changed with set and shopt
+	// interactive is true when commands are read from the prompt rather than
+	// from -c or a script file.
+	interactive bool
+}
+
+var state = &shellState{
+	variables: make(map[string]string),
+	arrays:    make(map[string][]string),
+	// The prompt uses emacs keybindings until `set -o vi`
+	options: shellOptions{emacs: true},
+}
+
+// LastStatus returns the exit status of the most recently executed pipeline.
+func LastStatus() int {
+	return state.lastStatus
+}
+
+// PipeStatus returns the exit status of every command of the most recently
+// executed pipeline, in pipeline order (the PIPESTATUS array). A single
+// command yields one status.
+func PipeStatus() []int {
+	statuses := make([]int, len(state.pipeStatus))
+	copy(statuses, state.pipeStatus)
+	return statuses
+}
+
+// setPipeStatus records the per-command statuses of a pipeline and mirrors
+// them into the PIPESTATUS array.
+func setPipeStatus(statuses []int) {
+	state.pipeStatus = statuses
+
+	values := make([]string, len(statuses))
+	for i, status := range statuses {
+		values[i] = strconv.Itoa(status)
+	}
+	setArray("PIPESTATUS", values)
+}
+
+// LookupVariable resolves a parameter for expansion. It understands the
+// special parameters $?, $$ and $-, tilde prefixes (names starting with '~',
+// which only come from the lexer, see lexer.BadSubstitution), indexed array
+// elements like NAME[1] (NAME[@] joins every element), shell variables and
+// finally the environment.
+func LookupVariable(name string) (string, bool) {
+	switch name {
+	case "?":
+		return strconv.Itoa(state.lastStatus), true
+	case "$":
+		return strconv.Itoa(os.Getpid()), true
+	case "-":
+		return optionFlags(), true
+	}
+
+	if strings.HasPrefix(name, "~") {
+		return expandTildePrefix(name), true
+	}
+
+	if open := strings.IndexByte(name, '['); open > 0 && strings.HasSuffix(name, "]") {
+		values, ok := state.arrays[name[:open]]
+		if !ok {
+			return "", false
+		}
+
+		subscript := name[open+1 : len(name)-1]
+		if subscript == "@" || subscript == "*" {
+			return strings.Join(values, " "), true
+		}
+
+		idx, err := strconv.Atoi(subscript)
+		if err != nil || idx < 0 || idx >= len(values) {
+			return "", false
+		}
+		return values[idx], true
+	}
+
+	// $NAME on an array refers to its first element
+	if values, ok := state.arrays[name]; ok {
+		if len(values) == 0 {
+			return "", true
+		}
+		return values[0], true
+	}
+
+	if value, ok := state.variables[name]; ok {
+		return value, true
+	}
+
+	return os.LookupEnv(name)
+}
+
+// setArray replaces the contents of a shell array variable.
+func setArray(name string, values []string) {
+	state.arrays[name] = values
+}
+
+// unsetArray removes a shell array variable.
+func unsetArray(name string) {
+	delete(state.arrays, name)
+}
@@ -0,0 +1,401 @@
+package executer
+
+import (
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+)
+
+// Pseudo-signals understood by trap in addition to the real ones.
+const (
+	trapExit   = "EXIT"   // the shell is exiting
+	trapErr    = "ERR"    // a pipeline failed
+	trapDebug  = "DEBUG"  // before each pipeline runs
+	trapReturn = "RETURN" // a function or sourced script returned
+)
+
+// signalNames maps the names trap accepts (without the SIG prefix) to signals.
+var signalNames = map[string]syscall.Signal{
+	"HUP": syscall.SIGHUP, "INT": syscall.SIGINT, "QUIT": syscall.SIGQUIT,
+	"ILL": syscall.SIGILL, "TRAP": syscall.SIGTRAP, "ABRT": syscall.SIGABRT,
+	"BUS": syscall.SIGBUS, "FPE": syscall.SIGFPE, "KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1, "SEGV": syscall.SIGSEGV, "USR2": syscall.SIGUSR2,
+	"PIPE": syscall.SIGPIPE, "ALRM": syscall.SIGALRM, "TERM": syscall.SIGTERM,
+	"STKFLT": syscall.SIGSTKFLT, "CHLD": syscall.SIGCHLD, "CONT": syscall.SIGCONT,
+	"STOP": syscall.SIGSTOP, "TSTP": syscall.SIGTSTP, "TTIN": syscall.SIGTTIN,
+	"TTOU": syscall.SIGTTOU, "URG": syscall.SIGURG, "XCPU": syscall.SIGXCPU,
+	"XFSZ": syscall.SIGXFSZ, "VTALRM": syscall.SIGVTALRM, "PROF": syscall.SIGPROF,
+	"WINCH": syscall.SIGWINCH, "IO": syscall.SIGIO, "PWR": syscall.SIGPWR,
+	"SYS": syscall.SIGSYS,
+}
+
+// exitSignals are the signals that, unless trapped, save the history and
+// terminate the shell:
+// - SIGINT  : Interrupt signal (usually from Ctrl+C)
+// - SIGTERM : Termination signal (polite request to stop, e.g. from `kill`)
+// - SIGHUP  : Hangup signal (sent when terminal closes or service manager restarts the process)
+var exitSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+
+// Highest signal number on Linux, used to size the pending table.
+const maxSignal = 65
+
+// trapTable stores the trap actions. Signals are delivered on a separate
+// goroutine, so the table is guarded by a mutex and a trapped signal is only
+// flagged as pending; the action itself runs later on the main goroutine at a
+// safe point (see runPendingTraps).
+type trapTable struct {
+	mu      sync.Mutex
+	actions map[string]string // signal name (INT, EXIT, ...) -> command; "" means ignore
+	pending [maxSignal]atomic.Bool
+	running bool // a trap action is executing, don't nest ERR/DEBUG traps
+}
+
+var traps = &trapTable{actions: make(map[string]string)}
+
+var signalChannel = make(chan os.Signal, 8)
+
+// signalPipe is written to whenever a signal is flagged as pending, so that
+// the line editor waiting for a key at the prompt wakes up (see SignalFd).
+var signalPipe = [2]int{-1, -1}
+
+// InitSignals installs the shell's signal handling. Until a trap says
+// otherwise, SIGINT, SIGTERM and SIGHUP save the history and exit.
+//
+// Like trapped signals, they are only flagged as pending and the shell exits
+// from the main goroutine at the next safe point (see runPendingTraps): after
+// the running pipeline, or right away when the shell is idle at the prompt
+// (see SignalFd).
+//
+// Children never inherit the handlers: exec resets caught signals to their
+// default disposition, only signals ignored with an empty trap action stay
+// ignored.
+func InitSignals() {
+	if err := syscall.Pipe2(signalPipe[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		signalPipe = [2]int{-1, -1}
+	}
+	signal.Notify(signalChannel, exitSignals...)
+
+	go func() {
+		//Blocks channel until new message
+		for sig := range signalChannel {
+			if sysSig, ok := sig.(syscall.Signal); ok {
+				traps.pending[sysSig].Store(true)
+				if signalPipe[1] >= 0 {
+					// A full pipe already wakes the reader up
+					syscall.Write(signalPipe[1], []byte{0})
+				}
+			}
+		}
+	}()
+}
+
+// SignalFd returns a file descriptor that becomes readable when a signal is
+// caught, or -1 before InitSignals. The line editor watches it along with
+// the terminal and calls RunPendingTraps when it is readable, so that traps
+// run and exit signals exit while the shell is idle at the prompt.
+func SignalFd() int {
+	return signalPipe[0]
+}
+
+// RunPendingTraps handles the signals caught since the last command, see
+// runPendingTraps. It is meant for the line editor, which calls it from the
+// main goroutine while it waits for a key.
+func RunPendingTraps() {
+	runPendingTraps()
+}
+
+// handleTrap implements the trap builtin:
+//
+//	trap                  list the traps (same as trap -p)
+//	trap -p [SIG...]      list the given traps in a reusable form
+//	trap -l               list the signal names and numbers
+//	trap 'cmd' SIG...     run cmd when SIG arrives (or EXIT/ERR/DEBUG/RETURN happens)
+//	trap '' SIG...        ignore SIG
+//	trap - SIG...         restore the default disposition (so does `trap SIG`)
+func handleTrap(args []string, outFd, errFd uintptr) int {
+	if len(args) > 0 && args[0] == "--" {
+		args = args[1:]
+	} else if len(args) > 0 && args[0] == "-l" {
+		printSignalList(outFd)
+		return 0
+	} else if len(args) > 0 && args[0] == "-p" {
+		return printTraps(args[1:], outFd, errFd)
+	}
+
+	if len(args) == 0 {
+		return printTraps(nil, outFd, errFd)
+	}
+
+	action := args[0]
+	specs := args[1:]
+	reset := action == "-"
+
+	// `trap SIG` with a single signal resets it
+	if len(args) == 1 {
+		if _, ok := parseSignalSpec(action); ok {
+			reset = true
+			specs = args
+		}
+	}
+
+	if len(specs) == 0 {
+		writeStringToFd(errFd, "trap: usage: trap [-lp] [[action] signal_spec ...]\n")
+		return 2
+	}
+
+	status := 0
+	for _, spec := range specs {
+		name, ok := parseSignalSpec(spec)
+		if !ok {
+			writeStringToFd(errFd, "trap: "+spec+": invalid signal specification\n")
+			status = 1
+			continue
+		}
+
+		if reset {
+			resetTrap(name)
+		} else {
+			setTrap(name, action)
+		}
+	}
+
+	return status
+}
+
+func setTrap(name, action string) {
+	traps.mu.Lock()
+	traps.actions[name] = action
+	traps.mu.Unlock()
+
+	sig, isSignal := signalNames[name]
+	if !isSignal {
+		return
+	}
+
+	if action == "" {
+		signal.Ignore(sig)
+		return
+	}
+	signal.Notify(signalChannel, sig)
+}
+
+func resetTrap(name string) {
+	traps.mu.Lock()
+	delete(traps.actions, name)
+	traps.mu.Unlock()
+
+	sig, isSignal := signalNames[name]
+	if !isSignal {
+		return
+	}
+
+	signal.Reset(sig)
+	if isExitSignal(sig) {
+		// Back to the shell's own default: save history and exit
+		signal.Notify(signalChannel, sig)
+	}
+}
+
+// runPendingTraps runs the action of every trapped signal received since the
+// last call, and exits for an exit signal that isn't trapped (any more). It
+// must only be called from the main goroutine between commands.
+func runPendingTraps() {
+	// Empty the pipe first: a signal caught from now on wakes the editor again
+	if signalPipe[0] >= 0 {
+		var buffer [64]byte
+		for {
+			if n, _ := syscall.Read(signalPipe[0], buffer[:]); n <= 0 {
+				break
+			}
+		}
+	}
+
+	for sig := 1; sig < maxSignal; sig++ {
+		if !traps.pending[sig].Swap(false) {
+			continue
+		}
+
+		name := signalName(syscall.Signal(sig))
+		traps.mu.Lock()
+		_, trapped := traps.actions[name]
+		traps.mu.Unlock()
+
+		if trapped {
+			runTrap(name)
+		} else if isExitSignal(syscall.Signal(sig)) {
+			// Default disposition of the exit signals
+			ExitShell(128 + sig)
+		}
+	}
+}
+
+func isExitSignal(sig syscall.Signal) bool {
+	for _, exitSig := range exitSignals {
+		if exitSig == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// runTrap runs the action registered for name, if any. $? and PIPESTATUS are
+// preserved so the trap doesn't change what the interrupted code sees.
+func runTrap(name string) {
+	traps.mu.Lock()
+	action, ok := traps.actions[name]
+	nested := traps.running
+	traps.mu.Unlock()
+
+	if !ok || action == "" || (nested && name != trapExit) {
+		return
+	}
+
+	traps.mu.Lock()
+	traps.running = true
+	traps.mu.Unlock()
+
+	savedStatus, savedPipeStatus := state.lastStatus, state.pipeStatus
+	RunString(action)
+	state.lastStatus = savedStatus
+	setPipeStatus(savedPipeStatus)
+
+	traps.mu.Lock()
+	traps.running = nested
+	traps.mu.Unlock()
+}
+
+// runExitTrap runs the EXIT trap once; it is removed first so that an `exit`
+// inside the trap doesn't run it again.
+func runExitTrap() {
+	traps.mu.Lock()
+	action, ok := traps.actions[trapExit]
+	delete(traps.actions, trapExit)
+	traps.mu.Unlock()
+
+	if ok && action != "" {
+		RunString(action)
+	}
+}
+
+// parseSignalSpec turns a signal name (with or without SIG, any case), a
+// signal number or a pseudo-signal into the name used as trap key.
+func parseSignalSpec(spec string) (string, bool) {
+	if n, err := strconv.Atoi(spec); err == nil {
+		if n == 0 {
+			return trapExit, true
+		}
+		if n > 0 && n < maxSignal {
+			name := signalName(syscall.Signal(n))
+			_, known := signalNames[name]
+			return name, known
+		}
+		return "", false
+	}
+
+	name := strings.TrimPrefix(strings.ToUpper(spec), "SIG")
+	switch name {
+	case trapExit, trapErr, trapDebug, trapReturn:
+		return name, true
+	}
+
+	_, ok := signalNames[name]
+	return name, ok
+}
+
+// signalName returns the trap name of sig, e.g. "INT" for SIGINT.
+func signalName(sig syscall.Signal) string {
+	for name, s := range signalNames {
+		if s == sig {
+			return name
+		}
+	}
+	return strconv.Itoa(int(sig))
+}
+
+// printTraps writes `trap -- 'action' SIGNAME` lines for the given specs, or
+// for every trap when specs is empty.
+func printTraps(specs []string, outFd, errFd uintptr) int {
+	traps.mu.Lock()
+	defer traps.mu.Unlock()
+
+	var names []string
+	status := 0
+	if len(specs) == 0 {
+		for name := range traps.actions {
+			names = append(names, name)
+		}
+		sort.Slice(names, func(i, j int) bool { return trapOrder(names[i]) < trapOrder(names[j]) })
+	} else {
+		for _, spec := range specs {
+			name, ok := parseSignalSpec(spec)
+			if !ok {
+				writeStringToFd(errFd, "trap: "+spec+": invalid signal specification\n")
+				status = 1
+				continue
+			}
+			names = append(names, name)
+		}
+	}
+
+	var builder strings.Builder
+	for _, name := range names {
+		action, ok := traps.actions[name]
+		if !ok {
+			continue
+		}
+
+		builder.WriteString("trap -- ")
+		builder.WriteString(singleQuote(action))
+		builder.WriteByte(' ')
+		if _, isSignal := signalNames[name]; isSignal {
+			builder.WriteString("SIG")
+		}
+		builder.WriteString(name)
+		builder.WriteByte('\n')
+	}
+	writeStringToFd(outFd, builder.String())
+
+	return status
+}
+
+// trapOrder sorts EXIT first, then real signals by number, then the other
+// pseudo-signals, which is the order bash lists them in.
+func trapOrder(name string) int {
+	if name == trapExit {
+		return 0
+	}
+	if sig, ok := signalNames[name]; ok {
+		return int(sig)
+	}
+	return maxSignal + len(name)
+}
+
+func printSignalList(outFd uintptr) {
+	names := make([]string, 0, len(signalNames))
+	for name := range signalNames {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return signalNames[names[i]] < signalNames[names[j]] })
+
+	var builder strings.Builder
+	for i, name := range names {
+		entry := strconv.Itoa(int(signalNames[name])) + ") SIG" + name
+		builder.WriteString(entry)
+		if (i+1)%5 == 0 || i == len(names)-1 {
+			builder.WriteByte('\n')
+		} else {
+			builder.WriteString(strings.Repeat(" ", max(1, 16-len(entry))))
+		}
+	}
+	writeStringToFd(outFd, builder.String())
+}
+
+// singleQuote quotes s so the shell reads it back as the same single word.
+func singleQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,140 @@
+package executer
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// withTraps gives a test its own trap table.
+func withTraps(t *testing.T) {
+	t.Helper()
+	saved := traps.actions
+	traps.actions = make(map[string]string)
+	t.Cleanup(func() {
+		for name := range traps.actions {
+			resetTrap(name)
+		}
+		traps.actions = saved
+	})
+}
+
+func TestParseSignalSpec(t *testing.T) {
+	tests := []struct {
+		spec, want string
+		ok         bool
+	}{
+		{"INT", "INT", true},
+		{"SIGINT", "INT", true},
+		{"sigterm", "TERM", true},
+		{"usr1", "USR1", true},
+		{"2", "INT", true},
+		{"15", "TERM", true},
+		{"0", "EXIT", true},
+		{"exit", "EXIT", true},
+		{"ERR", "ERR", true},
+		{"DEBUG", "DEBUG", true},
+		{"RETURN", "RETURN", true},
+		{"NOPE", "NOPE", false},
+		{"SIGEXIT", "EXIT", true},
+		{"99", "", false},
+		{"-1", "", false},
+	}
+	for _, test := range tests {
+		got, ok := parseSignalSpec(test.spec)
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("parseSignalSpec(%q) = %q, %v, want %q, %v", test.spec, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestTrapSetPrintReset(t *testing.T) {
+	withTraps(t)
+
+	if result := callBuiltin(t, handleTrap, "echo it's", "USR1", "EXIT", "ERR"); result.status != 0 {
+		t.Fatalf("trap = %+v", result)
+	}
+	callBuiltin(t, handleTrap, "", "2")
+
+	// EXIT first, then the signals by number, then the other pseudo-signals
+	want := "trap -- 'echo it'\\''s' EXIT\n" +
+		"trap -- '' SIGINT\n" +
+		"trap -- 'echo it'\\''s' SIGUSR1\n" +
+		"trap -- 'echo it'\\''s' ERR\n"
+	if result := callBuiltin(t, handleTrap); result.stdout != want {
+		t.Errorf("trap printed %q, want %q", result.stdout, want)
+	}
+	if result := callBuiltin(t, handleTrap, "-p", "int", "TERM"); result.stdout != "trap -- '' SIGINT\n" {
+		t.Errorf("trap -p int TERM printed %q", result.stdout)
+	}
+
+	// `trap - SIG` and `trap SIG` both reset
+	callBuiltin(t, handleTrap, "-", "ERR", "EXIT")
+	callBuiltin(t, handleTrap, "SIGINT")
+	if result := callBuiltin(t, handleTrap); result.stdout != "trap -- 'echo it'\\''s' SIGUSR1\n" {
+		t.Errorf("after resetting, trap printed %q", result.stdout)
+	}
+
+	result := callBuiltin(t, handleTrap, "true", "USR2", "NOPE")
+	if result.status != 1 || result.stderr != "trap: NOPE: invalid signal specification\n" {
+		t.Errorf("trap true USR2 NOPE = %+v", result)
+	}
+	if _, ok := traps.actions["USR2"]; !ok {
+		t.Errorf("the valid USR2 spec wasn't trapped")
+	}
+	if result := callBuiltin(t, handleTrap, "true"); result.status != 2 {
+		t.Errorf("trap true = %+v, want status 2", result)
+	}
+}
+
+func TestTrapList(t *testing.T) {
+	result := callBuiltin(t, handleTrap, "-l")
+	if result.status != 0 || !strings.HasPrefix(result.stdout, "1) SIGHUP") || !strings.Contains(result.stdout, "15) SIGTERM") {
+		t.Errorf("trap -l = %+v", result)
+	}
+}
+
+func TestRunPendingTraps(t *testing.T) {
+	withTraps(t)
+	output := filepath.Join(t.TempDir(), "output")
+	callBuiltin(t, handleTrap, "echo $? caught >> "+output, "USR1")
+
+	// The editor is woken up through the pipe, which the traps empty
+	var pipe [2]int
+	if err := syscall.Pipe2(pipe[:], syscall.O_CLOEXEC|syscall.O_NONBLOCK); err != nil {
+		t.Fatal(err)
+	}
+	saved := signalPipe
+	signalPipe = pipe
+	t.Cleanup(func() {
+		syscall.Close(pipe[0])
+		syscall.Close(pipe[1])
+		signalPipe = saved
+	})
+	syscall.Write(pipe[1], []byte{0, 0})
+
+	state.lastStatus = 3
+	traps.pending[syscall.SIGUSR1].Store(true)
+	runPendingTraps()
+
+	if content, _ := os.ReadFile(output); string(content) != "3 caught\n" {
+		t.Errorf("the trap wrote %q, want %q", content, "3 caught\n")
+	}
+	if state.lastStatus != 3 {
+		t.Errorf("$? after the trap = %d, want 3", state.lastStatus)
+	}
+	if traps.pending[syscall.SIGUSR1].Load() {
+		t.Errorf("SIGUSR1 is still pending")
+	}
+	if n, _ := syscall.Read(pipe[0], make([]byte, 1)); n > 0 {
+		t.Errorf("the signal pipe wasn't emptied")
+	}
+
+	// Nothing pending, nothing runs
+	runPendingTraps()
+	if content, _ := os.ReadFile(output); string(content) != "3 caught\n" {
+		t.Errorf("the trap ran again: %q", content)
+	}
+}
@@ -0,0 +1,220 @@
+// Package highlight colours a command line while it is typed, so mistakes
+// show before Enter is pressed. The line is lexed again with the shell's own
+// lexer on every keystroke: command names are green when they resolve (a
+// keyword, a builtin or an executable in PATH) and red otherwise, and strings,
+// redirections, operators and unterminated quotes get their own colour.
+//
+// The colours come from the SHELLY_HIGHLIGHT variable, a list of name=SGR
+// pairs separated by ':' like LS_COLORS, e.g.
+//
+//	SHELLY_HIGHLIGHT='command=1;32:string=36:redirect='
+//
+// The names are those of the Style constants. An empty value leaves that
+// kind of text uncoloured, and SHELLY_HIGHLIGHT=off turns highlighting off.
+package highlight
+
+import (
+	"shelly/app/parser/lexer"
+	"shelly/app/parser/token"
+	"strings"
+)
+
+// Style is the kind of a piece of the command line.
+type Style string
+
+const (
+	StyleCommand      Style = "command"      // a command name that resolves
+	StyleError        Style = "error"        // a command name that doesn't
+	StyleString       Style = "string"       // quoted text
+	StyleRedirect     Style = "redirect"     // >, 2>, >> and their file
+	StyleOperator     Style = "operator"     // |, ||, && and ;
+	StyleUnterminated Style = "unterminated" // a quote left open
+)
+
+// defaultColors are the SGR parameters of each style.
+var defaultColors = map[Style]string{
+	StyleCommand:      "32",
+	StyleError:        "31",
+	StyleString:       "33",
+	StyleRedirect:     "35",
+	StyleOperator:     "36",
+	StyleUnterminated: "1;31",
+}
+
+// Span colours line[Start:End] (byte offsets) with the SGR parameters Color,
+// e.g. "1;32".
+type Span struct {
+	Start, End int
+	Color      string
+}
+
+// Highlighter colours command lines.
+type Highlighter struct {
+	// CommandExists reports whether a command name resolves.
+	CommandExists func(name string) bool
+	// Lookup resolves the parameters of command names (e.g. `$EDITOR file`)
+	// and SHELLY_HIGHLIGHT.
+	Lookup lexer.VariableLookup
+}
+
+// Highlight returns the coloured spans of line, in order and without
+// overlaps. The text outside of them keeps the terminal's colour.
+func (h Highlighter) Highlight(line string) []Span {
+	colors, ok := h.colors()
+	if !ok {
+		return nil
+	}
+
+	styles := make([]Style, len(line))
+	paint := func(start, end int, style Style) {
+		for i := start; i < end; i++ {
+			styles[i] = style
+		}
+	}
+
+	lex := lexer.NewExpandingLexer(line)
+	commandPosition := true
+	redirectTarget := false
+	conditional := false
+	for {
+		tok := lex.NextToken()
+		if tok.Type == token.TokenEOF {
+			break
+		}
+
+		switch tok.Type {
+		case token.TokenPipe, token.TokenOr, token.TokenAnd, token.TokenSemicolon:
+			paint(tok.Start, tok.End, StyleOperator)
+			// '&&' and '||' combine expressions inside [[ ]]
+			if !conditional || tok.Type == token.TokenPipe || tok.Type == token.TokenSemicolon {
+				commandPosition, conditional = true, false
+			}
+			redirectTarget = false
+			continue
+		case token.TokenRedirectOut, token.TokenRedirectErr,
+			token.TokenAppendRedirectOut, token.TokenAppendRedirectErr:
+			// '>' compares strings inside [[ ]]
+			if !conditional {
+				paint(tok.Start, tok.End, StyleRedirect)
+				redirectTarget = true
+			}
+			continue
+		}
+
+		word := line[tok.Start:tok.End]
+		switch {
+		case redirectTarget:
+			paint(tok.Start, tok.End, StyleRedirect)
+			redirectTarget = false
+		case commandPosition:
+			name := lexer.ExpandWord(tok.Value, h.Lookup)
+			if name != "" && h.CommandExists(name) {
+				paint(tok.Start, tok.End, StyleCommand)
+			} else {
+				paint(tok.Start, tok.End, StyleError)
+			}
+			commandPosition = false
+			conditional = word == "[[" && !tok.Quoted
+		default:
+			if conditional && word == "]]" {
+				conditional = false
+			}
+		}
+		paintQuotes(word, styles[tok.Start:tok.End])
+	}
+
+	return spans(styles, colors)
+}
+
+// paintQuotes colours the quoted parts of word, quotes included, unless the
+// word already has a colour (e.g. a command name). The rest of the word after
+// a quote that isn't closed is unterminated whatever the word is.
+func paintQuotes(word string, styles []Style) {
+	for i := 0; i < len(word); i++ {
+		switch word[i] {
+		case '\\':
+			i++
+		case '\'', '"':
+			end := closingQuote(word, i)
+			style := StyleString
+			if end < 0 {
+				end, style = len(word)-1, StyleUnterminated
+			}
+			for j := i; j <= end; j++ {
+				if styles[j] == "" || style == StyleUnterminated {
+					styles[j] = style
+				}
+			}
+			i = end
+		}
+	}
+}
+
+// closingQuote returns the index of the quote closing the one at word[open],
+// or -1. Backslashes escape characters inside double quotes only.
+func closingQuote(word string, open int) int {
+	quote := word[open]
+	for i := open + 1; i < len(word); i++ {
+		switch {
+		case word[i] == '\\' && quote == '"':
+			i++
+		case word[i] == quote:
+			return i
+		}
+	}
+	return -1
+}
+
+// spans merges the runs of bytes of the same style into spans coloured with
+// colors. Uncoloured styles are left out.
+func spans(styles []Style, colors map[Style]string) []Span {
+	var result []Span
+	for start := 0; start < len(styles); {
+		end := start + 1
+		for end < len(styles) && styles[end] == styles[start] {
+			end++
+		}
+		if color := colors[styles[start]]; color != "" {
+			result = append(result, Span{Start: start, End: end, Color: color})
+		}
+		start = end
+	}
+	return result
+}
+
+// colors returns the colour of each style: the defaults updated with
+// SHELLY_HIGHLIGHT. ok is false when highlighting is turned off. Malformed
+// pairs are ignored.
+func (h Highlighter) colors() (colors map[Style]string, ok bool) {
+	setting, _ := h.Lookup("SHELLY_HIGHLIGHT")
+	if setting == "" {
+		return defaultColors, true
+	}
+	if setting == "off" {
+		return nil, false
+	}
+
+	colors = make(map[Style]string, len(defaultColors))
+	for style, color := range defaultColors {
+		colors[style] = color
+	}
+	for _, pair := range strings.Split(setting, ":") {
+		name, color, found := strings.Cut(pair, "=")
+		if _, known := defaultColors[Style(name)]; !found || !known || !isSGR(color) {
+			continue
+		}
+		colors[Style(name)] = color
+	}
+	return colors, true
+}
+
+// isSGR reports whether color is made of SGR parameters only, so it can't
+// inject other escape sequences.
+func isSGR(color string) bool {
+	for i := 0; i < len(color); i++ {
+		if (color[i] < '0' || color[i] > '9') && color[i] != ';' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,524 @@
+package history
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expansion is the result of history expansion on one input line.
+type Expansion struct {
+	Line      string // the line with every history reference replaced
+	Changed   bool   // the line contained history references; bash echoes it
+	PrintOnly bool   // a :p modifier asked to print the line instead of running it
+}
+
+// Expander performs bash-style history expansion. It remembers the last
+// substitution and search so `:&`, `:s//new/` and `%` can refer to them.
+//
+// Supported syntax:
+//   - events:      !! (previous), !n, !-n, !prefix, !?text[?], !# (the line so far)
+//   - quick subst: ^old^new[^] at the start of the line, same as !!:s/old/new/
+//   - words:       :0 :n :^ :$ :% :x-y :x- :-y :* :x* (the ':' can be dropped
+//     before ^ $ * - %, e.g. !$)
+//   - modifiers:   :h :t :r :e :p :q :s/old/new/ :gs/old/new/ :& :g&
+//
+// Nothing is expanded inside single quotes or after a backslash, and a '!'
+// followed by a blank, '=', '(' or the end of the line is kept literally.
+type Expander struct {
+	lastOld    string // last substitution, for :& and an empty old text
+	lastNew    string
+	lastSearch string // text of the last !?text? search, for an empty old text
+}
+
+// historyEvent is the line an event designator selected.
+type historyEvent struct {
+	line    string
+	words   []string
+	matched int // word index found by a !?text? search, -1 otherwise
+}
+
+// Expand performs history expansion on line. events are the history lines,
+// oldest first; event n is events[n-1].
+func (e *Expander) Expand(line string, events []string) (Expansion, error) {
+	if !strings.ContainsAny(line, "!^") {
+		return Expansion{Line: line}, nil
+	}
+
+	var result Expansion
+	var builder strings.Builder
+
+	start := 0
+	if strings.HasPrefix(line, "^") {
+		// ^old^new^ is a shortcut for !!:s^old^new^
+		event, err := e.previousEvent(events)
+		if err != nil {
+			return result, err
+		}
+		text, end, err := e.applyModifiers(event.line, ":s"+line, 0, &result)
+		if err != nil {
+			return result, err
+		}
+		builder.WriteString(text)
+		result.Changed = true
+		start = end - len(":s")
+	}
+
+	inSingle, inDouble := false, false
+	for i := start; i < len(line); i++ {
+		ch := line[i]
+
+		switch {
+		case ch == '\\' && !inSingle && i+1 < len(line):
+			builder.WriteByte(ch)
+			builder.WriteByte(line[i+1])
+			i++
+			continue
+		case ch == '\'' && !inDouble:
+			inSingle = !inSingle
+		case ch == '"' && !inSingle:
+			inDouble = !inDouble
+		}
+
+		if ch != '!' || inSingle || !startsReference(line, i, inDouble) {
+			builder.WriteByte(ch)
+			continue
+		}
+
+		text, end, err := e.expandReference(line, i, builder.String(), events, &result)
+		if err != nil {
+			return Expansion{}, err
+		}
+		builder.WriteString(text)
+		result.Changed = true
+		i = end - 1
+	}
+
+	result.Line = builder.String()
+	return result, nil
+}
+
+// startsReference reports whether the '!' at line[i] starts a history reference.
+func startsReference(line string, i int, inDouble bool) bool {
+	if i+1 >= len(line) {
+		return false
+	}
+	switch line[i+1] {
+	case ' ', '\t', '\n', '=', '(':
+		return false
+	case '"':
+		return !inDouble
+	}
+	return true
+}
+
+// expandReference expands the reference starting with the '!' at line[i].
+// soFar is the expanded text before it (for !#). It returns the replacement
+// and the index right after the reference.
+func (e *Expander) expandReference(line string, i int, soFar string, events []string, result *Expansion) (string, int, error) {
+	event, end, err := e.parseEvent(line, i, soFar, events)
+	if err != nil {
+		return "", 0, err
+	}
+
+	text := event.line
+	if end < len(line) && isWordDesignatorStart(line, end) {
+		if line[end] == ':' {
+			end++
+		}
+		var words []string
+		words, end, err = e.selectWords(event, line, end)
+		if err != nil {
+			return "", 0, err
+		}
+		text = strings.Join(words, " ")
+	}
+
+	return e.applyModifiers(text, line, end, result)
+}
+
+// parseEvent reads the event designator after the '!' at line[i] and returns
+// the selected event with the index right after the designator.
+func (e *Expander) parseEvent(line string, i int, soFar string, events []string) (historyEvent, int, error) {
+	pos := i + 1
+	ch := line[pos]
+
+	switch {
+	case ch == '!':
+		event, err := e.previousEvent(events)
+		return event, pos + 1, err
+
+	case ch == '#':
+		return newEvent(soFar), pos + 1, nil
+
+	case ch == ':' || ch == '^' || ch == '$' || ch == '*' || ch == '%':
+		// A word designator alone refers to the previous command
+		event, err := e.previousEvent(events)
+		return event, pos, err
+
+	case ch == '-' || isDigit(ch):
+		end := pos + 1
+		for end < len(line) && isDigit(line[end]) {
+			end++
+		}
+		spec := line[pos:end]
+		n, err := strconv.Atoi(spec)
+		if err != nil {
+			return historyEvent{}, 0, fmt.Errorf("!%s: event not found", spec)
+		}
+		if n < 0 {
+			n = len(events) + 1 + n
+		}
+		if n < 1 || n > len(events) {
+			return historyEvent{}, 0, fmt.Errorf("!%s: event not found", spec)
+		}
+		return newEvent(events[n-1]), end, nil
+
+	case ch == '?':
+		end := strings.IndexByte(line[pos+1:], '?')
+		search := line[pos+1:]
+		next := len(line)
+		if end >= 0 {
+			search = line[pos+1 : pos+1+end]
+			next = pos + end + 2
+		}
+		if search == "" {
+			search = e.lastSearch
+		}
+		for n := len(events) - 1; n >= 0 && search != ""; n-- {
+			if strings.Contains(events[n], search) {
+				e.lastSearch = search
+				event := newEvent(events[n])
+				for w, word := range event.words {
+					if strings.Contains(word, search) {
+						event.matched = w
+						break
+					}
+				}
+				return event, next, nil
+			}
+		}
+		return historyEvent{}, 0, fmt.Errorf("!?%s: event not found", search)
+	}
+
+	// !prefix: the most recent command starting with prefix
+	end := pos
+	for end < len(line) && !isEventTerminator(line[end]) {
+		end++
+	}
+	prefix := line[pos:end]
+	for n := len(events) - 1; n >= 0; n-- {
+		if strings.HasPrefix(events[n], prefix) {
+			return newEvent(events[n]), end, nil
+		}
+	}
+	return historyEvent{}, 0, fmt.Errorf("!%s: event not found", prefix)
+}
+
+func (e *Expander) previousEvent(events []string) (historyEvent, error) {
+	if len(events) == 0 {
+		return historyEvent{}, fmt.Errorf("!!: event not found")
+	}
+	return newEvent(events[len(events)-1]), nil
+}
+
+func newEvent(line string) historyEvent {
+	return historyEvent{line: line, words: splitWords(line), matched: -1}
+}
+
+// isWordDesignatorStart reports whether a word designator starts at line[i].
+func isWordDesignatorStart(line string, i int) bool {
+	switch line[i] {
+	case '^', '$', '*', '-', '%':
+		return true
+	case ':':
+		if i+1 >= len(line) {
+			return false
+		}
+		next := line[i+1]
+		return isDigit(next) || next == '^' || next == '$' || next == '*' || next == '-' || next == '%'
+	}
+	return false
+}
+
+// selectWords applies the word designator at line[pos] (after the optional
+// ':') and returns the selected words and the index after the designator.
+func (e *Expander) selectWords(event historyEvent, line string, pos int) ([]string, int, error) {
+	last := len(event.words) - 1
+	start := pos
+
+	// readBound reads one of n, ^, $ or % and returns the word index
+	readBound := func() (int, bool) {
+		if pos >= len(line) {
+			return 0, false
+		}
+		switch ch := line[pos]; {
+		case ch == '^':
+			pos++
+			return 1, true
+		case ch == '$':
+			pos++
+			return last, true
+		case ch == '%':
+			pos++
+			return event.matched, event.matched >= 0
+		case isDigit(ch):
+			end := pos
+			for end < len(line) && isDigit(line[end]) {
+				end++
+			}
+			n, _ := strconv.Atoi(line[pos:end])
+			pos = end
+			return n, true
+		}
+		return 0, false
+	}
+
+	badSpecifier := func() ([]string, int, error) {
+		end := pos
+		for end < len(line) && !isEventTerminator(line[end]) && line[end] != ':' {
+			end++
+		}
+		return nil, 0, fmt.Errorf(":%s: bad word specifier", line[start:max(end, pos)])
+	}
+
+	if line[pos] == '*' {
+		pos++
+		if last < 1 {
+			return nil, pos, nil
+		}
+		return event.words[1:], pos, nil
+	}
+
+	from, to := 0, 0
+	if line[pos] == '-' {
+		// -y is 0-y
+		pos++
+		var ok bool
+		if to, ok = readBound(); !ok {
+			return badSpecifier()
+		}
+	} else {
+		var ok bool
+		if from, ok = readBound(); !ok {
+			return badSpecifier()
+		}
+		to = from
+
+		if pos < len(line) && line[pos] == '*' {
+			// x* is x-$
+			pos++
+			to = last
+			if from > last {
+				return nil, pos, nil
+			}
+		} else if pos < len(line) && line[pos] == '-' {
+			pos++
+			if to, ok = readBound(); !ok {
+				// x- is x up to the word before the last one
+				to = last - 1
+			}
+		}
+	}
+
+	if from < 0 || to > last || from > to+1 || from > last {
+		return badSpecifier()
+	}
+	if from > to {
+		return nil, pos, nil
+	}
+	return event.words[from : to+1], pos, nil
+}
+
+// applyModifiers applies the :modifiers found at rest[pos] to text. It
+// returns the modified text and the index right after the modifiers.
+func (e *Expander) applyModifiers(text string, rest string, pos int, result *Expansion) (string, int, error) {
+	for pos+1 < len(rest) && rest[pos] == ':' {
+		modifier := rest[pos+1]
+		global := false
+		if modifier == 'g' || modifier == 'a' {
+			if pos+2 >= len(rest) || (rest[pos+2] != 's' && rest[pos+2] != '&') {
+				return "", 0, fmt.Errorf(":%c: unrecognized history modifier", modifier)
+			}
+			global = true
+			pos++
+			modifier = rest[pos+1]
+		}
+
+		switch modifier {
+		case 'h':
+			if slash := strings.LastIndexByte(text, '/'); slash > 0 {
+				text = text[:slash]
+			} else if slash == 0 {
+				text = "/"
+			}
+		case 't':
+			text = text[strings.LastIndexByte(text, '/')+1:]
+		case 'r':
+			if dot := strings.LastIndexByte(text, '.'); dot > strings.LastIndexByte(text, '/') {
+				text = text[:dot]
+			}
+		case 'e':
+			if dot := strings.LastIndexByte(text, '.'); dot > strings.LastIndexByte(text, '/') {
+				text = text[dot:]
+			} else {
+				text = ""
+			}
+		case 'p':
+			result.PrintOnly = true
+		case 'q':
+			text = "'" + strings.ReplaceAll(text, "'", `'\''`) + "'"
+		case 's', '&':
+			end := pos + 2
+			if modifier == 's' {
+				var err error
+				end, err = e.parseSubstitution(rest, pos+2)
+				if err != nil {
+					return "", 0, err
+				}
+			} else if e.lastOld == "" {
+				return "", 0, fmt.Errorf(":&: no previous substitution")
+			}
+
+			if !strings.Contains(text, e.lastOld) {
+				return "", 0, fmt.Errorf("%s: substitution failed", rest[pos:end])
+			}
+			replacement := substitutionText(e.lastNew, e.lastOld)
+			if global {
+				text = strings.ReplaceAll(text, e.lastOld, replacement)
+			} else {
+				text = strings.Replace(text, e.lastOld, replacement, 1)
+			}
+			pos = end
+			continue
+		default:
+			return "", 0, fmt.Errorf(":%c: unrecognized history modifier", modifier)
+		}
+		pos += 2
+	}
+
+	return text, pos, nil
+}
+
+// parseSubstitution reads `/old/new/` starting at rest[pos] (any character
+// can be the delimiter) and remembers it as the last substitution. It returns
+// the index after the closing delimiter, which may be omitted at the end.
+func (e *Expander) parseSubstitution(rest string, pos int) (int, error) {
+	if pos >= len(rest) {
+		return 0, fmt.Errorf(":s: no previous substitution")
+	}
+	delimiter := rest[pos]
+	pos++
+
+	readPart := func() string {
+		var part strings.Builder
+		for pos < len(rest) && rest[pos] != delimiter {
+			if rest[pos] == '\\' && pos+1 < len(rest) && rest[pos+1] == delimiter {
+				pos++
+			}
+			part.WriteByte(rest[pos])
+			pos++
+		}
+		pos++ // the delimiter, if any
+		return part.String()
+	}
+
+	old := readPart()
+	replacement := readPart()
+	pos = min(pos, len(rest))
+
+	if old == "" {
+		old = e.lastOld
+		if old == "" {
+			old = e.lastSearch
+		}
+		if old == "" {
+			return 0, fmt.Errorf(":s: no previous substitution")
+		}
+	}
+
+	e.lastOld, e.lastNew = old, replacement
+	return pos, nil
+}
+
+// substitutionText replaces every unescaped '&' in replacement with old.
+func substitutionText(replacement, old string) string {
+	if !strings.Contains(replacement, "&") {
+		return replacement
+	}
+	var builder strings.Builder
+	for i := 0; i < len(replacement); i++ {
+		switch {
+		case replacement[i] == '\\' && i+1 < len(replacement) && replacement[i+1] == '&':
+			builder.WriteByte('&')
+			i++
+		case replacement[i] == '&':
+			builder.WriteString(old)
+		default:
+			builder.WriteByte(replacement[i])
+		}
+	}
+	return builder.String()
+}
+
+// splitWords splits a history line into words the way word designators count
+// them: quoted text stays in one word and the operators | & ; < > ( ) are
+// words on their own.
+func splitWords(line string) []string {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	flush := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			flush()
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(line[i+1:], ch)
+			if end < 0 {
+				end = len(line) - i - 1
+			} else {
+				end++
+			}
+			word.WriteString(line[i : i+end+1])
+			inWord = true
+			i += end
+		case ch == '\\' && i+1 < len(line):
+			word.WriteString(line[i : i+2])
+			inWord = true
+			i++
+		case strings.IndexByte("|&;<>()", ch) >= 0:
+			flush()
+			end := i + 1
+			for end < len(line) && end < i+2 && line[end] == ch {
+				end++
+			}
+			words = append(words, line[i:end])
+			i = end - 1
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	flush()
+
+	return words
+}
+
+// isEventTerminator reports whether ch ends a !prefix event designator.
+func isEventTerminator(ch byte) bool {
+	return strings.IndexByte(" \t\n:;&|<>()'\"", ch) >= 0
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
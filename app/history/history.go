@@ -1,40 +1,85 @@
 package history
 
-/*
-#cgo LDFLAGS: -lreadline
-#include <stdlib.h>
-#include <stdio.h>
-#include <readline/readline.h>
-#include <readline/history.h>
-#include "../readline_helper.h"
-*/
-import "C"
-
 import (
-	"fmt"
+	"crypto/rand"
+	"encoding/hex"
 	"os"
+	"shelly/app/history/store"
+	"shelly/app/pattern"
 	"shelly/app/syscallHelpers"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"syscall"
-	"unsafe"
+	"time"
 )
 
-// HistoryManager is a singleton controlling all history operations
+// HistoryManager is a singleton controlling all history operations.
+//
+// The entries live in a Go store (see package store); the line editor reads
+// them through Lines to scroll through previous commands.
 type HistoryManager struct {
-	histSize             int
-	histFileSize         int
-	fileStates           map[string]*fileState // per-file tracking
-	defaultHistfilePath  string                // default HISTFILE path
-	defaultHistfilePathC *C.char               // C string for default file
-	countSessionHistory  int                   // counts the commands that were written in this section
-	loaded               bool
-	initOnce             sync.Once
+	histSize            int
+	histFileSize        int
+	entries             *store.Store
+	fileStates          map[string]*fileState // per-file tracking
+	defaultHistfilePath string                // default HISTFILE path
+	expander            Expander              // history expansion state (last substitution)
+	lastCommandAdded    bool                  // the last AddCommand line was recorded
+	sessionID           string                // identifies this shell in the structured log
+	hostname            string
+	loaded              bool
+	initOnce            sync.Once
 }
 
 type fileState struct {
-	startLength  int // number of entries loaded from this file
-	appendOffset int // number of entries already appended
+	startLength int    // number of entries of this file already in the history (read or written by us)
+	appendedID  int    // store ID of the last entry written to this file
+	inode       uint64 // identity of the file when startLength was counted
+	size        int64  // size of the file when startLength was counted
+	// The last entries of the file that are in the history, to find where
+	// to resume once another shell rewrote the file
+	tail []store.Entry
+}
+
+// How many entries fileState.tail keeps.
+const fileTailLength = 8
+
+// seen records that the first `read` entries of a file are in the history.
+func (fs *fileState) seen(file *store.File, entries []store.Entry, read int) {
+	fs.startLength = read
+	fs.inode = file.Inode()
+	fs.size = file.Size()
+	fs.tail = slices.Clone(entries[max(read-fileTailLength, 0):read])
+}
+
+// unread returns the entries of a file that are not in the history yet.
+func (fs *fileState) unread(file *store.File, entries []store.Entry) []store.Entry {
+	if fs.inode == file.Inode() && fs.size <= file.Size() && fs.startLength <= len(entries) {
+		return entries[fs.startLength:]
+	}
+
+	// Another shell replaced or truncated the file, so the line count is
+	// meaningless: read it again from the start, skipping the entries we
+	// already have. When it dropped the oldest lines, the last ones we have
+	// are still there, or their end starts the file.
+	for end := len(entries); end >= len(fs.tail) && len(fs.tail) > 0; end-- {
+		if slices.EqualFunc(entries[end-len(fs.tail):end], fs.tail, sameEntry) {
+			return entries[end:]
+		}
+	}
+	for kept := min(len(fs.tail)-1, len(entries)); kept > 0; kept-- {
+		if slices.EqualFunc(entries[:kept], fs.tail[len(fs.tail)-kept:], sameEntry) {
+			return entries[kept:]
+		}
+	}
+	return entries
+}
+
+// sameEntry reports whether a and b are the same line of a history file.
+func sameEntry(a, b store.Entry) bool {
+	return a.Line == b.Line && a.Time.Equal(b.Time)
 }
 
 var instance *HistoryManager
@@ -50,15 +95,16 @@ func GetHistoryManager() *HistoryManager {
 }
 
 func (h *HistoryManager) init() {
-	// Bootstraqp the readline ihstory internal structures
-	C.using_history()
-
 	// Default values like in bash
 	h.histSize = getEnvAsInt("HISTSIZE", 500)
 	h.histFileSize = getEnvAsInt("HISTFILESIZE", 2000)
 
+	h.entries = store.New(h.histSize)
 	h.fileStates = make(map[string]*fileState)
 
+	h.sessionID = newSessionID()
+	h.hostname, _ = os.Hostname()
+
 	// Determine history file path
 	histfilePath, found := syscall.Getenv("HISTFILE")
 	if !found {
@@ -69,25 +115,17 @@ func (h *HistoryManager) init() {
 		}
 	}
 
-	// Used to setup the command completion via TAB
-	C.setup_completion()
-
-	// Allocate C string for default file if present
 	if histfilePath != "" {
-		h.defaultHistfilePathC = C.CString(histfilePath)
-		h.defaultHistfilePath = histfilePath
 		// Load file if exists
-		if _, err := os.Stat(histfilePath); err == nil {
-			h.defaultHistfilePathC = C.CString(histfilePath)
-			h.defaultHistfilePath = histfilePath
-			C.read_history(h.defaultHistfilePathC)
-			h.fileStates[histfilePath] = &fileState{
-				startLength:  int(C.history_length),
-				appendOffset: 0,
+		if file, err := store.Open(histfilePath, false); err == nil {
+			if entries, err := file.Entries(); err == nil {
+				h.defaultHistfilePath = histfilePath
+				h.addEntries(entries)
+				fs := &fileState{appendedID: h.entries.LastID()}
+				fs.seen(file, entries, len(entries))
+				h.fileStates[histfilePath] = fs
 			}
-		} else {
-			h.defaultHistfilePath = ""
-			h.defaultHistfilePathC = nil
+			file.Close()
 		}
 	}
 	h.loaded = true
@@ -96,223 +134,446 @@ func (h *HistoryManager) init() {
 type HistoryEntry struct {
 	Index int
 	Line  string
-}
-
-func ForEachHistory(count int, fn func(index int, line unsafe.Pointer)) {
-	historyList := C.history_list()
-	if historyList == nil {
-		return
-	}
-
-	historyListStartPointer := uintptr(unsafe.Pointer(historyList))
-	//Get size of C.HIST_ENTRY
-	historyEntrySize := unsafe.Sizeof(*historyList)
-
-	// Count total entries
-	total := 0
-	for i := 0; ; i++ {
-		entryPointer := unsafe.Pointer(historyListStartPointer + uintptr(i)*historyEntrySize)
-		entry := *(**C.HIST_ENTRY)(entryPointer)
-		if entry == nil {
-			total = i
-			break
-		}
-	}
-
-	startIndex := 0
-	if count >= 0 && count < total {
-		startIndex = total - count
-	}
-
-	for i := startIndex; i < total; i++ {
-		entryPointer := unsafe.Pointer(historyListStartPointer + uintptr(i)*historyEntrySize)
-		// entryPointer is an unsafe.Pointer returned by the C Readline history function.
-		// The function actually returns a HIST_ENTRY** (pointer to a pointer to HIST_ENTRY),
-		// so we first cast entryPointer to **C.HIST_ENTRY, then dereference it once
-		// to get a *C.HIST_ENTRY, which points to the actual history entry struct.
-		entry := *(**C.HIST_ENTRY)(entryPointer)
-		fn(i+1, unsafe.Pointer(entry.line)) // raw C string
-	}
+	Time  time.Time // zero when the entry has no timestamp
 }
 
 // GetHistory returns the last `count` history entries along with their original history indices.
 // If count < 0, it returns all entries.
 func GetHistory(count int) []HistoryEntry {
-	historyList := C.history_list()
-	if historyList == nil {
-		return nil
-	}
+	h := GetHistoryManager()
 
-	historyListStartPointer := uintptr(unsafe.Pointer(historyList))
-	historyEntrySize := unsafe.Sizeof(*historyList)
+	entries := h.entries.Entries(count)
+	firstIndex := h.entries.Len() - len(entries) + 1 // history indices start from 1
 
-	// Find total entries
-	total := 0
-	for i := 0; ; i++ {
-		entryPointer := unsafe.Pointer(historyListStartPointer + uintptr(i)*historyEntrySize)
-		entry := *(**C.HIST_ENTRY)(entryPointer)
-		if entry == nil {
-			total = i
-			break
-		}
+	result := make([]HistoryEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = HistoryEntry{Index: firstIndex + i, Line: entry.Line, Time: entry.Time}
 	}
+	return result
+}
 
-	// Determine starting index
-	startIndex := 0
-	if count >= 0 && count < total {
-		startIndex = total - count
+// Lines returns the lines of the history, oldest first, for the line editor.
+func (h *HistoryManager) Lines() []string {
+	entries := h.entries.Entries(-1)
+	lines := make([]string, len(entries))
+	for i, entry := range entries {
+		lines[i] = entry.Line
 	}
+	return lines
+}
 
-	// Collect entries with their original indices
-	result := make([]HistoryEntry, 0, total-startIndex)
-	for i := startIndex; i < total; i++ {
-		entryPointer := unsafe.Pointer(historyListStartPointer + uintptr(i)*historyEntrySize)
-		entry := *(**C.HIST_ENTRY)(entryPointer)
-		result = append(result, HistoryEntry{
-			Index: i + 1, // original history index starts from 1
-			Line:  C.GoString(entry.line),
-		})
+// LinesHere reports, for each line returned by Lines, whether the command
+// was entered in the current directory.
+func (h *HistoryManager) LinesHere() []bool {
+	dir := os.Getenv("PWD")
+	entries := h.entries.Entries(-1)
+	here := make([]bool, len(entries))
+	for i, entry := range entries {
+		here[i] = entry.Cwd != "" && entry.Cwd == dir
 	}
-
-	return result
+	return here
 }
 
-func (h *HistoryManager) ReadLine(prompt string) string {
-	cPrompt := C.CString(prompt)
-	defer C.free(unsafe.Pointer(cPrompt))
+// Suggest returns the most recent history line that extends prefix, for the
+// autosuggestions of the line editor. The commands entered in the current
+// directory come first.
+func (h *HistoryManager) Suggest(prefix string) (string, bool) {
+	return h.entries.Suggest(prefix, os.Getenv("PWD"))
+}
 
-	line := C.readline(cPrompt)
-	if line == nil {
-		return "" // EOF (Ctrl+D)
+// Expand performs history expansion (!!, !$, ^old^new, ...) on a line read at
+// the prompt, using the current history.
+func (h *HistoryManager) Expand(line string) (Expansion, error) {
+	if !strings.ContainsAny(line, "!^") {
+		return Expansion{Line: line}, nil
 	}
-	defer C.free(unsafe.Pointer(line))
 
-	input := C.GoString(line)
-
-	if input != "" {
-		h.AddCommand(input) // automatically handle memory, HISTSIZE, HISTFILESIZE
+	events := make([]string, h.entries.Len())
+	for i := range events {
+		events[i] = h.entries.At(i).Line
 	}
-
-	return input
+	return h.expander.Expand(line, events)
 }
 
 // AddCommand adds a new command to history with size enforcement.
+//
+// Like bash, HISTCONTROL and HISTIGNORE decide whether the line is saved:
+//   - HISTCONTROL is a colon separated list of ignorespace (skip lines starting
+//     with a blank), ignoredups (skip a line equal to the previous one),
+//     ignoreboth (both) and erasedups (remove older copies of the line)
+//   - HISTIGNORE is a colon separated list of patterns; a line matching one of
+//     them entirely is not saved. '&' stands for the previous history line.
 func (h *HistoryManager) AddCommand(line string) {
+	h.lastCommandAdded = false
 	if !h.loaded || line == "" {
 		return
 	}
 
-	cLine := C.CString(line)
-	defer C.free(unsafe.Pointer(cLine))
+	var previous string
+	if n := h.entries.Len(); n > 0 {
+		previous = h.entries.At(n - 1).Line
+	}
 
-	// Add to in-memory history
-	C.add_history(cLine)
-	h.countSessionHistory++
+	var ignoreSpace, ignoreDups, eraseDups bool
+	for _, control := range strings.Split(os.Getenv("HISTCONTROL"), ":") {
+		switch control {
+		case "ignorespace":
+			ignoreSpace = true
+		case "ignoredups":
+			ignoreDups = true
+		case "ignoreboth":
+			ignoreSpace, ignoreDups = true, true
+		case "erasedups":
+			eraseDups = true
+		}
+	}
 
-	// Enforce HISTSIZE for in-memory history
-	if h.histSize > 0 && int(C.history_length) > h.histSize {
-		C.remove_history(0)
+	if ignoreSpace && (line[0] == ' ' || line[0] == '\t') {
+		return
+	}
+	if ignoreDups && h.entries.Len() > 0 && line == previous {
+		return
+	}
+	if matchesHistIgnore(line, previous) {
+		return
 	}
 
+	if eraseDups {
+		h.entries.RemoveLine(line)
+	}
+
+	// Add to in-memory history, HISTSIZE drops the oldest entries. Entries
+	// are tracked by ID, so whatever is dropped here is simply no longer
+	// found by AppendHistoryToFile.
+	h.addEntries([]store.Entry{{Line: line, Session: true, Time: time.Now(), Cwd: os.Getenv("PWD")}})
+	h.lastCommandAdded = true
+
 	// Do NOT write to file here (bash-like)
 }
 
-func (h *HistoryManager) WriteHistoryToFile(path string) {
-	//If empty then it goes to the default history file
-	if path == "" {
-		//This means there is no file to append the data.
-		if h.defaultHistfilePath == "" {
-			return
+// matchesHistIgnore reports whether line matches one of the HISTIGNORE
+// patterns. previous replaces '&' in the patterns.
+func matchesHistIgnore(line, previous string) bool {
+	histIgnore := os.Getenv("HISTIGNORE")
+	if histIgnore == "" {
+		return false
+	}
+
+	for _, glob := range splitHistIgnore(histIgnore) {
+		if glob == "" {
+			continue
+		}
+		if strings.Contains(glob, "&") {
+			glob = strings.ReplaceAll(glob, "&", pattern.Escape(previous))
 		}
+		if pattern.Match(glob, line) {
+			return true
+		}
+	}
+	return false
+}
 
-		path = h.defaultHistfilePath
+// splitHistIgnore splits HISTIGNORE on the colons that are not escaped with a
+// backslash.
+func splitHistIgnore(value string) []string {
+	var patterns []string
+	start := 0
+	for i := 0; i < len(value); i++ {
+		switch value[i] {
+		case '\\':
+			i++
+		case ':':
+			patterns = append(patterns, value[start:i])
+			start = i + 1
+		}
 	}
+	return append(patterns, value[start:])
+}
 
-	cPath := C.CString(path)
-	defer C.free(unsafe.Pointer(cPath))
+// addEntries appends entries to the store.
+func (h *HistoryManager) addEntries(entries []store.Entry) {
+	for _, entry := range entries {
+		h.entries.Add(entry)
+	}
+}
 
-	// C.write_history creates the file if it does not exist
-	// Try writing history to file
-	if rc := C.write_history(cPath); rc != 0 {
-		fmt.Printf("history -w: failed to write history to %s\n", path)
-		return
+// resolvePath returns the file a history operation works on: path, or the
+// default history file when path is empty. ok is false when there is none.
+func (h *HistoryManager) resolvePath(path string) (string, bool) {
+	if path != "" {
+		return path, true
 	}
+	//This means there is no file to read or write the data.
+	return h.defaultHistfilePath, h.defaultHistfilePath != ""
+}
 
-	// Update file state to reflect that everything is written
+// fileStateFor returns the tracking state of a history file, creating it for
+// a file this session hasn't used yet.
+func (h *HistoryManager) fileStateFor(path string) *fileState {
 	fs, ok := h.fileStates[path]
 	if !ok {
 		fs = &fileState{}
 		h.fileStates[path] = fs
 	}
-	fs.appendOffset = int(C.history_length)
-	fs.startLength = fs.appendOffset
+	return fs
 }
 
-func (h *HistoryManager) AppendHistoryToFile(path string) {
-	//If empty then it goes to the default history file
-	if path == "" {
-		//This means there is no file to append the data.
-		if h.defaultHistfilePath == "" {
-			return
-		}
+// WriteHistoryToFile replaces the content of the history file with the whole
+// history (`history -w`). An empty path means the default history file.
+func (h *HistoryManager) WriteHistoryToFile(path string) error {
+	path, ok := h.resolvePath(path)
+	if !ok {
+		return nil
+	}
 
-		path = h.defaultHistfilePath
+	// The file is created if it does not exist
+	file, err := store.Open(path, true)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	fs, ok := h.fileStates[path]
+	entries := h.entries.Entries(-1)
+	if err := file.Replace(entries); err != nil {
+		return err
+	}
+
+	// Update file state to reflect that everything is written
+	fs := h.fileStateFor(path)
+	fs.appendedID = h.entries.LastID()
+	fs.seen(file, entries, len(entries))
+	return nil
+}
+
+// AppendHistoryToFile appends the commands of this session that were not
+// written to the file yet (`history -a`). An empty path means the default
+// history file, which is then truncated to HISTFILESIZE commands.
+func (h *HistoryManager) AppendHistoryToFile(path string) error {
+	return h.syncFile(path, false)
+}
+
+// ShareHistory is run after every command when history sharing is on (`shopt
+// -s histshare`): under a single lock of the default history file, it reads
+// the commands other shells appended since the last call, then appends the
+// new commands of this session.
+func (h *HistoryManager) ShareHistory() error {
+	return h.syncFile("", true)
+}
+
+func (h *HistoryManager) syncFile(path string, readNew bool) error {
+	path, ok := h.resolvePath(path)
 	if !ok {
-		historyLength := int(C.history_length)
-		fs = &fileState{startLength: historyLength, appendOffset: 0}
-		h.fileStates[path] = fs
+		return nil
 	}
 
-	newLines := h.countSessionHistory - fs.appendOffset
-	if newLines > 0 {
+	_, known := h.fileStates[path]
+	fs := h.fileStateFor(path)
 
-		cPath := C.CString(path)
-		defer C.free(unsafe.Pointer(cPath))
+	// The session commands not written yet. Commands dropped by HISTSIZE or
+	// erased as duplicates are not in the store anymore and are skipped.
+	newEntries := h.entries.Since(fs.appendedID)
+	if len(newEntries) == 0 && !readNew {
+		return nil
+	}
 
-		// Append all new lines to the file; 0 means all new entries
-		if rc := C.append_history(C.int(newLines), cPath); rc != 0 {
-			fmt.Printf("history -a: failed to append history to %s\n", path)
-			return
-		}
+	// The lock keeps other shells from appending or truncating between our
+	// read, append and truncation
+	file, err := store.Open(path, true)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
 
-		fs.appendOffset += newLines
+	entries, err := file.Entries()
+	if err != nil {
+		return err
+	}
+	if !known {
+		fs.seen(file, entries, len(entries))
+	}
 
-		// If this is the default histfile, enforce HISTFILESIZE
-		if path == h.defaultHistfilePath && h.histFileSize > 0 {
-			// Use history_truncate_file from readline (if available)
-			if rc := C.history_truncate_file(cPath, C.int(h.histFileSize)); rc != 0 {
-				fmt.Printf("history -a: failed to truncate history in the file to %s\n", path)
-				return
-			}
+	read := fs.startLength
+	if readNew {
+		h.addEntries(fs.unread(file, entries))
+		read = len(entries)
+	}
+
+	if len(newEntries) > 0 {
+		if err := file.Append(newEntries); err != nil {
+			return err
 		}
+		fs.appendedID = h.entries.LastID()
+		entries = append(entries, newEntries...)
+		// Our own lines must not be read back by `history -n`
+		read += len(newEntries)
 	}
+
+	// If this is the default histfile, enforce HISTFILESIZE
+	if path == h.defaultHistfilePath && h.histFileSize > 0 && len(entries) > h.histFileSize {
+		removed := len(entries) - h.histFileSize
+		entries = entries[removed:]
+		if err := file.Replace(entries); err != nil {
+			return err
+		}
+		read = max(read-removed, 0)
+	}
+
+	fs.seen(file, entries, read)
+	return nil
 }
 
-func (h *HistoryManager) ReadHistory(path string) {
+// ReadHistory appends the content of a history file to the history
+// (`history -r`). An empty path means the default history file.
+func (h *HistoryManager) ReadHistory(path string) error {
+	path, ok := h.resolvePath(path)
+	if !ok {
+		return nil
+	}
+
+	if err := syscallHelpers.FileExists(path); err != nil {
+		return &os.PathError{Op: "stat", Path: path, Err: err}
+	}
 
-	err := syscallHelpers.FileExists(path)
+	file, err := store.Open(path, false)
 	if err != nil {
-		fmt.Printf("history -r: file not found: %s due to %v\n", path, err)
-		return
+		return err
 	}
+	defer file.Close()
 
-	cPath := C.CString(path)
-	defer C.free(unsafe.Pointer(cPath))
-	if rc := C.read_history(cPath); rc != 0 {
-		fmt.Printf("history -r: failed to read history from %s\n", path)
-		return
+	entries, err := file.Entries()
+	if err != nil {
+		return err
 	}
+	h.addEntries(entries)
+	h.fileStateFor(path).seen(file, entries, len(entries))
+	return nil
 }
 
-// Close frees resources associated with the history manager.
-func (h *HistoryManager) Close() {
-	if h.defaultHistfilePathC != nil {
-		C.free(unsafe.Pointer(h.defaultHistfilePathC))
-		h.defaultHistfilePathC = nil
+// ReadNewHistory appends the lines of a history file that were not read yet,
+// e.g. the commands other shells appended since (`history -n`). An empty path
+// means the default history file.
+func (h *HistoryManager) ReadNewHistory(path string) error {
+	path, ok := h.resolvePath(path)
+	if !ok {
+		return nil
+	}
+
+	file, err := store.Open(path, false)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
+
+	entries, err := file.Entries()
+	if err != nil {
+		return err
+	}
+
+	fs := h.fileStateFor(path)
+	h.addEntries(fs.unread(file, entries))
+	fs.seen(file, entries, len(entries))
+	return nil
+}
+
+// CommandInfo describes how a command entered at the prompt ran.
+type CommandInfo struct {
+	Line       string
+	Cwd        string // working directory when the command started
+	Start      time.Time
+	Duration   time.Duration
+	Status     int
+	PipeStatus []int
+}
+
+// LogCommand appends a command to the structured history log, the JSON Lines
+// file named by $SHELLY_HISTLOG (no log when unset). Like the history itself,
+// commands that AddCommand did not record (HISTCONTROL, HISTIGNORE) are not
+// logged.
+func (h *HistoryManager) LogCommand(info CommandInfo) error {
+	path := os.Getenv("SHELLY_HISTLOG")
+	if path == "" || !h.lastCommandAdded {
+		return nil
+	}
+
+	return store.AppendRecord(path, store.Record{
+		Command:    info.Line,
+		Cwd:        info.Cwd,
+		Start:      info.Start,
+		DurationMs: float64(info.Duration.Microseconds()) / 1000,
+		Status:     info.Status,
+		PipeStatus: info.PipeStatus,
+		Hostname:   h.hostname,
+		Session:    h.sessionID,
+	})
+}
+
+// LogRecords returns the last count records of the structured history log,
+// or all of them when count is negative. ok is false when $SHELLY_HISTLOG is
+// not set.
+func (h *HistoryManager) LogRecords(count int) (records []store.Record, ok bool, err error) {
+	path := os.Getenv("SHELLY_HISTLOG")
+	if path == "" {
+		return nil, false, nil
+	}
+
+	records, err = store.ReadRecords(path)
+	if os.IsNotExist(err) {
+		return nil, true, nil
+	}
+	if count >= 0 && count < len(records) {
+		records = records[len(records)-count:]
+	}
+	return records, true, err
+}
+
+// newSessionID returns a random identifier for this shell session.
+func newSessionID() string {
+	id := make([]byte, 8)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// Len returns the number of entries in the history.
+func (h *HistoryManager) Len() int {
+	return h.entries.Len()
+}
+
+// Clear removes every entry from the history (`history -c`).
+func (h *HistoryManager) Clear() {
+	h.entries.Clear()
+}
+
+// DeleteRange removes the entries at positions first to last (0 based,
+// inclusive) from the history (`history -d`).
+func (h *HistoryManager) DeleteRange(first, last int) {
+	h.entries.DeleteRange(first, last)
+}
+
+// CurrentCommandRecorded reports whether the command being executed was
+// recorded by AddCommand, i.e. whether it is the last history entry.
+func (h *HistoryManager) CurrentCommandRecorded() bool {
+	return h.lastCommandAdded && h.entries.Len() > 0
+}
+
+// RemoveCurrentCommand removes the command being executed from the history,
+// for builtins such as `history -s` and `fc` that record other commands in
+// its place.
+func (h *HistoryManager) RemoveCurrentCommand() {
+	if h.CurrentCommandRecorded() {
+		n := h.entries.Len()
+		h.DeleteRange(n-1, n-1)
+		h.lastCommandAdded = false
+	}
+}
+
+// StoreCommand adds line to the history as if it had been entered, without
+// applying HISTCONTROL or HISTIGNORE (`history -s`).
+func (h *HistoryManager) StoreCommand(line string) {
+	h.addEntries([]store.Entry{{Line: line, Session: true, Time: time.Now(), Cwd: os.Getenv("PWD")}})
+}
+
+// Close stops recording commands in the history.
+func (h *HistoryManager) Close() {
 	h.loaded = false
 }
 
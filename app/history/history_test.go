@@ -0,0 +1,123 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"shelly/app/history/store"
+	"slices"
+	"testing"
+)
+
+// withFile locks the history file at path and passes its entries to f.
+func withFile(t *testing.T, path string, f func(file *store.File, entries []store.Entry)) {
+	t.Helper()
+	file, err := store.Open(path, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	entries, err := file.Entries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f(file, entries)
+}
+
+func entryLines(entries []store.Entry) []string {
+	lines := []string{}
+	for _, entry := range entries {
+		lines = append(lines, entry.Line)
+	}
+	return lines
+}
+
+func TestUnread(t *testing.T) {
+	tests := []struct {
+		name    string
+		before  string // the file when it was last read
+		rewrite func(path string) error
+		want    []string
+	}{
+		{
+			name:   "appended",
+			before: "a\nb\n",
+			rewrite: func(path string) error {
+				return appendString(path, "c\n")
+			},
+			want: []string{"c"},
+		},
+		{
+			name:   "replaced by another shell",
+			before: "a\nb\nc\n",
+			rewrite: func(path string) error {
+				return replaceString(path, "b\nc\nd\n")
+			},
+			want: []string{"d"},
+		},
+		{
+			name:   "truncated in place",
+			before: "one\ntwo\nthree\n",
+			rewrite: func(path string) error {
+				return os.WriteFile(path, []byte("x\ny\n"), 0o600)
+			},
+			want: []string{"x", "y"},
+		},
+		{
+			name:   "replaced, keeping the lines read",
+			before: "a\nb\n",
+			rewrite: func(path string) error {
+				return replaceString(path, "a\nb\nc\n")
+			},
+			want: []string{"c"},
+		},
+		{
+			name:   "replaced without the lines read",
+			before: "#100\na\n#101\nb\n",
+			rewrite: func(path string) error {
+				return replaceString(path, "#102\nc\n")
+			},
+			want: []string{"c"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "history")
+			if err := os.WriteFile(path, []byte(test.before), 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			fs := &fileState{}
+			withFile(t, path, func(file *store.File, entries []store.Entry) {
+				fs.seen(file, entries, len(entries))
+			})
+			if err := test.rewrite(path); err != nil {
+				t.Fatal(err)
+			}
+			withFile(t, path, func(file *store.File, entries []store.Entry) {
+				if got := entryLines(fs.unread(file, entries)); !slices.Equal(got, test.want) {
+					t.Errorf("unread = %q, want %q", got, test.want)
+				}
+			})
+		})
+	}
+}
+
+func appendString(path, s string) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = file.WriteString(s)
+	return err
+}
+
+// replaceString puts a new file in place, like store.File.Replace does.
+func replaceString(path, s string) error {
+	temp := path + ".new"
+	if err := os.WriteFile(temp, []byte(s), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
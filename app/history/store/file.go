@@ -0,0 +1,209 @@
+package store
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// File is a history file opened with an exclusive flock(2) lock, so several
+// shells sharing it cannot interleave their appends and truncations. The lock
+// is held until Close.
+//
+// Rewriting the file (Replace) goes through a temporary file renamed over the
+// original, so a crash never leaves a half written history. Since the rename
+// puts a new inode in place, a shell that was waiting for the lock of the old
+// one notices it and locks the new file instead.
+type File struct {
+	path  string
+	lock  *os.File
+	inode uint64
+}
+
+// Open locks the history file at path, waiting for other shells to release
+// it. The file is created when create is set, otherwise it must exist.
+func Open(path string, create bool) (*File, error) {
+	flags := os.O_RDONLY
+	if create {
+		flags |= os.O_CREATE
+	}
+
+	for {
+		lock, err := os.OpenFile(path, flags, 0o600)
+		if err != nil {
+			return nil, err
+		}
+		if err := flock(lock, syscall.LOCK_EX); err != nil {
+			lock.Close()
+			return nil, &os.PathError{Op: "flock", Path: path, Err: err}
+		}
+
+		// The file may have been replaced while we were waiting for the lock
+		locked, err := inodeOf(lock.Stat())
+		if err != nil {
+			lock.Close()
+			return nil, err
+		}
+		current, err := inodeOf(os.Stat(path))
+		if err == nil && current == locked {
+			return &File{path: path, lock: lock, inode: locked}, nil
+		}
+		lock.Close()
+		if err != nil && !(create && os.IsNotExist(err)) {
+			return nil, err
+		}
+	}
+}
+
+// Inode identifies the content of the file: it changes when another shell
+// replaces the file, e.g. to truncate it.
+func (f *File) Inode() uint64 {
+	return f.inode
+}
+
+// Size returns the size of the file in bytes, 0 if it can't be known. It
+// drops when the file is truncated in place.
+func (f *File) Size() int64 {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return 0
+	}
+	return info.Size()
+}
+
+// Entries reads every entry of the file, one command per line. Like bash, a
+// line made of '#' and digits is not a command but the timestamp (seconds
+// since the epoch) of the command on the next line.
+func (f *File) Entries() ([]Entry, error) {
+	if _, err := f.lock.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return readEntries(f.lock)
+}
+
+// Append appends entries to the file.
+func (f *File) Append(entries []Entry) error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.WriteString(formatEntries(entries)); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Replace atomically replaces the content of the file with entries.
+func (f *File) Replace(entries []Entry) error {
+	dir, name := filepath.Split(f.path)
+	if dir == "" {
+		dir = "."
+	}
+	temp, err := os.CreateTemp(dir, "."+name+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	// Keep the permissions of the file being replaced (CreateTemp uses 0600)
+	if info, err := f.lock.Stat(); err == nil {
+		temp.Chmod(info.Mode().Perm())
+	}
+
+	_, err = temp.WriteString(formatEntries(entries))
+	if err == nil {
+		err = temp.Sync()
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	if inode, err := inodeOf(os.Stat(f.path)); err == nil {
+		f.inode = inode
+	}
+	return nil
+}
+
+// Close releases the lock.
+func (f *File) Close() error {
+	return f.lock.Close()
+}
+
+func readEntries(reader io.Reader) ([]Entry, error) {
+	var entries []Entry
+	var timestamp time.Time
+	scanner := bufio.NewScanner(reader)
+	// History lines can be long (pasted scripts), don't stop at 64KiB
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if seconds, ok := parseTimestampLine(line); ok {
+			timestamp = time.Unix(seconds, 0)
+			continue
+		}
+		entries = append(entries, Entry{Line: line, Time: timestamp})
+		timestamp = time.Time{}
+	}
+	return entries, scanner.Err()
+}
+
+func formatEntries(entries []Entry) string {
+	var builder strings.Builder
+	for _, entry := range entries {
+		if !entry.Time.IsZero() {
+			builder.WriteByte('#')
+			builder.WriteString(strconv.FormatInt(entry.Time.Unix(), 10))
+			builder.WriteByte('\n')
+		}
+		builder.WriteString(entry.Line)
+		builder.WriteByte('\n')
+	}
+	return builder.String()
+}
+
+// flock locks file, retrying when a signal interrupts the wait.
+func flock(file *os.File, how int) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), how)
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+func inodeOf(info os.FileInfo, err error) (uint64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino, nil
+	}
+	return 0, nil
+}
+
+// parseTimestampLine recognizes the `#1697500000` lines bash writes before a
+// command when timestamps are enabled.
+func parseTimestampLine(line string) (int64, bool) {
+	if len(line) < 2 || line[0] != '#' {
+		return 0, false
+	}
+	for i := 1; i < len(line); i++ {
+		if line[i] < '0' || line[i] > '9' {
+			return 0, false
+		}
+	}
+	seconds, err := strconv.ParseInt(line[1:], 10, 64)
+	return seconds, err == nil
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"sort"
+	"strings"
+)
+
+// prefixIndex finds the most recent entry starting with a prefix without
+// scanning the history. It keeps the distinct lines sorted, so that the lines
+// sharing a prefix are next to each other, with the ID of their latest entry.
+// A segment tree over the lines then gives the largest ID of a range of lines
+// in logarithmic time. A new line shifts the positions, so the tree is
+// rebuilt (in linear time) on the first lookup after one is added.
+type prefixIndex struct {
+	lines []string
+	ids   []int // ids[i] is the ID of the latest entry of lines[i]
+	// tree[len(lines)+i] is i; tree[n] is the position of the largest ID of
+	// tree[2n] and tree[2n+1]. nil when out of date.
+	tree []int
+}
+
+// set records id as the latest entry of line.
+func (x *prefixIndex) set(line string, id int) {
+	i, found := x.find(line)
+	if found {
+		x.ids[i] = id
+		if x.tree != nil {
+			for n := (len(x.lines) + i) / 2; n > 0; n /= 2 {
+				x.tree[n] = x.latestOf(x.tree[2*n], x.tree[2*n+1])
+			}
+		}
+		return
+	}
+
+	x.lines = append(x.lines, "")
+	copy(x.lines[i+1:], x.lines[i:])
+	x.lines[i] = line
+	x.ids = append(x.ids, 0)
+	copy(x.ids[i+1:], x.ids[i:])
+	x.ids[i] = id
+	x.tree = nil
+}
+
+// drop forgets line if id is its latest entry, i.e. when the entry being
+// dropped is the last one with that line.
+func (x *prefixIndex) drop(line string, id int) {
+	if i, found := x.find(line); found && x.ids[i] == id {
+		x.remove(i)
+	}
+}
+
+// forget removes line, whatever its latest entry.
+func (x *prefixIndex) forget(line string) {
+	if i, found := x.find(line); found {
+		x.remove(i)
+	}
+}
+
+// latest returns the line of the most recent entry that starts with prefix
+// and is longer than it.
+func (x *prefixIndex) latest(prefix string) (string, bool) {
+	start, _ := x.find(prefix)
+	if start < len(x.lines) && x.lines[start] == prefix {
+		start++
+	}
+	// The lines starting with prefix follow it in the sorted order
+	end := start + sort.Search(len(x.lines)-start, func(i int) bool {
+		return !strings.HasPrefix(x.lines[start+i], prefix)
+	})
+	if start == end {
+		return "", false
+	}
+	return x.lines[x.rangeMax(start, end)], true
+}
+
+// rangeMax returns the position of the largest ID among lines[start:end].
+func (x *prefixIndex) rangeMax(start, end int) int {
+	if x.tree == nil {
+		x.buildTree()
+	}
+	best := start
+	for left, right := start+len(x.lines), end+len(x.lines); left < right; left, right = left/2, right/2 {
+		if left%2 == 1 {
+			best = x.latestOf(best, x.tree[left])
+			left++
+		}
+		if right%2 == 1 {
+			right--
+			best = x.latestOf(best, x.tree[right])
+		}
+	}
+	return best
+}
+
+func (x *prefixIndex) buildTree() {
+	n := len(x.lines)
+	x.tree = make([]int, 2*n)
+	for i := range n {
+		x.tree[n+i] = i
+	}
+	for i := n - 1; i > 0; i-- {
+		x.tree[i] = x.latestOf(x.tree[2*i], x.tree[2*i+1])
+	}
+}
+
+// latestOf returns whichever of the lines at positions i and j has the
+// latest entry.
+func (x *prefixIndex) latestOf(i, j int) int {
+	if x.ids[j] > x.ids[i] {
+		return j
+	}
+	return i
+}
+
+func (x *prefixIndex) find(line string) (int, bool) {
+	i := sort.SearchStrings(x.lines, line)
+	return i, i < len(x.lines) && x.lines[i] == line
+}
+
+func (x *prefixIndex) remove(i int) {
+	x.lines = append(x.lines[:i], x.lines[i+1:]...)
+	x.ids = append(x.ids[:i], x.ids[i+1:]...)
+	x.tree = nil
+}
+
+// buildPrefixIndex indexes entries, oldest first.
+func buildPrefixIndex(entries []Entry) *prefixIndex {
+	latest := make(map[string]int, len(entries))
+	for _, entry := range entries {
+		latest[entry.Line] = entry.ID
+	}
+
+	x := &prefixIndex{lines: make([]string, 0, len(latest))}
+	for line := range latest {
+		x.lines = append(x.lines, line)
+	}
+	sort.Strings(x.lines)
+	x.ids = make([]int, len(x.lines))
+	for i, line := range x.lines {
+		x.ids[i] = latest[line]
+	}
+	return x
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"time"
+)
+
+// Record is one line of the structured history log, a JSON Lines file that
+// keeps the context of every command next to the plain history file.
+type Record struct {
+	Command    string    `json:"cmd"`
+	Cwd        string    `json:"cwd"`
+	Start      time.Time `json:"start"`
+	DurationMs float64   `json:"duration_ms"`
+	Status     int       `json:"status"`
+	PipeStatus []int     `json:"pipestatus"`
+	Hostname   string    `json:"hostname"`
+	Session    string    `json:"session"`
+}
+
+// AppendRecord appends record to the log at path, creating it if needed.
+func AppendRecord(path string, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := Open(path, true)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	log, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := log.Write(append(line, '\n')); err != nil {
+		log.Close()
+		return err
+	}
+	return log.Close()
+}
+
+// ReadRecords reads the log at path. Lines that are not valid records (e.g.
+// cut short by a crash) are skipped.
+func ReadRecords(path string) ([]Record, error) {
+	file, err := Open(path, false)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(file.lock)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err == nil {
+			records = append(records, record)
+		}
+	}
+	return records, scanner.Err()
+}
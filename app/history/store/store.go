@@ -0,0 +1,195 @@
+// Package store keeps the command history in Go memory.
+//
+// The store is the source of truth for the history: the line editor is fed
+// from it to scroll through previous commands. Keeping it free of cgo means it
+// can be used (and tested) without readline.
+package store
+
+import (
+	"slices"
+	"time"
+)
+
+// Entry is one command of the history.
+type Entry struct {
+	Line string
+	// ID is assigned by the store, increasing in the order entries are added.
+	// It stays valid when older entries are dropped or erased.
+	ID int
+	// Session is true for commands entered in this shell session, as opposed
+	// to lines loaded from a history file.
+	Session bool
+	// Time is when the command was entered; zero when unknown (e.g. a history
+	// file written without timestamps).
+	Time time.Time
+	// Cwd is the working directory the command was entered in; empty when
+	// unknown (lines loaded from a history file).
+	Cwd string
+}
+
+// Store is an ordered list of history entries, oldest first, holding at most
+// limit entries (no limit when limit <= 0).
+type Store struct {
+	entries []Entry
+	limit   int
+	lastID  int
+
+	// Indexes of the lines for Suggest, nil until needed or after a change
+	// they can't follow
+	index      *prefixIndex
+	dirIndexes map[string]*prefixIndex // entries by working directory
+}
+
+// New returns an empty store keeping at most limit entries.
+func New(limit int) *Store {
+	return &Store{limit: limit}
+}
+
+// Len returns the number of entries.
+func (s *Store) Len() int {
+	return len(s.entries)
+}
+
+// At returns the entry at position i (0 is the oldest).
+func (s *Store) At(i int) Entry {
+	return s.entries[i]
+}
+
+// Entries returns a copy of the last count entries, or of every entry when
+// count is negative or larger than the store.
+func (s *Store) Entries(count int) []Entry {
+	start := 0
+	if count >= 0 && count < len(s.entries) {
+		start = len(s.entries) - count
+	}
+
+	entries := make([]Entry, len(s.entries)-start)
+	copy(entries, s.entries[start:])
+	return entries
+}
+
+// LastID returns the ID of the most recently added entry, 0 if none was added.
+func (s *Store) LastID() int {
+	return s.lastID
+}
+
+// Since returns the session entries added after the entry with the given ID,
+// i.e. the commands that still have to be appended to a file that received
+// everything up to that ID.
+func (s *Store) Since(id int) []Entry {
+	var entries []Entry
+	for _, entry := range s.entries {
+		if entry.ID > id && entry.Session {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Add appends an entry, assigning its ID, and drops the oldest ones beyond
+// the limit. It returns how many entries were dropped.
+func (s *Store) Add(entry Entry) (dropped int) {
+	s.lastID++
+	entry.ID = s.lastID
+	s.entries = append(s.entries, entry)
+	if s.index != nil {
+		s.index.set(entry.Line, entry.ID)
+		if entry.Cwd != "" {
+			s.dirIndex(entry.Cwd).set(entry.Line, entry.ID)
+		}
+	}
+	return s.trim()
+}
+
+// Suggest returns the line of the most recent entry that starts with prefix
+// and is longer than it, for autosuggestions. The entries entered in dir come
+// first, the others are only looked at when none of them matches.
+func (s *Store) Suggest(prefix, dir string) (string, bool) {
+	if s.index == nil {
+		s.buildIndexes()
+	}
+	if index := s.dirIndexes[dir]; index != nil {
+		if line, ok := index.latest(prefix); ok {
+			return line, true
+		}
+	}
+	return s.index.latest(prefix)
+}
+
+// RemoveLine removes every entry whose line is line and returns how many were
+// removed.
+func (s *Store) RemoveLine(line string) (removed int) {
+	kept := s.entries[:0]
+	for _, entry := range s.entries {
+		if entry.Line == line {
+			removed++
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	clear(s.entries[len(kept):])
+	s.entries = kept
+	if s.index != nil {
+		s.index.forget(line)
+		for _, index := range s.dirIndexes {
+			index.forget(line)
+		}
+	}
+	return removed
+}
+
+// DeleteRange removes the entries at positions first to last (inclusive).
+func (s *Store) DeleteRange(first, last int) {
+	s.entries = slices.Delete(s.entries, first, last+1)
+	s.index, s.dirIndexes = nil, nil
+}
+
+// Clear removes every entry.
+func (s *Store) Clear() {
+	s.entries = nil
+	s.index, s.dirIndexes = nil, nil
+}
+
+func (s *Store) trim() int {
+	if s.limit <= 0 || len(s.entries) <= s.limit {
+		return 0
+	}
+
+	dropped := len(s.entries) - s.limit
+	if s.index != nil {
+		for _, entry := range s.entries[:dropped] {
+			s.index.drop(entry.Line, entry.ID)
+			if index := s.dirIndexes[entry.Cwd]; index != nil {
+				index.drop(entry.Line, entry.ID)
+			}
+		}
+	}
+	// Copy instead of reslicing so the dropped entries can be collected
+	s.entries = append([]Entry(nil), s.entries[dropped:]...)
+	return dropped
+}
+
+func (s *Store) buildIndexes() {
+	s.index = buildPrefixIndex(s.entries)
+
+	byDir := make(map[string][]Entry)
+	for _, entry := range s.entries {
+		if entry.Cwd != "" {
+			byDir[entry.Cwd] = append(byDir[entry.Cwd], entry)
+		}
+	}
+	s.dirIndexes = make(map[string]*prefixIndex, len(byDir))
+	for dir, entries := range byDir {
+		s.dirIndexes[dir] = buildPrefixIndex(entries)
+	}
+}
+
+// dirIndex returns the index of the entries entered in dir.
+func (s *Store) dirIndex(dir string) *prefixIndex {
+	index := s.dirIndexes[dir]
+	if index == nil {
+		index = &prefixIndex{}
+		s.dirIndexes[dir] = index
+	}
+	return index
+}
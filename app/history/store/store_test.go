@@ -0,0 +1,216 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func lines(s *Store) []string {
+	var result []string
+	for _, entry := range s.Entries(-1) {
+		result = append(result, entry.Line)
+	}
+	return result
+}
+
+func newStore(limit int, entries ...Entry) *Store {
+	s := New(limit)
+	for _, entry := range entries {
+		s.Add(entry)
+	}
+	return s
+}
+
+func TestAdd(t *testing.T) {
+	s := New(0)
+	for i, line := range []string{"ls", "pwd", "ls"} {
+		if dropped := s.Add(Entry{Line: line}); dropped != 0 {
+			t.Errorf("Add(%q) dropped %d entries without a limit", line, dropped)
+		}
+		if got := s.LastID(); got != i+1 {
+			t.Errorf("LastID() = %d after %d entries", got, i+1)
+		}
+	}
+
+	if got, want := lines(s), []string{"ls", "pwd", "ls"}; !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if got := s.At(1).ID; got != 2 {
+		t.Errorf("At(1).ID = %d, want 2", got)
+	}
+}
+
+func TestAddTrimsToLimit(t *testing.T) {
+	s := newStore(2, Entry{Line: "a"}, Entry{Line: "b"})
+
+	if dropped := s.Add(Entry{Line: "c"}); dropped != 1 {
+		t.Errorf("Add beyond the limit dropped %d entries, want 1", dropped)
+	}
+	if got, want := lines(s), []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	// IDs keep increasing past the dropped entries
+	if got := s.At(1).ID; got != 3 {
+		t.Errorf("At(1).ID = %d, want 3", got)
+	}
+}
+
+func TestSince(t *testing.T) {
+	s := newStore(0,
+		Entry{Line: "from file"},
+		Entry{Line: "one", Session: true},
+		Entry{Line: "two", Session: true},
+	)
+
+	var got []string
+	for _, entry := range s.Since(2) {
+		got = append(got, entry.Line)
+	}
+	if want := []string{"two"}; !slices.Equal(got, want) {
+		t.Errorf("Since(2) = %q, want %q", got, want)
+	}
+}
+
+func TestRemoveLine(t *testing.T) {
+	s := newStore(0, Entry{Line: "ls"}, Entry{Line: "pwd"}, Entry{Line: "ls"})
+
+	if removed := s.RemoveLine("ls"); removed != 2 {
+		t.Errorf("RemoveLine removed %d entries, want 2", removed)
+	}
+	if got, want := lines(s), []string{"pwd"}; !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+	if removed := s.RemoveLine("missing"); removed != 0 {
+		t.Errorf("RemoveLine of a missing line removed %d entries", removed)
+	}
+}
+
+func TestDeleteRange(t *testing.T) {
+	s := newStore(0, Entry{Line: "a"}, Entry{Line: "b"}, Entry{Line: "c"}, Entry{Line: "d"})
+
+	s.DeleteRange(1, 2)
+	if got, want := lines(s), []string{"a", "d"}; !slices.Equal(got, want) {
+		t.Errorf("entries = %q, want %q", got, want)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	s := newStore(0,
+		Entry{Line: "git status", Cwd: "/repo"},
+		Entry{Line: "git commit", Cwd: "/repo"},
+		Entry{Line: "git log", Cwd: "/other"},
+		Entry{Line: "git"},
+	)
+
+	tests := []struct {
+		prefix, dir string
+		want        string
+		ok          bool
+	}{
+		{prefix: "git", dir: "/elsewhere", want: "git log", ok: true},
+		{prefix: "git", dir: "/repo", want: "git commit", ok: true},
+		{prefix: "git s", dir: "/other", want: "git status", ok: true},
+		{prefix: "git log", dir: "/repo", ok: false},
+		{prefix: "make", dir: "/repo", ok: false},
+	}
+	for _, test := range tests {
+		got, ok := s.Suggest(test.prefix, test.dir)
+		if got != test.want || ok != test.ok {
+			t.Errorf("Suggest(%q, %q) = %q, %v, want %q, %v", test.prefix, test.dir, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+// The prefix indexes are built by the first Suggest and then kept up to date:
+// these tests change the store after that.
+
+func TestSuggestAfterAdd(t *testing.T) {
+	s := newStore(0, Entry{Line: "make build"})
+	s.Suggest("make", "")
+
+	s.Add(Entry{Line: "make test", Cwd: "/repo"})
+	if got, _ := s.Suggest("make", ""); got != "make test" {
+		t.Errorf("Suggest after Add = %q, want %q", got, "make test")
+	}
+	if got, _ := s.Suggest("make", "/repo"); got != "make test" {
+		t.Errorf("Suggest in the directory after Add = %q, want %q", got, "make test")
+	}
+}
+
+func TestSuggestAfterTrim(t *testing.T) {
+	s := newStore(3,
+		Entry{Line: "echo one", Cwd: "/tmp"},
+		Entry{Line: "echo two"},
+		Entry{Line: "echo one", Cwd: "/tmp"},
+	)
+	s.Suggest("echo", "/tmp")
+
+	// The first "echo one" is dropped, the line is still in the history
+	s.Add(Entry{Line: "ls"})
+	if got, _ := s.Suggest("echo", "/tmp"); got != "echo one" {
+		t.Errorf("Suggest after dropping an older duplicate = %q, want %q", got, "echo one")
+	}
+
+	// "echo two" was the only entry of its line
+	s.Add(Entry{Line: "pwd"})
+	if got, ok := s.Suggest("echo t", ""); ok {
+		t.Errorf("Suggest of a dropped line = %q, want none", got)
+	}
+
+	// Now the last "echo one" is gone too
+	s.Add(Entry{Line: "cd"})
+	if got, ok := s.Suggest("echo", "/tmp"); ok {
+		t.Errorf("Suggest after dropping every entry of the line = %q, want none", got)
+	}
+}
+
+func TestSuggestAfterRemoveLine(t *testing.T) {
+	s := newStore(0,
+		Entry{Line: "rm -rf build", Cwd: "/repo"},
+		Entry{Line: "rm file"},
+		Entry{Line: "rm -rf build", Cwd: "/repo"},
+	)
+	s.Suggest("rm", "/repo")
+
+	s.RemoveLine("rm -rf build")
+	if got, _ := s.Suggest("rm", "/repo"); got != "rm file" {
+		t.Errorf("Suggest after RemoveLine = %q, want %q", got, "rm file")
+	}
+}
+
+func TestSuggestAfterDeleteRange(t *testing.T) {
+	s := newStore(0, Entry{Line: "go test"}, Entry{Line: "go build"}, Entry{Line: "go vet"})
+	s.Suggest("go", "")
+
+	s.DeleteRange(1, 2)
+	if got, _ := s.Suggest("go", ""); got != "go test" {
+		t.Errorf("Suggest after DeleteRange = %q, want %q", got, "go test")
+	}
+}
+
+// TestSuggestMatchesScan compares Suggest with a scan of the history, the
+// segment tree of the index being rebuilt after the changes in between.
+func TestSuggestMatchesScan(t *testing.T) {
+	words := []string{"a", "ab", "abc", "b", "ba", "bab", "c"}
+	s := New(20)
+	for i := range 200 {
+		line := words[i*7%len(words)] + words[i*3%len(words)]
+		s.Add(Entry{Line: line})
+		if i%17 == 0 {
+			s.RemoveLine(words[i%len(words)] + "a")
+		}
+
+		for _, prefix := range words {
+			want, wantOK := "", false
+			for j := s.Len() - 1; j >= 0; j-- {
+				if l := s.At(j).Line; len(l) > len(prefix) && l[:len(prefix)] == prefix {
+					want, wantOK = l, true
+					break
+				}
+			}
+			if got, ok := s.Suggest(prefix, ""); got != want || ok != wantOK {
+				t.Fatalf("after %d lines, Suggest(%q) = %q, %v, want %q, %v", i+1, prefix, got, ok, want, wantOK)
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package history
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FormatTime formats t with a strftime(3) format, as used by HISTTIMEFORMAT.
+// Unknown conversions are copied unchanged.
+func FormatTime(format string, t time.Time) string {
+	var builder strings.Builder
+
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			builder.WriteByte(format[i])
+			continue
+		}
+
+		i++
+		switch format[i] {
+		case 'a':
+			builder.WriteString(t.Format("Mon"))
+		case 'A':
+			builder.WriteString(t.Format("Monday"))
+		case 'b', 'h':
+			builder.WriteString(t.Format("Jan"))
+		case 'B':
+			builder.WriteString(t.Format("January"))
+		case 'c':
+			builder.WriteString(t.Format("Mon Jan _2 15:04:05 2006"))
+		case 'C':
+			builder.WriteString(pad(t.Year()/100, 2, '0'))
+		case 'd':
+			builder.WriteString(pad(t.Day(), 2, '0'))
+		case 'D':
+			builder.WriteString(t.Format("01/02/06"))
+		case 'e':
+			builder.WriteString(pad(t.Day(), 2, ' '))
+		case 'F':
+			builder.WriteString(t.Format("2006-01-02"))
+		case 'H':
+			builder.WriteString(pad(t.Hour(), 2, '0'))
+		case 'I':
+			builder.WriteString(pad(hour12(t), 2, '0'))
+		case 'j':
+			builder.WriteString(pad(t.YearDay(), 3, '0'))
+		case 'k':
+			builder.WriteString(pad(t.Hour(), 2, ' '))
+		case 'l':
+			builder.WriteString(pad(hour12(t), 2, ' '))
+		case 'm':
+			builder.WriteString(pad(int(t.Month()), 2, '0'))
+		case 'M':
+			builder.WriteString(pad(t.Minute(), 2, '0'))
+		case 'n':
+			builder.WriteByte('\n')
+		case 'p':
+			builder.WriteString(t.Format("PM"))
+		case 'r':
+			builder.WriteString(t.Format("03:04:05 PM"))
+		case 'R':
+			builder.WriteString(t.Format("15:04"))
+		case 's':
+			builder.WriteString(strconv.FormatInt(t.Unix(), 10))
+		case 'S':
+			builder.WriteString(pad(t.Second(), 2, '0'))
+		case 't':
+			builder.WriteByte('\t')
+		case 'T', 'X':
+			builder.WriteString(t.Format("15:04:05"))
+		case 'u':
+			weekday := int(t.Weekday())
+			if weekday == 0 {
+				weekday = 7
+			}
+			builder.WriteString(strconv.Itoa(weekday))
+		case 'w':
+			builder.WriteString(strconv.Itoa(int(t.Weekday())))
+		case 'x':
+			builder.WriteString(t.Format("01/02/06"))
+		case 'y':
+			builder.WriteString(pad(t.Year()%100, 2, '0'))
+		case 'Y':
+			builder.WriteString(strconv.Itoa(t.Year()))
+		case 'z':
+			builder.WriteString(t.Format("-0700"))
+		case 'Z':
+			builder.WriteString(t.Format("MST"))
+		case '%':
+			builder.WriteByte('%')
+		default:
+			builder.WriteByte('%')
+			builder.WriteByte(format[i])
+		}
+	}
+
+	return builder.String()
+}
+
+func hour12(t time.Time) int {
+	hour := t.Hour() % 12
+	if hour == 0 {
+		return 12
+	}
+	return hour
+}
+
+// pad formats n with at least width digits, padded on the left with fill.
+func pad(n, width int, fill byte) string {
+	s := strconv.Itoa(n)
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat(string(fill), width-len(s)) + s
+}
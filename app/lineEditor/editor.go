@@ -0,0 +1,8 @@
+//go:build !readline
+
+package lineEditor
+
+// New returns the line editor written in Go.
+func New(config Config) Editor {
+	return newNativeEditor(config)
+}
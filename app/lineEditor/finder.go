@@ -0,0 +1,464 @@
+package lineEditor
+
+import (
+	"io/fs"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"shelly/app/completion"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The fuzzy finder (C-r) lists the history lines matching what is typed
+// below the prompt, best first, like fzf. The characters typed have to
+// appear in order in a line, not necessarily next to each other (see
+// fuzzy.go), and the recent lines and the ones entered in the current
+// directory (Config.Here) rank higher. The selected line is previewed in full
+// when it doesn't fit on its row (e.g. a multi-line command).
+//
+// Tab switches to the files and directories under the current directory
+// (and back), which are previewed with their first lines or entries.
+//
+//	typing, Backspace, C-w, C-u  edit the query
+//	Up, C-p / Down, C-n, C-r     select the previous / next match
+//	Tab                          switch between the history and the files
+//	Enter                        put the history line in the buffer, or
+//	                             insert the file name at the cursor
+//	C-g, C-c, Escape             give up
+//
+// Any other key puts the selection in the buffer and is handled as usual,
+// e.g. Right to start editing it.
+
+const (
+	finderRows      = 10    // matches shown at most
+	finderPreview   = 6     // rows of the preview at most
+	finderFileLimit = 10000 // files listed at most
+)
+
+// Bonuses added to the score of a match, see fuzzy.go.
+const (
+	scoreRecent = 24 // the latest history line, less for older ones
+	scoreHere   = 16 // a history line entered in the current directory
+)
+
+const (
+	matchColor    = "\x1b[1;32m" // the characters matched
+	selectedColor = "\x1b[1m"    // the selected match
+)
+
+type finderSource int
+
+const (
+	historySource finderSource = iota
+	fileSource
+)
+
+func (source finderSource) String() string {
+	if source == fileSource {
+		return "files"
+	}
+	return "history"
+}
+
+// finderItem is a history line or a file name the finder can list.
+type finderItem struct {
+	text         string
+	runes, lower []rune
+	bonus        int // added to the score of its matches
+	index        int // history index of the line, -1 for a file
+	order        int // position in the items of its source
+	directory    bool
+}
+
+type finderMatch struct {
+	item      *finderItem
+	score     int
+	positions []int // indexes of the runes matched
+}
+
+type finder struct {
+	source   finderSource
+	items    [2][]finderItem // by source, loaded when first needed
+	loaded   [2]bool
+	query    []rune
+	filtered []rune // the query of matches, nil when they are out of date
+	matches  []finderMatch
+	selected int
+	top      int // first match shown
+}
+
+// fuzzyFind runs the fuzzy finder. It returns the key that ended it, with
+// replay set when the key is to be handled as usual.
+func (e *nativeEditor) fuzzyFind() (k key, replay bool) {
+	f := &finder{}
+	e.loadFinder(f)
+
+	for {
+		e.filterFinder(f)
+		e.renderFinder(f)
+
+		var err error
+		k, err = e.keys.readKey()
+		if err != nil {
+			return key{r: ctrl('d')}, true
+		}
+
+		switch {
+		case k == key{r: keyDown} || k == key{r: ctrl('n')} || k == key{r: ctrl('r')}:
+			if f.selected+1 < len(f.matches) {
+				f.selected++
+			} else {
+				e.bell()
+			}
+		case k == key{r: keyUp} || k == key{r: ctrl('p')}:
+			if f.selected > 0 {
+				f.selected--
+			} else {
+				e.bell()
+			}
+		case k == key{r: '\t'}:
+			f.source = 1 - f.source
+			e.loadFinder(f)
+			f.filtered = nil
+		case k == key{r: keyBackspace} || k == key{r: ctrl('h')}:
+			if len(f.query) == 0 {
+				e.bell()
+				continue
+			}
+			f.query = f.query[:len(f.query)-1]
+		case k == key{r: ctrl('w')}:
+			end := len(f.query)
+			for end > 0 && f.query[end-1] == ' ' {
+				end--
+			}
+			for end > 0 && f.query[end-1] != ' ' {
+				end--
+			}
+			f.query = f.query[:end]
+		case k == key{r: ctrl('u')}:
+			f.query = nil
+		case k == key{r: ctrl('g')} || k == key{r: ctrl('c')} || k == key{r: keyEscape}:
+			return k, false
+		case k == key{r: '\r'} || k == key{r: '\n'}:
+			e.acceptFinder(f)
+			return k, false
+		case !k.meta && k.r >= ' ' && k.r != keyBackspace:
+			f.query = append(f.query, k.r)
+		default:
+			e.acceptFinder(f)
+			return k, true
+		}
+	}
+}
+
+// loadFinder lists the items of the current source, the first time only.
+func (e *nativeEditor) loadFinder(f *finder) {
+	if f.loaded[f.source] {
+		return
+	}
+	f.loaded[f.source] = true
+	if f.source == historySource {
+		f.items[historySource] = e.historyItems()
+	} else {
+		f.items[fileSource] = fileItems()
+	}
+}
+
+// historyItems returns the distinct history lines, the latest first.
+func (e *nativeEditor) historyItems() []finderItem {
+	var here []bool
+	if e.config.Here != nil {
+		here = e.config.Here()
+	}
+
+	// A line entered in the current directory at some point ranks higher
+	// wherever it was entered last
+	hereLines := make(map[string]bool)
+	for i, line := range e.history {
+		if i < len(here) && here[i] {
+			hereLines[line] = true
+		}
+	}
+
+	seen := make(map[string]bool, len(e.history))
+	items := make([]finderItem, 0, len(e.history))
+	for i := len(e.history) - 1; i >= 0; i-- {
+		line := e.history[i]
+		if seen[line] || strings.TrimSpace(line) == "" {
+			continue
+		}
+		seen[line] = true
+
+		// Recency counts less and less with age: the latest line gets
+		// scoreRecent, then 3 less each time the age doubles
+		bonus := max(0, scoreRecent-3*bits.Len(uint(len(items))))
+		if hereLines[line] {
+			bonus += scoreHere
+		}
+		items = append(items, newFinderItem(line, bonus, i, len(items), false))
+	}
+	return items
+}
+
+// fileItems returns the files and directories under the current directory,
+// hidden ones excepted, the shallower first when they score the same.
+func fileItems() []finderItem {
+	var items []finderItem
+	filepath.WalkDir(".", func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || path == "." {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if len(items) == finderFileLimit {
+			return filepath.SkipAll
+		}
+
+		if entry.IsDir() {
+			path += "/"
+		}
+		depth := strings.Count(strings.TrimSuffix(path, "/"), "/")
+		items = append(items, newFinderItem(path, -depth, -1, len(items), entry.IsDir()))
+		return nil
+	})
+	return items
+}
+
+func newFinderItem(text string, bonus, index, order int, directory bool) finderItem {
+	runes := []rune(text)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	return finderItem{text: text, runes: runes, lower: lower, bonus: bonus, index: index, order: order, directory: directory}
+}
+
+// filterFinder matches the items against the query when it changed, best
+// first and in the order of the items for the same score. When the query
+// only grew, the items that didn't match already are left out.
+func (e *nativeEditor) filterFinder(f *finder) {
+	if f.filtered != nil && string(f.filtered) == string(f.query) {
+		return
+	}
+
+	var candidates []*finderItem
+	if f.filtered != nil && len(f.query) > len(f.filtered) && string(f.query[:len(f.filtered)]) == string(f.filtered) {
+		candidates = make([]*finderItem, len(f.matches))
+		for i, match := range f.matches {
+			candidates[i] = match.item
+		}
+	} else {
+		items := f.items[f.source]
+		candidates = make([]*finderItem, len(items))
+		for i := range items {
+			candidates[i] = &items[i]
+		}
+	}
+
+	var matches []finderMatch
+	for _, item := range candidates {
+		if score, positions, ok := fuzzyMatch(f.query, item.runes, item.lower); ok {
+			matches = append(matches, finderMatch{item: item, score: score + item.bonus, positions: positions})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].item.order < matches[j].item.order
+	})
+
+	f.matches = matches
+	f.filtered = append([]rune{}, f.query...)
+	f.selected, f.top = 0, 0
+}
+
+// acceptFinder puts the selection in the buffer: a history line replaces it,
+// a file name is inserted at the cursor.
+func (e *nativeEditor) acceptFinder(f *finder) {
+	if len(f.matches) == 0 {
+		return
+	}
+	if e.vi {
+		e.viSave()
+	}
+	item := f.matches[f.selected].item
+	if item.index >= 0 {
+		e.showHistory(item.index)
+		return
+	}
+	text := completion.Quote(strings.TrimSuffix(item.text, "/"))
+	if item.directory {
+		text += "/"
+	} else {
+		text += " "
+	}
+	e.insert([]rune(text))
+}
+
+// renderFinder draws the line, and below it the query, the matches and the
+// preview of the selected one, with the cursor after the query.
+func (e *nativeEditor) renderFinder(f *finder) {
+	e.render(e.promptText(), e.line, e.highlight(), len(e.line), nil)
+
+	width := terminalWidth(stdout)
+	rows := min(finderRows, max(1, terminalHeight(stdout)/2-2))
+	if f.selected < f.top {
+		f.top = f.selected
+	} else if f.selected >= f.top+rows {
+		f.top = f.selected - rows + 1
+	}
+
+	var out strings.Builder
+	query := f.query
+	for len(query) > 0 && 2+stringWidth(string(query)) >= width {
+		query = query[1:]
+	}
+	out.WriteString("\r\n> ")
+	for _, r := range query {
+		writeRune(&out, r)
+	}
+	counter := "  " + strconv.Itoa(len(f.matches)) + "/" + strconv.Itoa(len(f.items[f.source])) + " " + f.source.String()
+	if 2+stringWidth(string(query))+len(counter) < width {
+		out.WriteString(hintColor + counter + resetColor)
+	}
+
+	written := 0
+	for i := f.top; i < len(f.matches) && i < f.top+rows; i++ {
+		out.WriteString("\r\n")
+		writeFinderMatch(&out, f.matches[i], i == f.selected, width)
+		written++
+	}
+
+	if preview := finderPreviewLines(f, width); len(preview) > 0 {
+		out.WriteString("\r\n" + hintColor + strings.Repeat("─", width-1) + resetColor)
+		written++
+		for _, line := range preview {
+			out.WriteString("\r\n")
+			for _, r := range line {
+				writeRune(&out, r)
+			}
+			written++
+		}
+	}
+
+	if written > 0 {
+		out.WriteString("\x1b[" + strconv.Itoa(written) + "A")
+	}
+	out.WriteString("\r\x1b[" + strconv.Itoa(2+stringWidth(string(query))) + "C")
+	e.cursorRow++
+	e.write(out.String())
+}
+
+// writeFinderMatch writes a match on one row width columns wide, with the
+// characters matched in colour.
+func writeFinderMatch(out *strings.Builder, match finderMatch, selected bool, width int) {
+	style := ""
+	if selected {
+		style = selectedColor
+		out.WriteString(style + "> ")
+	} else {
+		out.WriteString("  ")
+	}
+
+	column := 2
+	positions := match.positions
+	for i, r := range match.item.runes {
+		w := runeWidth(r)
+		if column+w >= width {
+			break
+		}
+		column += w
+		if len(positions) > 0 && positions[0] == i {
+			positions = positions[1:]
+			out.WriteString(matchColor)
+			writeRune(out, r)
+			out.WriteString(resetColor + style)
+			continue
+		}
+		writeRune(out, r)
+	}
+	if selected {
+		out.WriteString(resetColor)
+	}
+}
+
+// finderPreviewLines returns the rows previewing the selected match, cut to
+// width: a history line in full when it doesn't fit on its row, the first
+// lines of a file or the entries of a directory.
+func finderPreviewLines(f *finder, width int) [][]rune {
+	if len(f.matches) == 0 {
+		return nil
+	}
+	item := f.matches[f.selected].item
+
+	var lines []string
+	switch {
+	case item.index >= 0:
+		if !strings.Contains(item.text, "\n") && 2+stringWidth(item.text) < width {
+			return nil
+		}
+		lines = strings.Split(item.text, "\n")
+	case item.directory:
+		entries, err := os.ReadDir(item.text)
+		if err != nil {
+			return nil
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() {
+				name += "/"
+			}
+			lines = append(lines, name)
+		}
+	default:
+		lines = fileHead(item.text)
+	}
+
+	// Long lines of a command wrap, the others are cut
+	var rows [][]rune
+	for _, line := range lines {
+		row := []rune(strings.ReplaceAll(line, "\t", "    "))
+		for len(rows) < finderPreview {
+			cut, column := 0, 0
+			for cut < len(row) && column+runeWidth(row[cut]) < width {
+				column += runeWidth(row[cut])
+				cut++
+			}
+			rows = append(rows, row[:cut])
+			row = row[cut:]
+			if len(row) == 0 || item.index < 0 {
+				break
+			}
+		}
+	}
+	return rows
+}
+
+// fileHead returns the first lines of a text file.
+func fileHead(name string) []string {
+	file, err := os.Open(name)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	buffer := make([]byte, 4096)
+	n, _ := file.Read(buffer)
+	head := string(buffer[:n])
+	if head == "" {
+		return nil
+	}
+	if strings.IndexByte(head, 0) >= 0 {
+		return []string{"(binary file)"}
+	}
+	lines := strings.Split(strings.TrimRight(head, "\n"), "\n")
+	return lines[:min(len(lines), finderPreview)]
+}
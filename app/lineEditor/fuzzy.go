@@ -0,0 +1,103 @@
+package lineEditor
+
+import "unicode"
+
+// Scores of a fuzzy match, in the spirit of fzf: every character of the
+// query has to be found in order in the text, and the score rewards the
+// matches that look intended (characters next to each other, at the start
+// of words) over scattered ones.
+const (
+	scoreMatch       = 16 // each character of the query
+	scoreConsecutive = 8  // right after the previous match
+	scoreWordStart   = 8  // at the start of the text or of a word
+	scoreFirstChar   = 8  // the first character of the text
+	penaltyGapStart  = 3  // skipping characters after a match
+	penaltyGapExtend = 1  // each more character skipped
+)
+
+// fuzzyMatch looks for the characters of query, in order, in text. The case
+// is ignored unless query has upper case letters (smart case, as in fzf).
+// lower is text in lower case. It returns the score of the match and the
+// indexes of the characters matched, ok is false when text doesn't match.
+//
+// Of the possible matches, the one in the shortest window ending where the
+// first full match ends is scored: "gco" in "git commit --amend; git
+// checkout" picks "git c...o" of the first command.
+func fuzzyMatch(query, text, lower []rune) (score int, positions []int, ok bool) {
+	if len(query) == 0 {
+		return 0, nil, true
+	}
+	haystack := lower
+	for _, r := range query {
+		if unicode.IsUpper(r) {
+			haystack = text
+			break
+		}
+	}
+
+	// The end of the first match
+	q := 0
+	end := -1
+	for i, r := range haystack {
+		if r == query[q] {
+			q++
+			if q == len(query) {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return 0, nil, false
+	}
+
+	// Its latest start, going back from the end
+	start := end
+	for q = len(query) - 1; ; start-- {
+		if haystack[start] == query[q] {
+			if q == 0 {
+				break
+			}
+			q--
+		}
+	}
+
+	positions = make([]int, 0, len(query))
+	q = 0
+	for i := start; i <= end && q < len(query); i++ {
+		if haystack[i] != query[q] {
+			continue
+		}
+		score += scoreMatch
+		if isWordStart(text, i) {
+			score += scoreWordStart
+		}
+		if i == 0 {
+			score += scoreFirstChar
+		}
+		if q > 0 {
+			if gap := i - positions[q-1] - 1; gap == 0 {
+				score += scoreConsecutive
+			} else {
+				score -= penaltyGapStart + (gap-1)*penaltyGapExtend
+			}
+		}
+		positions = append(positions, i)
+		q++
+	}
+	return score, positions, true
+}
+
+// isWordStart reports whether text[i] starts a word: it follows a separator
+// (a blank, punctuation or a path separator) or is an upper case letter after
+// a lower case one (camelCase).
+func isWordStart(text []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	previous := text[i-1]
+	if !unicode.IsLetter(previous) && !unicode.IsDigit(previous) {
+		return unicode.IsLetter(text[i]) || unicode.IsDigit(text[i])
+	}
+	return unicode.IsLower(previous) && unicode.IsUpper(text[i])
+}
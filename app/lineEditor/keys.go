@@ -0,0 +1,215 @@
+package lineEditor
+
+import (
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// Keys that are not characters. Characters are their rune, control keys
+// their ASCII code (see ctrl).
+const (
+	keyUp rune = -(iota + 1)
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyInsert
+	keyPageUp
+	keyPageDown
+	keyWordRight // Ctrl+Right
+	keyWordLeft  // Ctrl+Left
+	keyUnknown   // an escape sequence we don't know
+)
+
+const (
+	keyEscape    = 0x1b
+	keyBackspace = 0x7f
+)
+
+// escapeTimeout is how long after an Escape the rest of an escape sequence
+// (or a Meta key) may arrive. After that it is the Escape key alone.
+const escapeTimeout = 50 * time.Millisecond
+
+// key is a key press. meta is set for Alt+key, which terminals send as Escape
+// followed by the key.
+type key struct {
+	r    rune
+	meta bool
+}
+
+// ctrl returns the code of Ctrl+c.
+func ctrl(c byte) rune {
+	return rune(c & 0x1f)
+}
+
+// keyReader decodes the bytes typed on a terminal into keys.
+type keyReader struct {
+	fd      int
+	pending []byte
+}
+
+// readKey waits for the next key.
+func (r *keyReader) readKey() (key, error) {
+	b, err := r.readByte()
+	if err != nil {
+		return key{}, err
+	}
+	if b != keyEscape {
+		return r.decodeRune(b)
+	}
+
+	if !r.ready(escapeTimeout) {
+		return key{r: keyEscape}, nil
+	}
+	b, err = r.readByte()
+	if err != nil {
+		return key{}, err
+	}
+	switch b {
+	case '[':
+		return r.readCSI()
+	case 'O':
+		// SS3, sent by some terminals for the arrows, Home and End
+		b, err := r.readByte()
+		if err != nil {
+			return key{}, err
+		}
+		return key{r: finalKey(b)}, nil
+	case keyEscape:
+		return key{r: keyEscape, meta: true}, nil
+	}
+	k, err := r.decodeRune(b)
+	k.meta = true
+	return k, err
+}
+
+// readCSI reads the rest of an `ESC [ params final` sequence.
+func (r *keyReader) readCSI() (key, error) {
+	var params []int
+	param := 0
+	for {
+		b, err := r.readByte()
+		if err != nil {
+			return key{}, err
+		}
+		switch {
+		case b >= '0' && b <= '9':
+			param = param*10 + int(b-'0')
+			continue
+		case b == ';':
+			params = append(params, param)
+			param = 0
+			continue
+		case b < 0x40 || b > 0x7e:
+			// Intermediate bytes, not used by any key we know
+			continue
+		}
+		params = append(params, param)
+
+		k := key{r: finalKey(b)}
+		if b == '~' {
+			switch params[0] {
+			case 1, 7:
+				k.r = keyHome
+			case 2:
+				k.r = keyInsert
+			case 3:
+				k.r = keyDelete
+			case 4, 8:
+				k.r = keyEnd
+			case 5:
+				k.r = keyPageUp
+			case 6:
+				k.r = keyPageDown
+			}
+		}
+
+		// Modifiers come as a second parameter: 1 + (shift 1, alt 2, ctrl 4)
+		if len(params) > 1 {
+			modifiers := params[1] - 1
+			switch {
+			case modifiers&4 != 0 && k.r == keyRight:
+				k.r = keyWordRight
+			case modifiers&4 != 0 && k.r == keyLeft:
+				k.r = keyWordLeft
+			case modifiers&2 != 0:
+				k.meta = true
+			}
+		}
+		return k, nil
+	}
+}
+
+// finalKey maps the last byte of an arrow, Home or End sequence to its key.
+func finalKey(b byte) rune {
+	switch b {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	}
+	return keyUnknown
+}
+
+// decodeRune decodes the UTF-8 character starting with b.
+func (r *keyReader) decodeRune(b byte) (key, error) {
+	if b < utf8.RuneSelf {
+		return key{r: rune(b)}, nil
+	}
+
+	encoded := []byte{b}
+	for !utf8.FullRune(encoded) {
+		next, err := r.readByte()
+		if err != nil {
+			return key{}, err
+		}
+		encoded = append(encoded, next)
+	}
+	c, _ := utf8.DecodeRune(encoded)
+	return key{r: c}, nil
+}
+
+func (r *keyReader) readByte() (byte, error) {
+	if len(r.pending) == 0 {
+		buffer := make([]byte, 64)
+		for {
+			n, err := syscall.Read(r.fd, buffer)
+			if err == syscall.EINTR {
+				continue
+			}
+			if err != nil {
+				return 0, err
+			}
+			if n == 0 {
+				return 0, errEndOfInput
+			}
+			r.pending = buffer[:n]
+			break
+		}
+	}
+	b := r.pending[0]
+	r.pending = r.pending[1:]
+	return b, nil
+}
+
+// signaled waits for a key or a signal (see Config.Signal) and reports
+// whether a signal came first. Keys already read are handled first.
+func (r *keyReader) signaled(signalFd int) bool {
+	return len(r.pending) == 0 && signalFd >= 0 && waitInputOrSignal(r.fd, signalFd)
+}
+
+// ready reports whether a byte can be read within timeout.
+func (r *keyReader) ready(timeout time.Duration) bool {
+	return len(r.pending) > 0 || waitInput(r.fd, timeout)
+}
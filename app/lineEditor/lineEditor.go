@@ -0,0 +1,57 @@
+// Package lineEditor reads the command lines typed at the prompt.
+//
+// The default editor is written in Go (see native.go): emacs or vi (see
+// vi.go) keybindings, a kill ring, history navigation, a fuzzy history finder
+// (see finder.go), incremental search, Tab completion, autosuggestions and
+// syntax highlighting, without any C dependency.
+//
+// Building with `-tags readline` swaps it for GNU readline through cgo (see
+// readline.go), which has no autosuggestions nor highlighting. Both take the
+// history and the completion from the shell through Config.
+package lineEditor
+
+import (
+	"shelly/app/completion"
+	"shelly/app/highlight"
+)
+
+// ModeIndicator in a prompt is replaced by the editing mode, "(ins)" or
+// "(cmd)" in vi mode and nothing in emacs mode, and redrawn when it changes.
+// It is what \m in PS1 expands to.
+const ModeIndicator = "\x00mode\x00"
+
+// Editor reads one line at a time from the terminal.
+type Editor interface {
+	// ReadLine shows prompt and returns the line typed, without its newline.
+	// ok is false at the end of the input (Ctrl+D on an empty line).
+	ReadLine(prompt string) (line string, ok bool)
+}
+
+// Config connects an editor to the shell.
+type Config struct {
+	// History returns the lines of the history, oldest first. It is called
+	// once per ReadLine.
+	History func() []string
+	// Complete returns the candidates replacing line[start:end] when Tab is
+	// pressed, see completion.Engine.Complete.
+	Complete func(line string, start, end int) completion.Result
+	// Here reports, for each line returned by History, whether it was entered
+	// in the current directory: the fuzzy finder (see finder.go) ranks these
+	// lines higher. It is called when the finder is opened.
+	Here func() []bool
+	// Suggest returns the history line suggested for what is typed (see
+	// suggest.go), ok is false when there is none.
+	Suggest func(prefix string) (line string, ok bool)
+	// Highlight returns the colours of line while it is typed, see
+	// highlight.Highlighter.
+	Highlight func(line string) []highlight.Span
+	// Vi reports whether vi keybindings are used (`set -o vi`) rather than
+	// emacs ones. It is called once per ReadLine.
+	Vi func() bool
+	// Signal, when set, is called when SignalFd becomes readable while the
+	// editor waits for a key, i.e. when the shell caught a signal, to run its
+	// trap (or exit). The terminal is in its normal mode meanwhile and the
+	// line is drawn again below what the trap printed.
+	Signal   func()
+	SignalFd int
+}
@@ -0,0 +1,589 @@
+package lineEditor
+
+import (
+	"errors"
+	"os"
+	"shelly/app/completion"
+	"strings"
+	"syscall"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	stdin  = 0
+	stdout = 1
+)
+
+// killRingSize is how many killed texts M-y can cycle through.
+const killRingSize = 32
+
+var errEndOfInput = errors.New("end of input")
+
+// command is the kind of the last key handled, for the keys whose effect
+// depends on what came just before (consecutive kills, M-y, double Tab).
+type command int
+
+const (
+	otherCommand command = iota
+	killCommand
+	yankCommand
+	completeCommand
+)
+
+// nativeEditor is the line editor written in Go. In emacs mode, its keys
+// follow the ones of readline (vi mode is described in vi.go):
+//
+//	C-a, Home / C-e, End        beginning / end of line, End and C-e
+//	                            accept the suggestion (see suggest.go)
+//	C-b, Left / C-f, Right      one character back / forward, Right and C-f
+//	                            accept the suggestion
+//	M-b, C-Left / M-f, C-Right  one word back / forward
+//	Backspace, C-h / C-d, Del   delete the character before / under the cursor
+//	C-k / C-u                   kill to the end / beginning of the line
+//	C-w / M-Backspace / M-d     kill the blank separated word before, the word
+//	                            before / after the cursor
+//	C-y / M-y                   yank the last kill / cycle through older kills
+//	C-t                         transpose characters
+//	C-p, Up / C-n, Down         previous / next history line
+//	M-< / M->                   first history line / back to the new line
+//	C-r                         fuzzy history finder (see finder.go)
+//	C-s                         incremental history search, forward (C-r in
+//	                            it searches backwards)
+//	Tab                         complete, list the candidates when pressed twice
+//	C-l                         clear the screen
+//	C-c                         abandon the line
+//	C-d                         end of input on an empty line
+type nativeEditor struct {
+	config Config
+	keys   keyReader
+
+	prompt string
+	line   []rune
+	cursor int
+	// cursorRow is the screen row of the cursor, counted from the first row
+	// of the prompt, to get back there when redrawing
+	cursorRow int
+
+	history      []string
+	historyIndex int    // len(history) while editing the new line
+	newLine      []rune // the new line, saved while browsing the history
+
+	killRing           [][]rune
+	yankIndex          int // kill ring entry last yanked
+	yankStart, yankEnd int // where it was inserted
+
+	lastSearch []rune // query of the last incremental search
+	hint       []rune // rest of the suggested line, shown after the cursor
+
+	// vi mode, see vi.go
+	vi         bool      // vi keybindings for this line
+	viCommand  bool      // in command mode rather than insert mode
+	viRegister []rune    // text of the last delete or yank
+	viFind     viFind    // last f, F, t or T
+	viUndo     []viState // the line before each change
+
+	// restore puts the terminal back in its normal mode
+	restore func()
+
+	lastCommand, thisCommand command
+}
+
+func newNativeEditor(config Config) *nativeEditor {
+	return &nativeEditor{config: config, keys: keyReader{fd: stdin}}
+}
+
+// ReadLine reads a line with the editor when the shell runs in a terminal,
+// and plainly otherwise (input piped to the shell).
+func (e *nativeEditor) ReadLine(prompt string) (string, bool) {
+	if !isTerminal(stdin) || !isTerminal(stdout) {
+		return e.readPlain(prompt)
+	}
+	restore, err := makeRaw(stdin)
+	if err != nil {
+		return e.readPlain(prompt)
+	}
+	e.restore = restore
+	defer func() { e.restore() }()
+
+	e.start(prompt)
+	var k key
+	replay := false
+	for {
+		if !replay {
+			if e.config.Signal != nil && e.keys.signaled(e.config.SignalFd) {
+				e.signal()
+				continue
+			}
+			k, err = e.keys.readKey()
+			if err != nil {
+				// The terminal is gone: same as Ctrl+D
+				e.write("\r\n")
+				return "", false
+			}
+		}
+		replay = false
+
+		e.thisCommand = otherCommand
+		switch k {
+		case key{r: '\r'}, key{r: '\n'}:
+			e.finish()
+			return string(e.line), true
+		case key{r: ctrl('d')}:
+			if len(e.line) == 0 {
+				e.write("\r\n")
+				return "", false
+			}
+			e.deleteChar()
+		case key{r: ctrl('c')}:
+			// Like bash: the line is abandoned, a new prompt shows up
+			e.cursor = len(e.line)
+			e.refresh()
+			e.write("^C\r\n")
+			e.start(prompt)
+			continue
+		case key{r: ctrl('r')}:
+			// The key that ended the finder is handled below
+			k, replay = e.fuzzyFind()
+		case key{r: ctrl('s')}:
+			k, replay = e.search(true)
+		default:
+			if !e.vi {
+				e.handleKey(k)
+			} else if e.viKey(k) {
+				e.finish()
+				return string(e.line), true
+			}
+		}
+		e.lastCommand = e.thisCommand
+		e.refresh()
+	}
+}
+
+// start begins editing a new line.
+func (e *nativeEditor) start(prompt string) {
+	e.prompt = prompt
+	e.line = nil
+	e.cursor = 0
+	e.cursorRow = 0
+	e.history = nil
+	if e.config.History != nil {
+		e.history = e.config.History()
+	}
+	e.historyIndex = len(e.history)
+	e.newLine = nil
+	e.lastCommand = otherCommand
+	e.vi = e.config.Vi != nil && e.config.Vi()
+	e.viCommand = false
+	e.viUndo = nil
+	e.refresh()
+}
+
+// signal lets the shell handle a signal caught while the line is edited. Its
+// trap runs below the line with the terminal in its normal mode, like a
+// command, then the prompt and the line are drawn again.
+func (e *nativeEditor) signal() {
+	cursor := e.cursor
+	e.cursor = len(e.line)
+	e.refresh()
+	e.write("\r\n")
+	e.cursorRow = 0
+	e.restore()
+	e.config.Signal()
+	if restore, err := makeRaw(stdin); err == nil {
+		e.restore = restore
+	}
+	e.cursor = cursor
+	e.refresh()
+}
+
+// finish leaves the cursor on the line after the one accepted.
+func (e *nativeEditor) finish() {
+	e.cursor = len(e.line)
+	e.render(e.promptText(), e.line, e.highlight(), e.cursor, nil)
+	e.write("\r\n")
+	e.cursorRow = 0
+}
+
+// handleKey runs the editing command bound to k.
+func (e *nativeEditor) handleKey(k key) {
+	if k.meta {
+		switch k.r {
+		case 'b', keyLeft:
+			e.cursor = e.wordStartBefore(e.cursor)
+		case 'f', keyRight:
+			e.cursor = e.wordEndAfter(e.cursor)
+		case 'd':
+			e.kill(e.cursor, e.wordEndAfter(e.cursor))
+		case keyBackspace, ctrl('h'):
+			e.kill(e.wordStartBefore(e.cursor), e.cursor)
+		case 'y':
+			e.yankPop()
+		case '<':
+			e.historyMove(-len(e.history))
+		case '>':
+			e.historyMove(len(e.history))
+		default:
+			e.bell()
+		}
+		return
+	}
+
+	switch k.r {
+	case ctrl('a'), keyHome:
+		e.cursor = 0
+	case ctrl('e'), keyEnd:
+		if !e.acceptSuggestion() {
+			e.cursor = len(e.line)
+		}
+	case ctrl('b'), keyLeft:
+		e.cursor = e.charBefore(e.cursor)
+	case ctrl('f'), keyRight:
+		if !e.acceptSuggestion() {
+			e.cursor = e.charAfter(e.cursor)
+		}
+	case keyWordLeft:
+		e.cursor = e.wordStartBefore(e.cursor)
+	case keyWordRight:
+		e.cursor = e.wordEndAfter(e.cursor)
+	case keyBackspace, ctrl('h'):
+		if e.cursor > 0 {
+			e.deleteRange(e.charBefore(e.cursor), e.cursor)
+		}
+	case keyDelete:
+		e.deleteChar()
+	case ctrl('k'):
+		e.kill(e.cursor, len(e.line))
+	case ctrl('u'):
+		e.kill(0, e.cursor)
+	case ctrl('w'):
+		start := e.cursor
+		for start > 0 && unicode.IsSpace(e.line[start-1]) {
+			start--
+		}
+		for start > 0 && !unicode.IsSpace(e.line[start-1]) {
+			start--
+		}
+		e.kill(start, e.cursor)
+	case ctrl('y'):
+		e.yank()
+	case ctrl('t'):
+		e.transpose()
+	case ctrl('p'), keyUp:
+		e.historyMove(-1)
+	case ctrl('n'), keyDown:
+		e.historyMove(1)
+	case ctrl('l'):
+		e.write("\x1b[H\x1b[2J")
+		e.cursorRow = 0
+	case ctrl('g'):
+		e.bell()
+	case '\t':
+		e.complete()
+	default:
+		if k.r >= ' ' && k.r != keyBackspace {
+			e.insert([]rune{k.r})
+		} else {
+			e.bell()
+		}
+	}
+}
+
+// insert inserts text at the cursor and moves the cursor after it.
+func (e *nativeEditor) insert(text []rune) {
+	line := make([]rune, 0, len(e.line)+len(text))
+	line = append(line, e.line[:e.cursor]...)
+	line = append(line, text...)
+	e.line = append(line, e.line[e.cursor:]...)
+	e.cursor += len(text)
+}
+
+// deleteRange removes line[start:end] and puts the cursor at start.
+func (e *nativeEditor) deleteRange(start, end int) {
+	e.line = append(e.line[:start:start], e.line[end:]...)
+	e.cursor = start
+}
+
+func (e *nativeEditor) deleteChar() {
+	if e.cursor < len(e.line) {
+		e.deleteRange(e.cursor, e.charAfter(e.cursor))
+	}
+}
+
+// charBefore and charAfter move over one character, together with the
+// combining marks that follow it.
+func (e *nativeEditor) charBefore(pos int) int {
+	if pos > 0 {
+		pos--
+	}
+	for pos > 0 && runeWidth(e.line[pos]) == 0 {
+		pos--
+	}
+	return pos
+}
+
+func (e *nativeEditor) charAfter(pos int) int {
+	if pos < len(e.line) {
+		pos++
+	}
+	for pos < len(e.line) && runeWidth(e.line[pos]) == 0 {
+		pos++
+	}
+	return pos
+}
+
+// wordStartBefore and wordEndAfter move over a word, made of letters and
+// digits, like M-b and M-f.
+func (e *nativeEditor) wordStartBefore(pos int) int {
+	for pos > 0 && !isWordRune(e.line[pos-1]) {
+		pos--
+	}
+	for pos > 0 && isWordRune(e.line[pos-1]) {
+		pos--
+	}
+	return pos
+}
+
+func (e *nativeEditor) wordEndAfter(pos int) int {
+	for pos < len(e.line) && !isWordRune(e.line[pos]) {
+		pos++
+	}
+	for pos < len(e.line) && isWordRune(e.line[pos]) {
+		pos++
+	}
+	return pos
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// kill removes line[start:end] and saves it in the kill ring. Consecutive
+// kills are saved together, so that C-y brings them all back.
+func (e *nativeEditor) kill(start, end int) {
+	e.thisCommand = killCommand
+	if start == end {
+		return
+	}
+
+	text := append([]rune(nil), e.line[start:end]...)
+	last := len(e.killRing) - 1
+	switch {
+	case e.lastCommand == killCommand && last >= 0 && start < e.cursor:
+		e.killRing[last] = append(text, e.killRing[last]...)
+	case e.lastCommand == killCommand && last >= 0:
+		e.killRing[last] = append(e.killRing[last], text...)
+	default:
+		e.killRing = append(e.killRing, text)
+		if len(e.killRing) > killRingSize {
+			e.killRing = e.killRing[1:]
+		}
+	}
+	e.deleteRange(start, end)
+}
+
+// yank inserts the last killed text.
+func (e *nativeEditor) yank() {
+	if len(e.killRing) == 0 {
+		e.bell()
+		return
+	}
+	e.yankIndex = len(e.killRing) - 1
+	e.yankStart = e.cursor
+	e.insert(e.killRing[e.yankIndex])
+	e.yankEnd = e.cursor
+	e.thisCommand = yankCommand
+}
+
+// yankPop replaces the text just yanked with the previous kill.
+func (e *nativeEditor) yankPop() {
+	if e.lastCommand != yankCommand {
+		e.bell()
+		return
+	}
+	e.deleteRange(e.yankStart, e.yankEnd)
+	e.yankIndex = (e.yankIndex + len(e.killRing) - 1) % len(e.killRing)
+	e.insert(e.killRing[e.yankIndex])
+	e.yankEnd = e.cursor
+	e.thisCommand = yankCommand
+}
+
+// transpose swaps the characters before and under the cursor, or the last
+// two at the end of the line, and moves forward.
+func (e *nativeEditor) transpose() {
+	if len(e.line) < 2 || e.cursor == 0 {
+		e.bell()
+		return
+	}
+	if e.cursor == len(e.line) {
+		e.cursor--
+	}
+	e.line[e.cursor-1], e.line[e.cursor] = e.line[e.cursor], e.line[e.cursor-1]
+	e.cursor++
+}
+
+// historyMove moves by offset lines in the history. The new line being typed
+// is kept while browsing and comes back after the last history line.
+func (e *nativeEditor) historyMove(offset int) {
+	index := max(0, min(len(e.history), e.historyIndex+offset))
+	if index == e.historyIndex {
+		e.bell()
+		return
+	}
+	e.showHistory(index)
+}
+
+// showHistory puts the history line at index (the new line for
+// len(history)) in the buffer, with the cursor at its end.
+func (e *nativeEditor) showHistory(index int) {
+	if e.historyIndex == len(e.history) {
+		e.newLine = e.line
+	}
+	e.historyIndex = index
+	if index == len(e.history) {
+		e.line = e.newLine
+	} else {
+		e.line = []rune(e.history[index])
+	}
+	e.cursor = len(e.line)
+}
+
+// complete completes the word before the cursor. With several candidates the
+// common prefix is inserted; when there is none to add, a second Tab lists
+// the candidates.
+func (e *nativeEditor) complete() {
+	e.thisCommand = completeCommand
+	if e.config.Complete == nil {
+		e.bell()
+		return
+	}
+
+	text := string(e.line)
+	end := len(string(e.line[:e.cursor]))
+	start := completion.WordStart(text, end)
+	result := e.config.Complete(text, start, end)
+	candidates := result.Candidates
+
+	var insert string
+	switch len(candidates) {
+	case 0:
+		e.bell()
+		return
+	case 1:
+		insert = candidates[0]
+		if !strings.HasSuffix(insert, "/") {
+			insert += " "
+		}
+	default:
+		insert = commonPrefix(candidates)
+		if len(insert) <= end-start {
+			if e.lastCommand == completeCommand {
+				e.listCandidates(candidates, result.Filenames)
+			} else {
+				e.bell()
+			}
+			return
+		}
+	}
+
+	word := []rune(text[start:end])
+	e.deleteRange(e.cursor-len(word), e.cursor)
+	e.insert([]rune(insert))
+}
+
+// listCandidates prints the candidates in columns below the line, then
+// redraws the line. Paths are listed by their last component.
+func (e *nativeEditor) listCandidates(candidates []string, filenames bool) {
+	names := make([]string, len(candidates))
+	longest := 0
+	for i, candidate := range candidates {
+		if filenames {
+			if slash := strings.LastIndexByte(strings.TrimSuffix(candidate, "/"), '/'); slash >= 0 {
+				candidate = candidate[slash+1:]
+			}
+		}
+		names[i] = candidate
+		longest = max(longest, stringWidth(candidate))
+	}
+
+	columnWidth := longest + 2
+	columns := max(1, terminalWidth(stdout)/columnWidth)
+	rows := (len(names) + columns - 1) / columns
+
+	cursor := e.cursor
+	e.cursor = len(e.line)
+	e.refresh()
+	e.cursor = cursor
+
+	var out strings.Builder
+	out.WriteString("\r\n")
+	for row := 0; row < rows; row++ {
+		for column := 0; column < columns; column++ {
+			i := column*rows + row
+			if i >= len(names) {
+				break
+			}
+			out.WriteString(names[i])
+			if column < columns-1 && i+rows < len(names) {
+				out.WriteString(strings.Repeat(" ", columnWidth-stringWidth(names[i])))
+			}
+		}
+		out.WriteString("\r\n")
+	}
+	e.write(out.String())
+	e.cursorRow = 0
+}
+
+// commonPrefix returns the longest prefix shared by all the words.
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		n := 0
+		for n < len(prefix) && n < len(word) && prefix[n] == word[n] {
+			n++
+		}
+		prefix = prefix[:n]
+	}
+	// Don't cut a UTF-8 character in the middle
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
+
+// readPlain reads a line when the input is not a terminal. The bytes are read
+// one at a time so that the commands run get the rest of the input. Like
+// readline, the prompt and the line are echoed.
+func (e *nativeEditor) readPlain(prompt string) (string, bool) {
+	os.Stdout.WriteString(prompt)
+
+	var line []byte
+	buffer := make([]byte, 1)
+	for {
+		n, err := syscall.Read(stdin, buffer)
+		if err == syscall.EINTR {
+			continue
+		}
+		if n <= 0 {
+			if len(line) == 0 {
+				return "", false
+			}
+			break
+		}
+		if buffer[0] == '\n' {
+			break
+		}
+		line = append(line, buffer[0])
+	}
+
+	os.Stdout.WriteString(string(line) + "\n")
+	return string(line), true
+}
+
+func (e *nativeEditor) bell() {
+	e.write("\a")
+}
+
+func (e *nativeEditor) write(text string) {
+	os.Stdout.WriteString(text)
+}
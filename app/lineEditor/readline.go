@@ -0,0 +1,90 @@
+//go:build readline
+
+package lineEditor
+
+/*
+#cgo LDFLAGS: -lreadline
+#include <stdlib.h>
+#include <stdio.h>
+#include <readline/readline.h>
+#include <readline/history.h>
+#include "readline_helper.h"
+*/
+import "C"
+
+import (
+	"strings"
+	"unsafe"
+)
+
+// readlineConfig is the configuration of the readline editor, for the
+// completion hooks called from C.
+var readlineConfig Config
+
+// readlineEditor reads lines with GNU readline.
+type readlineEditor struct{}
+
+// New returns the GNU readline editor. There is only one readline, the last
+// config given wins.
+func New(config Config) Editor {
+	readlineConfig = config
+	C.using_history()
+	// Used to setup the command completion via TAB
+	C.setup_completion()
+	// Same mode strings as the native editor
+	bindVariable("emacs-mode-string", "")
+	bindVariable("vi-ins-mode-string", "(ins)")
+	bindVariable("vi-cmd-mode-string", "(cmd)")
+	signalFd := -1
+	if config.Signal != nil {
+		signalFd = config.SignalFd
+	}
+	C.watch_signals(C.int(signalFd))
+	return readlineEditor{}
+}
+
+// ReadLine rebuilds readline's history list from Config.History, so the
+// arrow keys scroll through it, then reads a line.
+func (readlineEditor) ReadLine(prompt string) (string, bool) {
+	C.clear_history()
+	if readlineConfig.History != nil {
+		for _, line := range readlineConfig.History() {
+			cLine := C.CString(line)
+			C.add_history(cLine)
+			C.free(unsafe.Pointer(cLine))
+		}
+	}
+
+	mode := "emacs"
+	if readlineConfig.Vi != nil && readlineConfig.Vi() {
+		mode = "vi"
+	}
+	bindVariable("editing-mode", mode)
+
+	// readline shows the mode at the start of the prompt, wherever \m is
+	showMode := "off"
+	if strings.Contains(prompt, ModeIndicator) {
+		showMode = "on"
+		prompt = strings.ReplaceAll(prompt, ModeIndicator, "")
+	}
+	bindVariable("show-mode-in-prompt", showMode)
+
+	cPrompt := C.CString(prompt)
+	defer C.free(unsafe.Pointer(cPrompt))
+
+	line := C.readline(cPrompt)
+	if line == nil {
+		return "", false // EOF (Ctrl+D)
+	}
+	defer C.free(unsafe.Pointer(line))
+
+	return C.GoString(line), true
+}
+
+// bindVariable sets a readline variable, like `set name value` in inputrc.
+func bindVariable(name, value string) {
+	cName, cValue := C.CString(name), C.CString(value)
+	C.rl_variable_bind(cName, cValue)
+	C.free(unsafe.Pointer(cName))
+	C.free(unsafe.Pointer(cValue))
+}
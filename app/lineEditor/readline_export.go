@@ -0,0 +1,60 @@
+//go:build readline
+
+package lineEditor
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"shelly/app/completion"
+	"unsafe"
+)
+
+// shellyComplete is the readline completion hook (see readline_helper.c). It
+// returns the candidates for the word between start and end of line as a
+// NULL terminated array allocated with malloc, like the strings in it.
+// readline takes ownership of the strings, the caller frees the array.
+// *filenames is set when the candidates are paths.
+//
+//export shellyComplete
+func shellyComplete(line *C.char, start, end C.int, filenames *C.int) **C.char {
+	var result completion.Result
+	if readlineConfig.Complete != nil {
+		result = readlineConfig.Complete(C.GoString(line), int(start), int(end))
+	}
+
+	*filenames = 0
+	if result.Filenames {
+		*filenames = 1
+	}
+
+	size := C.size_t(len(result.Candidates)+1) * C.size_t(unsafe.Sizeof((*C.char)(nil)))
+	array := (**C.char)(C.malloc(size))
+	candidates := unsafe.Slice(array, len(result.Candidates)+1)
+	for i, candidate := range result.Candidates {
+		candidates[i] = C.CString(candidate)
+	}
+	candidates[len(result.Candidates)] = nil
+	return array
+}
+
+// shellyCharIsQuoted tells readline whether the character at index of line is
+// quoted, so that `my\ file` or `"a b"` is completed as a single word.
+//
+//export shellyCharIsQuoted
+func shellyCharIsQuoted(line *C.char, index C.int) C.int {
+	if completion.IsQuoted(C.GoString(line), int(index)) {
+		return 1
+	}
+	return 0
+}
+
+// shellySignal is called by readline (see wait_key in readline_helper.c) when
+// the shell caught a signal while a line is read, to run its trap.
+//
+//export shellySignal
+func shellySignal() {
+	readlineConfig.Signal()
+}
@@ -0,0 +1,135 @@
+//go:build readline
+
+#include <errno.h>
+#include <poll.h>
+#include <stdlib.h>
+#include <string.h>
+#include <readline/readline.h>
+#include <readline/history.h>
+#include "_cgo_export.h"
+
+// The candidates of the completion in progress, computed on the Go side (see
+// shellyComplete in readline_export.go) as a NULL terminated array.
+static char** candidates = NULL;
+
+// candidate_generator is called repeatedly by readline with state 0, 1, 2...
+// and returns one candidate per call, NULL when there is no more. readline
+// frees the strings.
+char* candidate_generator(const char* text, int state) {
+    return candidates[state];
+}
+
+// display_file_matches lists path candidates by their last component, like
+// readline does for its own filename completion. matches[0] is the common
+// prefix, the candidates are matches[1..len].
+void display_file_matches(char** matches, int len, int max) {
+    char** names = malloc((len + 2) * sizeof(char*));
+    int longest = 0;
+
+    names[0] = matches[0];
+    for (int i = 1; i <= len; i++) {
+        char* name = matches[i];
+        size_t n = strlen(name);
+        // A directory keeps its trailing '/': look for the slash before it
+        for (size_t j = n > 1 ? n - 1 : 0; j > 0; j--) {
+            if (name[j - 1] == '/') {
+                name += j;
+                break;
+            }
+        }
+        names[i] = name;
+        if ((int)strlen(name) > longest) {
+            longest = strlen(name);
+        }
+    }
+    names[len + 1] = NULL;
+
+    rl_display_match_list(names, len, longest);
+    rl_forced_update_display();
+    free(names);
+}
+
+char** my_completion(const char* text, int start, int end) {
+    int filenames = 0;
+    candidates = shellyComplete(rl_line_buffer, start, end, &filenames);
+
+    // The Go side also decides about filenames, readline must not fall back
+    // to its own completion. The candidates come quoted, with the closing
+    // quote or the '/' of directories, so readline doesn't touch them.
+    rl_attempted_completion_over = 1;
+    rl_filename_completion_desired = 0;
+    rl_completion_suppress_quote = 1;
+    rl_completion_display_matches_hook = filenames ? display_file_matches : NULL;
+
+    // No space after a directory: the completion goes on inside it
+    if (candidates[0] && !candidates[1]) {
+        size_t n = strlen(candidates[0]);
+        rl_completion_suppress_append = n > 0 && candidates[0][n - 1] == '/';
+    }
+
+    char** matches = rl_completion_matches(text, candidate_generator);
+    free(candidates);
+    candidates = NULL;
+    return matches;
+}
+
+// char_is_quoted tells readline whether a word break character is quoted.
+int char_is_quoted(char* line, int index) {
+    return shellyCharIsQuoted(line, index);
+}
+
+// Set the completion function
+void setup_completion() {
+    rl_attempted_completion_function = my_completion;
+    // Words end at blanks and at the shell operators, so that `ls|gr` and
+    // `cat >fi` complete what follows the operator. '$' is kept in the word:
+    // the Go side completes variable names when the word starts with it.
+    // Must match wordBreaks in the completion package.
+    rl_completer_word_break_characters = " \t\n|&;<>(";
+    // Quoted blanks and operators don't break words (`my\ file`, "a b")
+    rl_completer_quote_characters = "'\"";
+    rl_char_is_quoted_p = char_is_quoted;
+}
+
+// signal_fd becomes readable when the shell catches a signal, -1 when
+// signals are not watched (see watch_signals).
+static int signal_fd = -1;
+
+// wait_key reads a key like rl_getc, but lets the shell handle the signals
+// caught while it waits: the trap runs below the line with the terminal in
+// its normal mode, then the prompt and the line are drawn again.
+static int wait_key(FILE* stream) {
+    while (signal_fd >= 0) {
+        struct pollfd fds[2] = {{fileno(stream), POLLIN, 0}, {signal_fd, POLLIN, 0}};
+        if (poll(fds, 2, -1) < 0) {
+            if (errno == EINTR) {
+                continue;
+            }
+            break;
+        }
+        if (!(fds[1].revents & POLLIN)) {
+            break;
+        }
+
+        int point = rl_point;
+        rl_point = rl_end;
+        rl_redisplay();
+        rl_crlf();
+        rl_deprep_terminal();
+        shellySignal();
+        rl_prep_terminal(1);
+        rl_point = point;
+        rl_on_new_line();
+        rl_redisplay();
+    }
+    return rl_getc(stream);
+}
+
+// Read the keys with wait_key, fd is watched along with the terminal. The
+// signals must reach the shell's handlers rather than readline's, which only
+// look at them when a read is interrupted.
+void watch_signals(int fd) {
+    signal_fd = fd;
+    rl_getc_function = wait_key;
+    rl_catch_signals = fd < 0;
+}
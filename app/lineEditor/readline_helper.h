@@ -1,8 +1,10 @@
+//go:build readline
+
 // readline_helper.h
 #ifndef READLINE_HELPER_H
 #define READLINE_HELPER_H
 
 void setup_completion();
-char* readline_wrapper(const char* prompt);
+void watch_signals(int fd);
 
-#endif
\ No newline at end of file
+#endif
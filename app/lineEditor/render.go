@@ -0,0 +1,220 @@
+package lineEditor
+
+import (
+	"shelly/app/highlight"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	hintColor  = "\x1b[90m" // grey
+	resetColor = "\x1b[0m"
+)
+
+// refresh redraws the prompt and the line, highlighted, with the suggestion
+// for it.
+func (e *nativeEditor) refresh() {
+	e.suggest()
+	e.render(e.promptText(), e.line, e.highlight(), e.cursor, e.hint)
+}
+
+// highlight returns the colour (SGR parameters) of each rune of the line from
+// Config.Highlight, nil when there is none.
+func (e *nativeEditor) highlight() []string {
+	if e.config.Highlight == nil || len(e.line) == 0 {
+		return nil
+	}
+	line := string(e.line)
+	spans := e.config.Highlight(line)
+	if len(spans) == 0 {
+		return nil
+	}
+
+	// The spans are in bytes: walk the runes with their byte offsets
+	colors := make([]string, len(e.line))
+	var span highlight.Span
+	i := 0
+	for offset := range line {
+		for len(spans) > 0 && spans[0].Start <= offset {
+			span, spans = spans[0], spans[1:]
+		}
+		if offset >= span.Start && offset < span.End {
+			colors[i] = span.Color
+		}
+		i++
+	}
+	return colors
+}
+
+// promptText returns the prompt with the mode indicator in place.
+func (e *nativeEditor) promptText() string {
+	indicator := ""
+	if e.vi && e.viCommand {
+		indicator = "(cmd)"
+	} else if e.vi {
+		indicator = "(ins)"
+	}
+	return strings.ReplaceAll(e.prompt, ModeIndicator, indicator)
+}
+
+// render redraws prompt and line in place of what was shown, each rune of line
+// in its colour from colors (if any), followed by hint in grey, and puts the
+// cursor before line[cursor]. Long lines wrap on the following rows, so the
+// rows are computed the way the terminal fills them.
+func (e *nativeEditor) render(prompt string, line []rune, colors []string, cursor int, hint []rune) {
+	width := terminalWidth(stdout)
+	var out strings.Builder
+
+	// Back to the first row of the prompt, and clear from there
+	if e.cursorRow > 0 {
+		out.WriteString("\x1b[" + strconv.Itoa(e.cursorRow) + "A")
+	}
+	out.WriteString("\r\x1b[J")
+
+	out.WriteString(strings.NewReplacer("\x01", "", "\x02", "").Replace(prompt))
+	color := ""
+	for i, r := range line {
+		if colors != nil && colors[i] != color {
+			color = colors[i]
+			out.WriteString(resetColor)
+			if color != "" {
+				out.WriteString("\x1b[" + color + "m")
+			}
+		}
+		writeRune(&out, r)
+	}
+	if color != "" {
+		out.WriteString(resetColor)
+	}
+	if len(hint) > 0 {
+		out.WriteString(hintColor)
+		for _, r := range hint {
+			writeRune(&out, r)
+		}
+		out.WriteString(resetColor)
+	}
+
+	promptRow, promptColumn := place(0, 0, width, []rune(prompt), true)
+	endRow, endColumn := place(promptRow, promptColumn, width, line, false)
+	endRow, endColumn = place(endRow, endColumn, width, hint, false)
+	// At the last column the terminal only wraps when the next character
+	// comes: wrap now so that the cursor is where we think it is
+	if endColumn == width {
+		out.WriteString("\r\n")
+		endRow, endColumn = endRow+1, 0
+	}
+
+	row, column := place(promptRow, promptColumn, width, line[:cursor], false)
+	if column == width {
+		row, column = row+1, 0
+	}
+	if endRow > row {
+		out.WriteString("\x1b[" + strconv.Itoa(endRow-row) + "A")
+	}
+	out.WriteString("\r")
+	if column > 0 {
+		out.WriteString("\x1b[" + strconv.Itoa(column) + "C")
+	}
+
+	e.cursorRow = row
+	e.write(out.String())
+}
+
+// place returns where the cursor ends up after printing text from row, column
+// on a terminal width columns wide. In a prompt, the escape sequences (e.g.
+// colours) and the text between \001 and \002 take no room, as in bash.
+func place(row, column, width int, text []rune, prompt bool) (int, int) {
+	for i := 0; i < len(text); i++ {
+		r := text[i]
+		if prompt {
+			switch r {
+			case '\x01':
+				for i < len(text) && text[i] != '\x02' {
+					i++
+				}
+				continue
+			case '\x1b':
+				i = skipEscape(text, i)
+				continue
+			case '\n':
+				row, column = row+1, 0
+				continue
+			case '\r':
+				column = 0
+				continue
+			}
+		}
+
+		w := runeWidth(r)
+		if column+w > width {
+			row, column = row+1, 0
+		}
+		column += w
+	}
+	return row, column
+}
+
+// skipEscape returns the index of the last rune of the escape sequence
+// starting at text[i].
+func skipEscape(text []rune, i int) int {
+	if i+1 >= len(text) || text[i+1] != '[' {
+		return i + 1
+	}
+	for i += 2; i < len(text); i++ {
+		if text[i] >= 0x40 && text[i] <= 0x7e {
+			return i
+		}
+	}
+	return i
+}
+
+// writeRune writes r as shown in the line: control characters (e.g. the
+// newlines of a multi-line command from the history) as ^X.
+func writeRune(out *strings.Builder, r rune) {
+	if r < ' ' || r == 0x7f {
+		out.WriteByte('^')
+		out.WriteByte(byte(r) ^ 0x40)
+		return
+	}
+	out.WriteRune(r)
+}
+
+// runeWidth returns the number of columns r takes on the terminal: 0 for
+// combining marks, 2 for wide (East Asian, emoji) characters and for the
+// control characters shown as ^X.
+func runeWidth(r rune) int {
+	switch {
+	case r < ' ' || r == 0x7f:
+		return 2
+	case r < 0x300:
+		return 1
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0x303e,
+		r >= 0x3041 && r <= 0x33ff,
+		r >= 0x3400 && r <= 0x4dbf,
+		r >= 0x4e00 && r <= 0x9fff,
+		r >= 0xa000 && r <= 0xa4cf,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
+
+// stringWidth returns the number of columns text takes on the terminal.
+func stringWidth(text string) int {
+	width := 0
+	for _, r := range text {
+		width += runeWidth(r)
+	}
+	return width
+}
@@ -0,0 +1,162 @@
+package lineEditor
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// search runs an incremental search through the history, backwards (C-r) or
+// forwards (C-s). The history line matching what is typed so far is shown;
+// C-r and C-s look for the next match, Backspace goes back to the previous
+// one and C-g gives up. Any other key ends the search with the match in the
+// buffer and is returned to be handled as usual (replay is set), so that
+// Enter runs the line found and Left starts editing it.
+func (e *nativeEditor) search(forward bool) (k key, replay bool) {
+	// A match is a history index and a byte offset in that line; the index
+	// is len(history) before anything matched
+	type match struct {
+		index, offset int
+		failed        bool
+	}
+	current := match{index: e.historyIndex, offset: len(string(e.line[:e.cursor]))}
+	var query []rune
+	var previous []match // the match for each shorter query
+
+	text := func(index int) string {
+		if index == len(e.history) {
+			return string(e.line)
+		}
+		return e.history[index]
+	}
+
+	for {
+		e.renderSearch(forward, current.failed, query, text(current.index), current.offset)
+
+		var err error
+		k, err = e.keys.readKey()
+		if err != nil {
+			return key{r: ctrl('d')}, true
+		}
+
+		switch {
+		case k == key{r: ctrl('r')} || k == key{r: ctrl('s')}:
+			forward = k.r == ctrl('s')
+			if len(query) == 0 {
+				// Search again for the previous query
+				for range e.lastSearch {
+					previous = append(previous, current)
+				}
+				query = append(query, e.lastSearch...)
+				if found, ok := e.find(string(query), current.index, current.offset, forward, false); ok {
+					current = match{index: found.index, offset: found.offset}
+				} else if len(query) > 0 {
+					current.failed = true
+					e.bell()
+				}
+				continue
+			}
+			if found, ok := e.find(string(query), current.index, current.offset, forward, true); ok {
+				current = match{index: found.index, offset: found.offset}
+			} else {
+				current.failed = true
+				e.bell()
+			}
+		case k == key{r: keyBackspace} || k == key{r: ctrl('h')}:
+			if len(query) == 0 {
+				e.bell()
+				continue
+			}
+			query = query[:len(query)-1]
+			current = previous[len(previous)-1]
+			previous = previous[:len(previous)-1]
+		case k == key{r: ctrl('g')}:
+			e.bell()
+			return k, false
+		case !k.meta && k.r >= ' ' && k.r != keyBackspace:
+			previous = append(previous, current)
+			query = append(query, k.r)
+			if current.failed {
+				continue
+			}
+			if found, ok := e.find(string(query), current.index, current.offset, forward, false); ok {
+				current = match{index: found.index, offset: found.offset}
+			} else {
+				current.failed = true
+				e.bell()
+			}
+		default:
+			if len(query) > 0 {
+				e.lastSearch = query
+			}
+			if current.index != e.historyIndex {
+				e.showHistory(current.index)
+			}
+			if current.index < len(e.history) {
+				e.cursor = utf8.RuneCountInString(text(current.index)[:current.offset])
+			}
+			// Escape only ends the search
+			return k, k != key{r: keyEscape}
+		}
+	}
+}
+
+// find looks for query in the history from the line at index, offset. With
+// next set, the match at offset itself is skipped.
+func (e *nativeEditor) find(query string, index, offset int, forward, next bool) (found struct{ index, offset int }, ok bool) {
+	if query == "" {
+		return found, false
+	}
+
+	if forward {
+		if next {
+			offset++
+		}
+		for i := index; i < len(e.history); i++ {
+			line := e.history[i]
+			start := 0
+			if i == index {
+				start = min(offset, len(line))
+			}
+			if j := strings.Index(line[start:], query); j >= 0 {
+				found.index, found.offset = i, start+j
+				return found, true
+			}
+		}
+		return found, false
+	}
+
+	for i := min(index, len(e.history)-1); i >= 0; i-- {
+		line := e.history[i]
+		end := len(line)
+		if i == index {
+			// A match starting at offset (or before it, when skipping it)
+			end = offset + len(query)
+			if next {
+				end--
+			}
+			end = max(0, min(end, len(line)))
+		}
+		if j := strings.LastIndex(line[:end], query); j >= 0 {
+			found.index, found.offset = i, j
+			return found, true
+		}
+	}
+	return found, false
+}
+
+// renderSearch shows the search prompt in place of the shell prompt, with the
+// matching line and the cursor on the match.
+func (e *nativeEditor) renderSearch(forward, failed bool, query []rune, line string, offset int) {
+	var prompt strings.Builder
+	prompt.WriteString("(")
+	if failed {
+		prompt.WriteString("failed ")
+	}
+	if !forward {
+		prompt.WriteString("reverse-")
+	}
+	prompt.WriteString("i-search)`" + string(query) + "': ")
+
+	offset = min(offset, len(line))
+	e.render(prompt.String(), []rune(line), nil, utf8.RuneCountInString(line[:offset]), nil)
+}
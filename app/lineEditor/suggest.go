@@ -0,0 +1,31 @@
+package lineEditor
+
+// Autosuggestions, as in fish: while the cursor is at the end of the line,
+// the rest of the most recent history line starting with what is typed is
+// shown in grey after it (Config.Suggest decides which line). Right or End
+// (C-f, C-e) accept it; any other key ignores it.
+
+// suggest updates the suggestion for the line.
+func (e *nativeEditor) suggest() {
+	e.hint = nil
+	if e.config.Suggest == nil || len(e.line) == 0 || e.cursor != len(e.line) {
+		return
+	}
+	if line, ok := e.config.Suggest(string(e.line)); ok {
+		// The suggestion starts with the line, the runes of both match
+		if suggested := []rune(line); len(suggested) > len(e.line) {
+			e.hint = suggested[len(e.line):]
+		}
+	}
+}
+
+// acceptSuggestion completes the line with the suggestion shown. It returns
+// false when there is none.
+func (e *nativeEditor) acceptSuggestion() bool {
+	if len(e.hint) == 0 || e.cursor != len(e.line) {
+		return false
+	}
+	e.insert(e.hint)
+	e.hint = nil
+	return true
+}
@@ -0,0 +1,101 @@
+package lineEditor
+
+import (
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// isTerminal reports whether fd is a terminal.
+func isTerminal(fd int) bool {
+	var termios syscall.Termios
+	return ioctl(fd, syscall.TCGETS, unsafe.Pointer(&termios)) == nil
+}
+
+// makeRaw puts the terminal in raw mode: no line buffering, no echo and no
+// signal keys, so the editor sees every key (Ctrl+C included) as it is
+// typed. Output processing is kept, "\n" still moves to the next line.
+// restore puts the terminal back as it was.
+func makeRaw(fd int) (restore func(), err error) {
+	var saved syscall.Termios
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&saved)); err != nil {
+		return nil, err
+	}
+
+	raw := saved
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Cflag |= syscall.CS8
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, syscall.TCSETS, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		ioctl(fd, syscall.TCSETS, unsafe.Pointer(&saved))
+	}, nil
+}
+
+// terminalWidth returns the number of columns of the terminal, 80 when it
+// can't be known. It is asked on every redraw, so resizing just works.
+func terminalWidth(fd int) int {
+	if cols, _ := windowSize(fd); cols > 0 {
+		return cols
+	}
+	return 80
+}
+
+// terminalHeight returns the number of rows of the terminal, 24 when it
+// can't be known.
+func terminalHeight(fd int) int {
+	if _, rows := windowSize(fd); rows > 0 {
+		return rows
+	}
+	return 24
+}
+
+// windowSize returns the size of the terminal, 0 by 0 when it can't be known.
+func windowSize(fd int) (cols, rows int) {
+	var size struct {
+		rows, cols, xpixels, ypixels uint16
+	}
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&size)); err != nil {
+		return 0, 0
+	}
+	return int(size.cols), int(size.rows)
+}
+
+// waitInput waits up to timeout for fd to be readable.
+func waitInput(fd int, timeout time.Duration) bool {
+	var readable syscall.FdSet
+	// fd is the standard input, it fits in the first word of the set
+	readable.Bits[0] |= 1 << uint(fd)
+	tv := syscall.NsecToTimeval(timeout.Nanoseconds())
+	n, err := syscall.Select(fd+1, &readable, nil, nil, &tv)
+	return err == nil && n > 0
+}
+
+// waitInputOrSignal waits for fd or signalFd to be readable and reports
+// whether signalFd is.
+func waitInputOrSignal(fd, signalFd int) bool {
+	for {
+		var readable syscall.FdSet
+		readable.Bits[fd/64] |= 1 << uint(fd%64)
+		readable.Bits[signalFd/64] |= 1 << uint(signalFd%64)
+		_, err := syscall.Select(max(fd, signalFd)+1, &readable, nil, nil, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		// On error, the read that follows reports it
+		return err == nil && readable.Bits[signalFd/64]&(1<<uint(signalFd%64)) != 0
+	}
+}
+
+func ioctl(fd int, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
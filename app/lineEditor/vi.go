@@ -0,0 +1,554 @@
+package lineEditor
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// Vi mode (`set -o vi`). A line starts in insert mode, where keys insert text
+// as in emacs mode. Escape switches to command mode:
+//
+//	h l 0 ^ $ | w W b B e E     motions, most take a count (3w)
+//	f F t T + char, ; ,         to a character of the line, repeat, reverse
+//	i a I A                     insert before / after the cursor, at the
+//	                            first non-blank / the end of the line
+//	x X s S D C Y r ~           as in vi
+//	d c y + motion              delete, change, yank: dw, c$, y2b, dtx...
+//	dd cc yy                    the whole line
+//	d c y + iw aw iW aW         word text objects: diw, caw
+//	p P                         put the text deleted or yanked after / before
+//	u                           undo the last change
+//	k j (- +, Up Down)          previous / next history line
+//	v                           edit the line in $VISUAL or $EDITOR, then run it
+//
+// Enter, C-r, C-c and C-d work in both modes.
+
+// viUndoSize is how many changes u can undo.
+const viUndoSize = 100
+
+// viFind is the last f, F, t or T command, repeated by ; and ,.
+type viFind struct {
+	command rune // 'f', 'F', 't' or 'T', 0 before the first one
+	target  rune
+}
+
+// viState is the line before a change, for u.
+type viState struct {
+	line   []rune
+	cursor int
+}
+
+// viKey handles k in vi mode. It returns true when the line is to be run
+// (after `v`).
+func (e *nativeEditor) viKey(k key) bool {
+	if !e.viCommand {
+		switch {
+		case k == key{r: keyEscape}:
+			e.viEnterCommand()
+			return false
+		case k.meta && k.r >= 0:
+			// Escape quickly followed by a command arrives as a Meta key
+			e.viEnterCommand()
+			k.meta = false
+		default:
+			e.handleKey(k)
+			return false
+		}
+	}
+
+	run := e.viCommandKey(k)
+	// In command mode the cursor is on a character, not after the last one
+	if e.viCommand && e.cursor > 0 && e.cursor >= len(e.line) {
+		e.cursor = e.charBefore(len(e.line))
+	}
+	return run
+}
+
+// viEnterCommand switches to command mode. Like vi, the cursor moves back
+// onto the last character inserted.
+func (e *nativeEditor) viEnterCommand() {
+	e.viCommand = true
+	e.cursor = e.charBefore(e.cursor)
+}
+
+// viInsert switches to insert mode with the cursor at pos. The whole insert
+// is undone at once, so the caller saves the line before.
+func (e *nativeEditor) viInsert(pos int) {
+	e.cursor = pos
+	e.viCommand = false
+}
+
+// viCommandKey runs the command starting with k.
+func (e *nativeEditor) viCommandKey(k key) bool {
+	count, k, ok := e.viCount(k)
+	if !ok {
+		return false
+	}
+
+	switch k.r {
+	case 'i':
+		e.viSave()
+		e.viInsert(e.cursor)
+	case 'a':
+		e.viSave()
+		e.viInsert(e.charAfter(e.cursor))
+	case 'I':
+		e.viSave()
+		e.viInsert(e.viFirstNonBlank())
+	case 'A':
+		e.viSave()
+		e.viInsert(len(e.line))
+	case 'x', keyDelete:
+		e.viOperate('d', e.cursor, e.repeat(e.charAfter, e.cursor, count))
+	case 'X':
+		e.viOperate('d', e.repeat(e.charBefore, e.cursor, count), e.cursor)
+	case 's':
+		e.viOperate('c', e.cursor, e.repeat(e.charAfter, e.cursor, count))
+	case 'S':
+		e.viOperate('c', 0, len(e.line))
+	case 'D':
+		e.viOperate('d', e.cursor, len(e.line))
+	case 'C':
+		e.viOperate('c', e.cursor, len(e.line))
+	case 'Y':
+		e.viOperate('y', 0, len(e.line))
+	case 'd', 'c', 'y':
+		e.viOperator(k.r, count)
+	case 'p', 'P':
+		e.viPut(k.r == 'p', count)
+	case 'r':
+		e.viReplace(count)
+	case '~':
+		e.viSave()
+		for ; count > 0 && e.cursor < len(e.line); count-- {
+			r := e.line[e.cursor]
+			if unicode.IsUpper(r) {
+				e.line[e.cursor] = unicode.ToLower(r)
+			} else {
+				e.line[e.cursor] = unicode.ToUpper(r)
+			}
+			e.cursor++
+		}
+	case 'u':
+		e.viUndoChange()
+	case 'k', '-', keyUp, ctrl('p'):
+		e.historyMove(-count)
+		e.cursor = 0
+	case 'j', '+', keyDown, ctrl('n'):
+		e.historyMove(count)
+		e.cursor = 0
+	case 'v':
+		return e.editInEditor()
+	case keyEscape:
+		e.bell()
+	default:
+		if pos, _, ok := e.viMotion(k, count); ok {
+			e.cursor = pos
+		} else if k.r < ' ' && !k.meta {
+			// C-l, Tab, C-w... as in emacs mode
+			e.handleKey(k)
+		} else {
+			e.bell()
+		}
+	}
+	return false
+}
+
+// viCount reads the count typed before a command, 1 when there is none, and
+// returns the key that follows it. ok is false when the input is gone.
+func (e *nativeEditor) viCount(k key) (count int, next key, ok bool) {
+	for !k.meta && (k.r >= '1' && k.r <= '9' || count > 0 && k.r == '0') {
+		count = count*10 + int(k.r-'0')
+		var err error
+		if k, err = e.keys.readKey(); err != nil {
+			return 0, k, false
+		}
+	}
+	return max(count, 1), k, true
+}
+
+// viMotion returns where the motion k moves the cursor. inclusive is set when
+// an operator applies to the character at pos too (e, $, f, t).
+func (e *nativeEditor) viMotion(k key, count int) (pos int, inclusive, ok bool) {
+	if k.meta {
+		return 0, false, false
+	}
+
+	switch k.r {
+	case 'h', keyLeft, keyBackspace, ctrl('h'):
+		return e.repeat(e.charBefore, e.cursor, count), false, true
+	case 'l', ' ', keyRight:
+		return e.repeat(e.charAfter, e.cursor, count), false, true
+	case '0', keyHome:
+		return 0, false, true
+	case '^':
+		return e.viFirstNonBlank(), false, true
+	case '$', keyEnd:
+		return max(0, len(e.line)-1), true, true
+	case '|':
+		return min(count-1, len(e.line)), false, true
+	case 'w', 'W':
+		return e.repeat(func(pos int) int { return e.viWordForward(pos, k.r == 'W') }, e.cursor, count), false, true
+	case 'b', 'B':
+		return e.repeat(func(pos int) int { return e.viWordBackward(pos, k.r == 'B') }, e.cursor, count), false, true
+	case 'e', 'E':
+		return e.repeat(func(pos int) int { return e.viWordEnd(pos, k.r == 'E') }, e.cursor, count), true, true
+	case 'f', 'F', 't', 'T':
+		target, err := e.keys.readKey()
+		if err != nil || target.meta || target.r < ' ' {
+			return 0, false, false
+		}
+		e.viFind = viFind{command: k.r, target: target.r}
+		return e.viFindChar(e.viFind, count)
+	case ';', ',':
+		find := e.viFind
+		if k.r == ',' {
+			// The same search the other way
+			swapped := map[rune]rune{'f': 'F', 'F': 'f', 't': 'T', 'T': 't'}
+			find.command = swapped[find.command]
+		}
+		return e.viFindChar(find, count)
+	}
+	return 0, false, false
+}
+
+// viFindChar moves to the count-th target character of find, forwards for f
+// and t, backwards for F and T. t and T stop next to the character.
+func (e *nativeEditor) viFindChar(find viFind, count int) (pos int, inclusive, ok bool) {
+	found := e.cursor
+	for ; count > 0; count-- {
+		from := found
+		found = -1
+		switch find.command {
+		case 'f', 't':
+			for i := from + 1; i < len(e.line); i++ {
+				if e.line[i] == find.target {
+					found = i
+					break
+				}
+			}
+		case 'F', 'T':
+			for i := from - 1; i >= 0; i-- {
+				if e.line[i] == find.target {
+					found = i
+					break
+				}
+			}
+		}
+		if found < 0 {
+			return 0, false, false
+		}
+	}
+
+	switch find.command {
+	case 't':
+		return found - 1, true, true
+	case 'T':
+		return found + 1, false, true
+	}
+	return found, find.command == 'f', true
+}
+
+// viOperator runs the d, c or y operator on the motion or text object typed
+// after it.
+func (e *nativeEditor) viOperator(operator rune, count int) {
+	k, err := e.keys.readKey()
+	if err != nil {
+		return
+	}
+	motionCount, k, ok := e.viCount(k)
+	if !ok {
+		return
+	}
+	count *= motionCount
+
+	start, end := e.cursor, e.cursor
+	switch {
+	case k.r == operator:
+		start, end = 0, len(e.line)
+	case k.r == 'i' || k.r == 'a':
+		object, err := e.keys.readKey()
+		if err != nil || (object.r != 'w' && object.r != 'W') {
+			e.bell()
+			return
+		}
+		if start, end, ok = e.viWordObject(k.r == 'a', object.r == 'W'); !ok {
+			e.bell()
+			return
+		}
+	case operator == 'c' && (k.r == 'w' || k.r == 'W') && e.cursor < len(e.line) && !unicode.IsSpace(e.line[e.cursor]):
+		// cw changes up to the end of the word, like ce, not the blanks
+		// after it
+		big := k.r == 'W'
+		end = e.cursor
+		for end+1 < len(e.line) && viClass(e.line[end+1], big) == viClass(e.line[end], big) {
+			end++
+		}
+		end = e.repeat(func(pos int) int { return e.viWordEnd(pos, big) }, end, count-1)
+		end = e.charAfter(end)
+	default:
+		pos, inclusive, ok := e.viMotion(k, count)
+		if !ok {
+			e.bell()
+			return
+		}
+		start, end = min(e.cursor, pos), max(e.cursor, pos)
+		if inclusive {
+			end = e.charAfter(end)
+		}
+	}
+
+	e.viOperate(operator, start, end)
+}
+
+// viOperate deletes (d), changes (c) or yanks (y) line[start:end]. The text
+// goes to the register p and P put back.
+func (e *nativeEditor) viOperate(operator rune, start, end int) {
+	if start == end && operator != 'c' {
+		e.bell()
+		return
+	}
+
+	e.viRegister = append([]rune(nil), e.line[start:end]...)
+	switch operator {
+	case 'y':
+		e.cursor = min(e.cursor, start)
+	case 'd':
+		e.viSave()
+		e.deleteRange(start, end)
+	case 'c':
+		e.viSave()
+		e.deleteRange(start, end)
+		e.viInsert(start)
+	}
+}
+
+// viPut inserts the register count times, after the cursor or before it.
+func (e *nativeEditor) viPut(after bool, count int) {
+	if len(e.viRegister) == 0 {
+		e.bell()
+		return
+	}
+	e.viSave()
+	if after {
+		e.cursor = e.charAfter(e.cursor)
+	}
+	for ; count > 0; count-- {
+		e.insert(e.viRegister)
+	}
+	// On the last character put
+	e.cursor = e.charBefore(e.cursor)
+}
+
+// viReplace replaces count characters with the one typed next (r).
+func (e *nativeEditor) viReplace(count int) {
+	k, err := e.keys.readKey()
+	if err != nil || k.meta || k.r < ' ' || e.cursor+count > len(e.line) {
+		e.bell()
+		return
+	}
+	e.viSave()
+	for i := 0; i < count; i++ {
+		e.line[e.cursor+i] = k.r
+	}
+	e.cursor += count - 1
+}
+
+// viWordObject returns the word text object under the cursor: the word (or
+// the blanks) for iw, with the blanks after it (before it at the end of the
+// line) for aw.
+func (e *nativeEditor) viWordObject(around, big bool) (start, end int, ok bool) {
+	if len(e.line) == 0 {
+		return 0, 0, false
+	}
+
+	pos := min(e.cursor, len(e.line)-1)
+	class := viClass(e.line[pos], big)
+	start, end = pos, pos+1
+	for start > 0 && viClass(e.line[start-1], big) == class {
+		start--
+	}
+	for end < len(e.line) && viClass(e.line[end], big) == class {
+		end++
+	}
+	if !around {
+		return start, end, true
+	}
+
+	if class == viBlank {
+		// The blanks and the word after them
+		if end < len(e.line) {
+			next := viClass(e.line[end], big)
+			for end < len(e.line) && viClass(e.line[end], big) == next {
+				end++
+			}
+		}
+		return start, end, true
+	}
+	blanksEnd := end
+	for blanksEnd < len(e.line) && unicode.IsSpace(e.line[blanksEnd]) {
+		blanksEnd++
+	}
+	if blanksEnd > end {
+		return start, blanksEnd, true
+	}
+	for start > 0 && unicode.IsSpace(e.line[start-1]) {
+		start--
+	}
+	return start, end, true
+}
+
+// Character classes of vi words: a word is a run of letters, digits and
+// underscores, or a run of other non-blank characters. A WORD (W, B, E) is
+// any run of non-blank characters.
+const (
+	viBlank = iota
+	viWord
+	viPunctuation
+)
+
+func viClass(r rune, big bool) int {
+	switch {
+	case unicode.IsSpace(r):
+		return viBlank
+	case big || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+		return viWord
+	}
+	return viPunctuation
+}
+
+// viWordForward returns the start of the next word (w).
+func (e *nativeEditor) viWordForward(pos int, big bool) int {
+	if pos >= len(e.line) {
+		return len(e.line)
+	}
+	class := viClass(e.line[pos], big)
+	for pos < len(e.line) && class != viBlank && viClass(e.line[pos], big) == class {
+		pos++
+	}
+	for pos < len(e.line) && viClass(e.line[pos], big) == viBlank {
+		pos++
+	}
+	return pos
+}
+
+// viWordEnd returns the end of the word, or of the next one when pos is
+// already there (e).
+func (e *nativeEditor) viWordEnd(pos int, big bool) int {
+	pos++
+	for pos < len(e.line) && viClass(e.line[pos], big) == viBlank {
+		pos++
+	}
+	if pos >= len(e.line) {
+		return max(0, len(e.line)-1)
+	}
+	class := viClass(e.line[pos], big)
+	for pos+1 < len(e.line) && viClass(e.line[pos+1], big) == class {
+		pos++
+	}
+	return pos
+}
+
+// viWordBackward returns the start of the word, or of the previous one when
+// pos is already there (b).
+func (e *nativeEditor) viWordBackward(pos int, big bool) int {
+	pos--
+	for pos > 0 && viClass(e.line[pos], big) == viBlank {
+		pos--
+	}
+	if pos <= 0 {
+		return 0
+	}
+	class := viClass(e.line[pos], big)
+	for pos > 0 && viClass(e.line[pos-1], big) == class {
+		pos--
+	}
+	return pos
+}
+
+func (e *nativeEditor) viFirstNonBlank() int {
+	pos := 0
+	for pos < len(e.line) && unicode.IsSpace(e.line[pos]) {
+		pos++
+	}
+	return pos
+}
+
+// repeat applies move count times from pos.
+func (e *nativeEditor) repeat(move func(int) int, pos, count int) int {
+	for ; count > 0; count-- {
+		pos = move(pos)
+	}
+	return pos
+}
+
+// viSave records the line before a change, for u.
+func (e *nativeEditor) viSave() {
+	e.viUndo = append(e.viUndo, viState{line: append([]rune(nil), e.line...), cursor: e.cursor})
+	if len(e.viUndo) > viUndoSize {
+		e.viUndo = e.viUndo[1:]
+	}
+}
+
+// viUndoChange puts the line back as it was before the last change.
+func (e *nativeEditor) viUndoChange() {
+	if len(e.viUndo) == 0 {
+		e.bell()
+		return
+	}
+	last := e.viUndo[len(e.viUndo)-1]
+	e.viUndo = e.viUndo[:len(e.viUndo)-1]
+	e.line, e.cursor = last.line, last.cursor
+}
+
+// editInEditor opens the line in $VISUAL or $EDITOR (vi when neither is
+// set) and, like bash, returns true to run what was saved. When the editor
+// fails the line is left as it was.
+func (e *nativeEditor) editInEditor() bool {
+	file, err := os.CreateTemp("", "shelly-edit-*.sh")
+	if err != nil {
+		e.bell()
+		return false
+	}
+	defer os.Remove(file.Name())
+	_, err = file.WriteString(string(e.line) + "\n")
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		e.bell()
+		return false
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// The editor gets the terminal in its normal mode, below the line
+	e.cursor = len(e.line)
+	e.refresh()
+	e.write("\r\n")
+	e.cursorRow = 0
+	e.restore()
+	command := exec.Command("/bin/sh", "-c", editor+` "$1"`, "sh", file.Name())
+	command.Stdin, command.Stdout, command.Stderr = os.Stdin, os.Stdout, os.Stderr
+	runErr := command.Run()
+	if restore, err := makeRaw(stdin); err == nil {
+		e.restore = restore
+	}
+
+	content, err := os.ReadFile(file.Name())
+	if runErr != nil || err != nil {
+		e.bell()
+		return false
+	}
+	e.line = []rune(strings.TrimRight(string(content), "\n"))
+	e.cursor = len(e.line)
+	return true
+}
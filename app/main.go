@@ -1,44 +1,20 @@
 package main
 
-/*
-#cgo LDFLAGS: -lreadline
-#include <stdlib.h>
-#include <stdio.h>
-#include <readline/readline.h>
-#include <readline/history.h>
-#include "readline_helper.h"
-*/
-import "C"
-
 import (
+	"bufio"
+	"errors"
+	"fmt"
 	"os"
-	"os/signal"
 	"shelly/app/executer"
+	"shelly/app/highlight"
 	"shelly/app/history"
-	"shelly/app/parser"
+	"shelly/app/lineEditor"
 	"shelly/app/parser/ast"
-	"shelly/app/parser/lexer"
-	"shelly/app/parser/token"
-	"syscall"
+	"time"
 )
 
 func main() {
 
-	sigs := make(chan os.Signal, 1)
-	// Notify the `sigs` channel when the process receives an interrupt or termination signal:
-	// - SIGINT  : Interrupt signal (usually from Ctrl+C)
-	// - SIGTERM : Termination signal (polite request to stop, e.g. from `kill`)
-	// - SIGHUP  : Hangup signal (sent when terminal closes or service manager restarts the process)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
-
-	go func() {
-		//Blocks channel until new message
-		<-sigs
-		//"" defaults to the default history file.
-		history.GetHistoryManager().AppendHistoryToFile("")
-		os.Exit(0)
-	}()
-
 	// Check if we are in "run single command mode"
 	// This is used when a builtin command like cd is used in a pipeline
 	if len(os.Args) > 1 && os.Args[0] == "--run-builtin" {
@@ -46,36 +22,110 @@ func main() {
 		cmd := ast.SimpleCommand{
 			Args: os.Args[1:],
 		}
-		// Run the command and exit immediately
-		if err := executer.RunSingleCommand(cmd); err != nil {
+		// Run the command and exit immediately with its status
+		status, err := executer.RunSingleCommand(cmd)
+		if err != nil {
 			os.Exit(1)
 		}
-		os.Exit(0)
+		os.Exit(status)
+	}
+
+	invocation, ok := executer.ParseInvocation(os.Args[1:], os.Stderr.Fd())
+	if !ok {
+		os.Exit(2)
+	}
+
+	executer.InitWorkingDirectory()
+	executer.InitSignals()
+
+	// `shelly -c 'cmd'` and `shelly script` run the commands and exit
+	if invocation.HasCommand {
+		executer.RunString(invocation.Command)
+		executer.ExitShell(executer.LastStatus())
+	}
+	if invocation.Script != "" {
+		runScript(invocation.Script)
+		executer.ExitShell(executer.LastStatus())
 	}
 
 	historyManager := history.GetHistoryManager()
+	editor := lineEditor.New(lineEditor.Config{
+		History:  historyManager.Lines,
+		Here:     historyManager.LinesHere,
+		Complete: completer.Complete,
+		Suggest:  historyManager.Suggest,
+		Highlight: highlight.Highlighter{
+			CommandExists: executer.CommandExists,
+			Lookup:        executer.LookupVariable,
+		}.Highlight,
+		Vi:       func() bool { return executer.OptionEnabled("vi") },
+		Signal:   executer.RunPendingTraps,
+		SignalFd: executer.SignalFd(),
+	})
 
 	for true {
 
-		prompt := "$ "
+		prompt := executer.Prompt(lineEditor.ModeIndicator)
 
-		input := historyManager.ReadLine(prompt)
+		input, ok := editor.ReadLine(prompt)
+		if !ok {
+			// Ctrl+D behaves like `exit`: leave with the last status
+			executer.ExitShell(executer.LastStatus())
+		}
 
-		var lex = lexer.NewLexer(input)
-		tokens := []token.Token{}
-		for {
-			tok := lex.NextToken()
-			tokens = append(tokens, tok)
-			if tok.Type == token.TokenEOF {
-				history.GetHistoryManager().AppendHistoryToFile("")
-				break
+		if executer.OptionEnabled("histexpand") {
+			expansion, err := historyManager.Expand(input)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "shelly: %v\n", err)
+				continue
+			}
+
+			input = expansion.Line
+			if expansion.PrintOnly {
+				fmt.Println(input)
+				historyManager.AddCommand(input)
+				continue
+			}
+			// Like bash, show the command that is about to run
+			if expansion.Changed {
+				fmt.Fprintln(os.Stderr, input)
 			}
 		}
 
-		var cmdParser = parser.NewParser(tokens)
+		historyManager.AddCommand(input)
+		start := time.Now()
+		cwd := os.Getenv("PWD")
+		status := executer.RunString(input)
+		historyManager.LogCommand(history.CommandInfo{
+			Line:       input,
+			Cwd:        cwd,
+			Start:      start,
+			Duration:   time.Since(start),
+			Status:     status,
+			PipeStatus: executer.PipeStatus(),
+		})
+
+		// With histshare the commands of the other shells are picked up
+		// too, otherwise ours are only appended ("" is the default file)
+		if executer.OptionEnabled("histshare") {
+			historyManager.ShareHistory()
+		} else {
+			historyManager.AppendHistoryToFile("")
+		}
+	}
+}
 
-		astTree, _ := cmdParser.Parse()
+// runScript runs a script file line by line, like the prompt would.
+func runScript(path string) {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "shelly: %s: %v\n", path, errors.Unwrap(err))
+		os.Exit(127)
+	}
+	defer file.Close()
 
-		executer.RunPipeline(astTree)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		executer.RunString(scanner.Text())
 	}
 }
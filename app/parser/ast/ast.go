@@ -5,6 +5,22 @@ type Command interface{}
 type SimpleCommand struct {
 	Args      []string
 	Redirects []Redirect // Ordered list
+	// Conditional is set when the command is a `[[ ... ]]` compound command.
+	// Args still holds the full word list (including the brackets) so it can be
+	// re-run in a pipeline subshell.
+	Conditional *ConditionalCommand
+}
+
+// ConditionalCommand holds the words between `[[` and `]]`.
+// They are collected without treating &&, ||, > or parentheses as shell
+// operators.
+type ConditionalCommand struct {
+	Words []string
+	// Patterns and Regexes are the expanded words as the right-hand side of
+	// `==` and `=~`, where only the quoted parts match literally. Expansion
+	// sets them; they are nil when the words come from plain arguments.
+	Patterns []string
+	Regexes  []string
 }
 
 type Pipeline struct {
@@ -13,6 +29,27 @@ type Pipeline struct {
 	Redirects []Redirect // Ordered list
 }
 
+// ListOperator is the operator that joins a pipeline to the next one in a list.
+type ListOperator int
+
+const (
+	ListSequential ListOperator = iota // ';' or end of input
+	ListAnd                            // '&&': run the next pipeline only on success
+	ListOr                             // '||': run the next pipeline only on failure
+)
+
+type ListItem struct {
+	Pipeline Pipeline
+	Operator ListOperator
+}
+
+// CommandList is a sequence of pipelines separated by ';', '&&' or '||'.
+// All three operators have the same precedence and associate to the left, so
+// the list can be evaluated item by item.
+type CommandList struct {
+	Items []ListItem
+}
+
 type RedirectType int
 
 const (
@@ -3,55 +3,122 @@
 package lexer
 
 import (
+	"regexp"
 	"shelly/app/parser/token"
+	"shelly/app/pattern"
 	"strings"
 )
 
+// BadSubstitution starts the names passed to a VariableLookup for ${...}
+// references that don't name a parameter, e.g. ${~} or ${a b}: the name
+// follows it as typed. Tilde prefixes are the only names starting with '~'
+// (see readTildePrefix), so ${~} can't pass for one.
+const BadSubstitution = "\x00"
+
+// quotedReference starts the name of the ${...} references written inside
+// double quotes in expansion templates: their value is literal text, even as
+// a pattern (see ExpandPattern). It can't start a parameter name.
+const quotedReference = "\""
+
+// VariableLookup resolves a shell parameter during expansion. The name is the
+// text after '$' (or between "${" and "}"), e.g. "HOME", "?" or "BASH_REMATCH[1]".
+type VariableLookup func(name string) (string, bool)
+
 // Lexer represents a lexical analyzer that tokenizes a shell input string.
 type Lexer struct {
-	input string // the input string to tokenize
-	pos   int    // current reading position in the input
+	input  string // the input string to tokenize
+	pos    int    // current reading position in the input
+	expand bool   // emit words as expansion templates, see NewExpandingLexer
 }
 
 // NewLexer returns a new instance of Lexer initialized with the given input.
+// Parameter references are kept as literal text.
 func NewLexer(input string) *Lexer {
 	return &Lexer{input: input}
 }
 
+// NewExpandingLexer returns a Lexer whose words are expansion templates:
+// unquoted and double-quoted parameter references ($NAME, ${NAME}, $?) are
+// kept as ${NAME} (${"NAME} inside double quotes), and every literal '$' or
+// '\' is escaped with a backslash, as are the quoted characters special in
+// patterns and regular expressions so they are matched literally (see
+// ExpandPattern and ExpandRegex).
+//
+// Expansion is deferred to ExpandWord so that each pipeline of a list sees the
+// values left by the ones before it (e.g. `false; echo $?`).
+func NewExpandingLexer(input string) *Lexer {
+	return &Lexer{input: input, expand: true}
+}
+
 // NextToken returns the next token from the input.
 // It skips any leading whitespace and returns tokens such as:
 // - token.TokenEOF when input is exhausted
 // - token.TokenPipe for pipe characters '|'
+// - token.TokenAnd, token.TokenOr and token.TokenSemicolon for '&&', '||' and ';'
 // - token.TokenWord for literal words (non-whitespace, non-special chars)
 func (l *Lexer) NextToken() token.Token {
 	l.skipWhitespace()
+	start := l.pos
+	tok := l.nextToken()
+	tok.Start, tok.End = start, l.pos
+	return tok
+}
 
+func (l *Lexer) nextToken() token.Token {
 	// End of input: return EOF token
 	if l.pos >= len(l.input) {
 		return token.Token{Type: token.TokenEOF}
 	}
 
-	if l.input[l.pos] == '|' {
+	switch l.input[l.pos] {
+	case '|':
+		if l.peekByte(1) == '|' {
+			l.pos += 2
+			return token.Token{Type: token.TokenOr, Value: "||"}
+		}
 		l.pos++
 		return token.Token{Type: token.TokenPipe, Value: "|"}
+	case ';':
+		l.pos++
+		return token.Token{Type: token.TokenSemicolon, Value: ";"}
+	case '&':
+		if l.peekByte(1) == '&' {
+			l.pos += 2
+			return token.Token{Type: token.TokenAnd, Value: "&&"}
+		}
 	}
 
 	var builder strings.Builder
+	quoted := false
+
+	// An unquoted '~' starting a word is a tilde prefix (~, ~/src, ~+, ~2)
+	if l.expand && l.input[l.pos] == '~' {
+		builder.WriteString(l.readTildePrefix())
+	}
 
 	for l.pos < len(l.input) {
 		ch := l.input[l.pos]
 
-		if isWhiteSpace(ch) || ch == '|' {
+		if isWhiteSpace(ch) || l.isOperatorStart() {
 			break
 		}
 
 		switch ch {
 		case '"', '\'':
-			quoted := l.readQuoted()
-			builder.WriteString(quoted)
+			quoted = true
+			quotedText := l.readQuoted()
+			builder.WriteString(quotedText)
 		case '\\':
+			quoted = true
 			escapedChar := l.readEscapeCharacter()
-			builder.WriteByte(escapedChar)
+			l.writeLiteralByte(&builder, escapedChar)
+		case '$':
+			if !l.expand {
+				builder.WriteByte(ch)
+				l.pos++
+				continue
+			}
+			builder.WriteString(l.readExpansion())
 		default:
 			// Regular unquoted character
 			builder.WriteByte(ch)
@@ -61,6 +128,11 @@ func (l *Lexer) NextToken() token.Token {
 
 	tokenValue := builder.String()
 
+	// A quoted operator such as '>' is just a word
+	if quoted {
+		return token.Token{Type: token.TokenWord, Value: tokenValue, Quoted: true}
+	}
+
 	//cheaper to check the length in most cases then doing string comparison
 	if len(tokenValue) == 1 || len(tokenValue) == 2 {
 		if tokenValue == "1>" || tokenValue == ">" {
@@ -95,7 +167,38 @@ func (l *Lexer) NextToken() token.Token {
 	return token.Token{Type: token.TokenWord, Value: tokenValue}
 }
 
+// isOperatorStart reports whether the character under the cursor ends the
+// current word because it starts '|', '||', ';' or '&&'.
+// A single '&' is kept inside the word so redirections like 2>&1 stay intact.
+func (l *Lexer) isOperatorStart() bool {
+	return l.isOperatorAt(l.pos)
+}
+
+func (l *Lexer) isOperatorAt(i int) bool {
+	switch l.input[i] {
+	case '|', ';':
+		return true
+	case '&':
+		return i+1 < len(l.input) && l.input[i+1] == '&'
+	}
+	return false
+}
+
+// peekByte returns the byte offset characters after the cursor, or 0 past the end.
+func (l *Lexer) peekByte(offset int) byte {
+	if l.pos+offset >= len(l.input) {
+		return 0
+	}
+	return l.input[l.pos+offset]
+}
+
 func (l *Lexer) readEscapeCharacter() byte {
+	// A backslash ending the input (e.g. a line being typed) is kept as is
+	if l.pos+1 >= len(l.input) {
+		l.pos++
+		return '\\'
+	}
+
 	//Right now we are in the escape character index
 	//We want to go to the next one.
 	//Two pos are jumped to also jump the character being escaped
@@ -104,6 +207,169 @@ func (l *Lexer) readEscapeCharacter() byte {
 	return l.input[l.pos-1]
 }
 
+// writeLiteralByte appends a character that must survive ExpandWord unchanged.
+func (l *Lexer) writeLiteralByte(builder *strings.Builder, ch byte) {
+	if l.expand && isTemplateSpecial(ch) {
+		builder.WriteByte('\\')
+	}
+	builder.WriteByte(ch)
+}
+
+// writeLiteral appends text that must survive ExpandWord unchanged.
+func (l *Lexer) writeLiteral(builder *strings.Builder, text string) {
+	if !l.expand || strings.IndexAny(text, templateSpecials) < 0 {
+		builder.WriteString(text)
+		return
+	}
+	for i := 0; i < len(text); i++ {
+		l.writeLiteralByte(builder, text[i])
+	}
+}
+
+// readTildePrefix consumes the "~..." text up to the first '/' or the end of
+// the word and returns it as a ${~...} reference for ExpandWord. A prefix
+// containing quotes or '$' is not a tilde prefix and is left to the caller.
+func (l *Lexer) readTildePrefix() string {
+	end := l.pos + 1
+	for end < len(l.input) && l.input[end] != '/' && !isWhiteSpace(l.input[end]) && !l.isOperatorAt(end) {
+		switch l.input[end] {
+		case '"', '\'', '\\', '$', '{', '}':
+			return ""
+		}
+		end++
+	}
+
+	prefix := l.input[l.pos:end]
+	l.pos = end
+	return "${" + prefix + "}"
+}
+
+// readExpansion consumes the parameter reference under the cursor ('$' plus
+// name) and returns it in the normalized ${NAME} form understood by
+// ExpandWord. A '$' that doesn't start a valid reference is a literal, left
+// unescaped since no '{' follows it: it is still special in a regular
+// expression (see ExpandRegex).
+func (l *Lexer) readExpansion() string {
+	start := l.pos
+	// skip '$'
+	l.pos++
+
+	if l.pos >= len(l.input) {
+		return "$"
+	}
+
+	var name string
+	ch := l.input[l.pos]
+	switch {
+	case ch == '{':
+		end := strings.IndexByte(l.input[l.pos:], '}')
+		if end < 0 {
+			// Unterminated ${ - keep the text as typed
+			var rest strings.Builder
+			l.writeLiteral(&rest, l.input[start:])
+			l.pos = len(l.input)
+			return rest.String()
+		}
+		name = l.input[l.pos+1 : l.pos+end]
+		l.pos += end + 1
+		if !isParameterName(name) {
+			name = BadSubstitution + name
+		}
+	case ch == '?' || ch == '$' || ch == '-':
+		name = l.input[l.pos : l.pos+1]
+		l.pos++
+	case isNameStart(ch):
+		nameStart := l.pos
+		for l.pos < len(l.input) && isNameChar(l.input[l.pos]) {
+			l.pos++
+		}
+		name = l.input[nameStart:l.pos]
+	default:
+		return "$"
+	}
+
+	return "${" + name + "}"
+}
+
+// ExpandGlobPattern resolves a word produced by NewExpandingLexer like
+// ExpandWord, but keeps it in the syntax of the pattern package: quoted glob
+// characters and expanded values stay escaped. hasGlob reports whether any
+// unquoted glob character is left, i.e. whether the word needs pathname
+// expansion.
+func ExpandGlobPattern(word string, lookup VariableLookup) (glob string, hasGlob bool) {
+	if strings.IndexAny(word, "*?[") < 0 {
+		return word, false
+	}
+
+	glob = expandTemplate(word, lookup, pattern.Escape, true)
+	return glob, pattern.HasMeta(glob)
+}
+
+// ExpandPattern resolves a word produced by NewExpandingLexer into a pattern
+// for the pattern package, e.g. the right-hand side of `[[ s == pattern ]]`:
+// only the quoted parts of the word, values of quoted references included,
+// are matched literally.
+func ExpandPattern(word string, lookup VariableLookup) string {
+	return expandTemplate(word, lookup, pattern.Escape, false)
+}
+
+// ExpandRegex is ExpandPattern for a regular expression, e.g. the right-hand
+// side of `[[ s =~ regex ]]`.
+func ExpandRegex(word string, lookup VariableLookup) string {
+	return expandTemplate(word, lookup, regexp.QuoteMeta, false)
+}
+
+// ExpandWord resolves a word produced by NewExpandingLexer: every ${NAME} is
+// replaced with its value from lookup (unset names expand to nothing) and
+// backslash escapes are removed. Tilde prefixes arrive as names starting
+// with '~', e.g. ${~} or ${~+1}.
+func ExpandWord(word string, lookup VariableLookup) string {
+	if strings.IndexAny(word, "$\\") < 0 {
+		return word
+	}
+	return expandTemplate(word, lookup, nil, false)
+}
+
+// expandTemplate resolves the references of word and removes its escapes.
+// The escaped characters and the values of quoted references (tilde prefixes
+// included) go through quote, as do all values when quoteValues is set; no
+// quoting when quote is nil.
+func expandTemplate(word string, lookup VariableLookup, quote func(string) string, quoteValues bool) string {
+	if quote == nil {
+		quote = func(s string) string { return s }
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(word))
+
+	for i := 0; i < len(word); i++ {
+		switch word[i] {
+		case '\\':
+			if i+1 < len(word) {
+				i++
+			}
+			builder.WriteString(quote(word[i : i+1]))
+		case '$':
+			end := strings.IndexByte(word[i:], '}')
+			if i+1 >= len(word) || word[i+1] != '{' || end < 0 {
+				builder.WriteByte('$')
+				continue
+			}
+			name, quoted := strings.CutPrefix(word[i+2:i+end], quotedReference)
+			value, _ := lookup(name)
+			if quoted || quoteValues || strings.HasPrefix(name, "~") {
+				value = quote(value)
+			}
+			builder.WriteString(value)
+			i += end
+		default:
+			builder.WriteByte(word[i])
+		}
+	}
+
+	return builder.String()
+}
+
 func (l *Lexer) readQuoted() string {
 	quote := l.input[l.pos]
 	//skip opening quote
@@ -114,7 +380,7 @@ func (l *Lexer) readQuoted() string {
 	for l.pos < len(l.input) && l.input[l.pos] != quote {
 
 		if l.input[l.pos] == '\\' {
-			builder.WriteString(l.input[start:l.pos]) // Flush before backslash
+			l.writeLiteral(&builder, l.input[start:l.pos]) // Flush before backslash
 
 			if l.pos+1 < len(l.input) {
 				escaped := l.input[l.pos+1]
@@ -124,18 +390,18 @@ func (l *Lexer) readQuoted() string {
 					// Supported escape sequences
 					switch escaped {
 					default:
-						builder.WriteByte(escaped)
+						l.writeLiteralByte(&builder, escaped)
 					}
 					l.pos += 2
 				default:
 					// Not a valid escape — keep backslash as-is
-					builder.WriteByte('\\')
-					builder.WriteByte(escaped)
+					l.writeLiteralByte(&builder, '\\')
+					l.writeLiteralByte(&builder, escaped)
 					l.pos += 2
 				}
 			} else {
 				// Lone backslash at end — treat as literal
-				builder.WriteByte('\\')
+				l.writeLiteralByte(&builder, '\\')
 				l.pos++
 			}
 
@@ -143,16 +409,32 @@ func (l *Lexer) readQuoted() string {
 			continue
 		}
 
+		// Parameters are expanded inside double quotes only
+		if quote == '"' && l.input[l.pos] == '$' && l.expand {
+			l.writeLiteral(&builder, l.input[start:l.pos])
+			reference := l.readExpansion()
+			if rest, ok := strings.CutPrefix(reference, "${"); ok {
+				reference = "${" + quotedReference + rest
+			} else if reference == "$" {
+				reference = "\\$"
+			}
+			builder.WriteString(reference)
+			start = l.pos
+			continue
+		}
+
 		l.pos++
 	}
 
 	// If closing quote was not found, return the rest as-is (unterminated string)
 	if l.pos >= len(l.input) {
-		return l.input[start-1:] // Include opening quote
+		var rest strings.Builder
+		l.writeLiteral(&rest, l.input[start-1:]) // Include opening quote
+		return rest.String()
 	}
 
 	// Append remaining content before closing quote
-	builder.WriteString(l.input[start:l.pos])
+	l.writeLiteral(&builder, l.input[start:l.pos])
 	l.pos++ // Skip closing quote
 
 	return builder.String()
@@ -166,7 +448,53 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// Characters escaped in expansion templates: the expansion syntax itself plus
+// the characters special in patterns or regular expressions.
+const templateSpecials = "$\\*?[.+()|{}^]"
+
+func isTemplateSpecial(ch byte) bool {
+	return strings.IndexByte(templateSpecials, ch) >= 0
+}
+
+func isGlobSpecial(ch byte) bool {
+	return ch == '\\' || ch == '*' || ch == '?' || ch == '['
+}
+
 // isWhiteSpace returns true if the character is a whitespace character (space, tab, newline).
 func isWhiteSpace(ch byte) bool {
 	return ch == ' ' || ch == '\t' || ch == '\n'
 }
+
+// isParameterName reports whether name can be written between "${" and "}":
+// a variable name, possibly with an array subscript, or a special parameter.
+func isParameterName(name string) bool {
+	switch name {
+	case "?", "$", "-", "#", "@", "*", "!":
+		return true
+	}
+	if name != "" && strings.Trim(name, "0123456789") == "" {
+		return true
+	}
+	if open := strings.IndexByte(name, '['); open > 0 && strings.HasSuffix(name, "]") {
+		name = name[:open]
+	}
+	if name == "" || !isNameStart(name[0]) {
+		return false
+	}
+	for i := 1; i < len(name); i++ {
+		if !isNameChar(name[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNameStart returns true if the character can start a variable name.
+func isNameStart(ch byte) bool {
+	return ch == '_' || (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z')
+}
+
+// isNameChar returns true if the character can appear inside a variable name.
+func isNameChar(ch byte) bool {
+	return isNameStart(ch) || (ch >= '0' && ch <= '9')
+}
@@ -15,7 +15,46 @@ func NewParser(tokens []token.Token) *Parser {
 	return &Parser{tokens: tokens}
 }
 
-func (p *Parser) Parse() (ast.Pipeline, error) {
+// Parse parses the whole input as a list of pipelines joined by ';', '&&'
+// and '||'. Empty input yields an empty list.
+func (p *Parser) Parse() (ast.CommandList, error) {
+	var list ast.CommandList
+
+	for !p.match(token.TokenEOF) {
+		pipeline, err := p.parsePipeline()
+		if err != nil {
+			return list, err
+		}
+
+		item := ast.ListItem{Pipeline: pipeline, Operator: ast.ListSequential}
+
+		switch p.peek().Type {
+		case token.TokenEOF:
+		case token.TokenSemicolon:
+			p.pos++
+		case token.TokenAnd, token.TokenOr:
+			if p.match(token.TokenAnd) {
+				item.Operator = ast.ListAnd
+			} else {
+				item.Operator = ast.ListOr
+			}
+			p.pos++
+
+			// '&&' and '||' need a right-hand side
+			if p.match(token.TokenEOF) {
+				return list, fmt.Errorf("syntax error: unexpected end of input after %s", p.tokens[p.pos-1].Value)
+			}
+		default:
+			return list, fmt.Errorf("syntax error near unexpected token `%s'", p.peek().Value)
+		}
+
+		list.Items = append(list.Items, item)
+	}
+
+	return list, nil
+}
+
+func (p *Parser) parsePipeline() (ast.Pipeline, error) {
 
 	var pipeline ast.Pipeline
 
@@ -51,9 +90,16 @@ func (p *Parser) parseSimpleCommand() (ast.SimpleCommand, error) {
 	var cmd ast.SimpleCommand
 
 	if !p.match(token.TokenWord) {
+		if tok := p.peek(); tok.Type != token.TokenEOF {
+			return cmd, fmt.Errorf("syntax error near unexpected token `%s'", tok.Value)
+		}
 		return cmd, fmt.Errorf("expected command")
 	}
 
+	if tok := p.peek(); tok.Value == "[[" && !tok.Quoted {
+		return p.parseConditionalCommand()
+	}
+
 	//First word in the command
 	cmd.Args = append(cmd.Args, p.tokens[p.pos].Value)
 	p.pos++
@@ -74,6 +120,56 @@ func (p *Parser) parseSimpleCommand() (ast.SimpleCommand, error) {
 	return cmd, nil
 }
 
+// parseConditionalCommand parses `[[ expression ]]`.
+//
+// Inside the brackets the usual operators lose their meaning: '&&' and '||'
+// combine expressions and '>' compares strings instead of redirecting, so every
+// token up to the closing `]]` is kept as a plain word for the evaluator.
+func (p *Parser) parseConditionalCommand() (ast.SimpleCommand, error) {
+	var cmd ast.SimpleCommand
+	conditional := &ast.ConditionalCommand{}
+
+	// Skip the opening '[['
+	cmd.Args = append(cmd.Args, p.tokens[p.pos].Value)
+	p.pos++
+
+	for {
+		tok := p.peek()
+		if tok.Type == token.TokenEOF {
+			return cmd, fmt.Errorf("syntax error: unexpected end of input looking for `]]'")
+		}
+		p.pos++
+
+		if tok.Type == token.TokenWord && tok.Value == "]]" && !tok.Quoted {
+			cmd.Args = append(cmd.Args, tok.Value)
+			break
+		}
+
+		word := tok.Value
+		switch tok.Type {
+		case token.TokenRedirectOut:
+			word = ">"
+		case token.TokenPipe, token.TokenSemicolon, token.TokenRedirectErr,
+			token.TokenAppendRedirectOut, token.TokenAppendRedirectErr:
+			return cmd, fmt.Errorf("syntax error in conditional expression near `%s'", tok.Value)
+		}
+
+		conditional.Words = append(conditional.Words, word)
+		cmd.Args = append(cmd.Args, word)
+	}
+
+	cmd.Conditional = conditional
+
+	// Pre size the array with 4. To avoid copies and creation of new arrays underneath the slice
+	cmd.Redirects = make([]ast.Redirect, 0, 4)
+
+	if err := AddRedirectInfo(p, &cmd.Redirects); err != nil {
+		return cmd, err
+	}
+
+	return cmd, nil
+}
+
 func AddRedirectInfo(p *Parser, redirects *[]ast.Redirect) error {
 	if p.match(token.TokenRedirectOut) {
 		p.pos++
@@ -3,4 +3,9 @@ package token
 type Token struct {
 	Type  TokenType
 	Value string
+	// Quoted is true when any part of the word came from quotes or an escape.
+	// Pattern operators such as `[[ x == y ]]` match quoted words literally.
+	Quoted bool
+	// Start and End are the byte offsets of the token in the lexer input.
+	Start, End int
 }
@@ -11,4 +11,7 @@ const (
 	TokenRedirectErr
 	TokenAppendRedirectOut
 	TokenAppendRedirectErr
+	TokenAnd       // &&
+	TokenOr        // ||
+	TokenSemicolon // ;
 )
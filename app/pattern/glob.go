@@ -0,0 +1,121 @@
+package pattern
+
+import (
+	"os"
+	"sort"
+	"strings"
+)
+
+// Glob performs pathname expansion: it returns the sorted list of existing
+// paths matching the pattern, or nil when nothing matches.
+//
+// The pattern is matched one '/' separated component at a time, so '*' never
+// crosses a directory boundary here. Names starting with '.' only match a
+// component that starts with a literal '.', unless dotglob is set; "." and
+// ".." are never produced by a wildcard.
+func Glob(pattern string, dotglob bool) []string {
+	if pattern == "" {
+		return nil
+	}
+
+	candidates := []string{""}
+	if strings.HasPrefix(pattern, "/") {
+		candidates = []string{"/"}
+		pattern = strings.TrimLeft(pattern, "/")
+	}
+
+	components := strings.Split(pattern, "/")
+	for i, component := range components {
+		last := i == len(components)-1
+
+		// A trailing slash keeps only directories
+		if component == "" {
+			if !last {
+				continue
+			}
+			candidates = keepDirectories(candidates)
+			for j := range candidates {
+				candidates[j] += "/"
+			}
+			break
+		}
+
+		var next []string
+		if !HasMeta(component) {
+			literal := Unescape(component)
+			for _, dir := range candidates {
+				next = append(next, joinPath(dir, literal))
+			}
+		} else {
+			for _, dir := range candidates {
+				next = append(next, matchDirectory(dir, component, dotglob)...)
+			}
+		}
+
+		candidates = next
+		if len(candidates) == 0 {
+			return nil
+		}
+	}
+
+	// Literal components were appended without checking, drop what doesn't exist
+	matches := candidates[:0]
+	for _, candidate := range candidates {
+		if _, err := os.Lstat(candidate); err == nil {
+			matches = append(matches, candidate)
+		}
+	}
+
+	if len(matches) == 0 {
+		return nil
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// matchDirectory returns the entries of dir that match one pattern component.
+func matchDirectory(dir, component string, dotglob bool) []string {
+	readFrom := dir
+	if readFrom == "" {
+		readFrom = "."
+	}
+
+	entries, err := os.ReadDir(readFrom)
+	if err != nil {
+		return nil
+	}
+
+	explicitDot := strings.HasPrefix(component, ".") || strings.HasPrefix(component, "\\.")
+
+	var matches []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !explicitDot && !dotglob {
+			continue
+		}
+		if Match(component, name) {
+			matches = append(matches, joinPath(dir, name))
+		}
+	}
+	return matches
+}
+
+func keepDirectories(paths []string) []string {
+	dirs := paths[:0]
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+	}
+	return dirs
+}
+
+func joinPath(dir, name string) string {
+	switch dir {
+	case "":
+		return name
+	case "/":
+		return "/" + name
+	}
+	return dir + "/" + name
+}
@@ -0,0 +1,45 @@
+package pattern
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{"a.go", "b.go", "c.txt", ".hidden.go", "sub/d.go", "sub/e.txt", "other/f.go"} {
+		path = filepath.Join(dir, path)
+		os.MkdirAll(filepath.Dir(path), 0o755)
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	tests := []struct {
+		pattern string
+		dotglob bool
+		want    []string
+	}{
+		{"*.go", false, []string{"a.go", "b.go"}},
+		{"*.go", true, []string{".hidden.go", "a.go", "b.go"}},
+		{".*.go", false, []string{".hidden.go"}},
+		{"?.txt", false, []string{"c.txt"}},
+		{"[ab].go", false, []string{"a.go", "b.go"}},
+		{"*/*.go", false, []string{"other/f.go", "sub/d.go"}},
+		{"sub/*", false, []string{"sub/d.go", "sub/e.txt"}},
+		{"*/", false, []string{"other/", "sub/"}},
+		{"s*/e.txt", false, []string{"sub/e.txt"}},
+		{"s*/missing", false, nil},
+		{"*.none", false, nil},
+		{`\*.go`, false, nil},
+		{dir + "/*.txt", false, []string{dir + "/c.txt"}},
+	}
+	for _, test := range tests {
+		if got := Glob(test.pattern, test.dotglob); !slices.Equal(got, test.want) {
+			t.Errorf("Glob(%q, %v) = %q, want %q", test.pattern, test.dotglob, got, test.want)
+		}
+	}
+}
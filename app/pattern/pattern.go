@@ -0,0 +1,187 @@
+// Package pattern implements shell pattern matching as used by `[[ == ]]`,
+// HISTIGNORE and friends.
+//
+// Unlike path.Match, a '*' here also matches '/', which is what bash does for
+// every pattern that is not a pathname expansion. Glob builds pathname
+// expansion on top of it, one path component at a time.
+package pattern
+
+import "strings"
+
+// Match reports whether s matches the shell pattern.
+//
+// Supported syntax:
+//   - '*'     matches any sequence of characters (including the empty one)
+//   - '?'     matches any single character
+//   - '[...]' matches one character from the set; '!' or '^' negates it and
+//     ranges such as a-z are allowed
+//   - '\x'    matches the character x literally
+//
+// A malformed bracket expression is matched literally, like bash does.
+func Match(pattern, s string) bool {
+	px, sx := 0, 0
+	// Position to return to when a later part of the pattern fails after a '*'.
+	// Backtracking to the last star is enough because every earlier star
+	// already matched as little as possible.
+	nextPx, nextSx := -1, -1
+
+	for px < len(pattern) || sx < len(s) {
+		if px < len(pattern) {
+			switch c := pattern[px]; c {
+			case '*':
+				nextPx = px
+				nextSx = sx + 1
+				px++
+				continue
+			case '?':
+				if sx < len(s) {
+					px++
+					sx++
+					continue
+				}
+			case '[':
+				if sx < len(s) {
+					matched, width, ok := matchBracket(pattern[px:], s[sx])
+					if !ok {
+						// Not a valid bracket expression, treat '[' literally.
+						if s[sx] == '[' {
+							px++
+							sx++
+							continue
+						}
+					} else if matched {
+						px += width
+						sx++
+						continue
+					}
+				}
+			case '\\':
+				if px+1 < len(pattern) {
+					if sx < len(s) && s[sx] == pattern[px+1] {
+						px += 2
+						sx++
+						continue
+					}
+					break
+				}
+				fallthrough
+			default:
+				if sx < len(s) && s[sx] == c {
+					px++
+					sx++
+					continue
+				}
+			}
+		}
+
+		// Mismatch: let the last '*' swallow one more character and retry.
+		if nextSx > 0 && nextSx <= len(s) {
+			px = nextPx
+			sx = nextSx
+			continue
+		}
+		return false
+	}
+
+	return true
+}
+
+// HasMeta reports whether the pattern contains any unescaped special
+// characters, i.e. whether matching it can differ from comparing strings.
+// A '[' only counts when a ']' follows it, so `[` and `[[` are plain words.
+func HasMeta(pattern string) bool {
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '*', '?':
+			return true
+		case '[':
+			if containsByte(pattern[i+1:], ']') {
+				return true
+			}
+		case '\\':
+			i++
+		}
+	}
+	return false
+}
+
+// Unescape removes the backslashes that quote characters in a pattern.
+func Unescape(pattern string) string {
+	if !containsByte(pattern, '\\') {
+		return pattern
+	}
+
+	unescaped := make([]byte, 0, len(pattern))
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '\\' && i+1 < len(pattern) {
+			i++
+		}
+		unescaped = append(unescaped, pattern[i])
+	}
+	return string(unescaped)
+}
+
+// Escape quotes every special character in s so Match treats it literally.
+func Escape(s string) string {
+	if !strings.ContainsAny(s, "*?[\\") {
+		return s
+	}
+
+	escaped := make([]byte, 0, len(s)+4)
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '*', '?', '[', '\\':
+			escaped = append(escaped, '\\')
+		}
+		escaped = append(escaped, s[i])
+	}
+	return string(escaped)
+}
+
+// matchBracket matches ch against the bracket expression at the start of
+// pattern. It returns whether ch matched, how many pattern bytes the
+// expression spans and whether the expression was well formed.
+func matchBracket(pattern string, ch byte) (matched bool, width int, ok bool) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+
+	first := true
+	for i < len(pattern) {
+		c := pattern[i]
+		// A ']' right after the opening bracket is part of the set.
+		if c == ']' && !first {
+			return matched != negate, i + 1, true
+		}
+		first = false
+
+		if c == '\\' && i+1 < len(pattern) {
+			i++
+			c = pattern[i]
+		}
+
+		lo, hi := c, c
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi = pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			i += 2
+		}
+
+		if lo <= ch && ch <= hi {
+			matched = true
+		}
+		i++
+	}
+
+	return false, 0, false
+}
+
+func containsByte(s string, b byte) bool {
+	return strings.IndexByte(s, b) >= 0
+}
@@ -0,0 +1,84 @@
+package pattern
+
+import "testing"
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"*", "", true},
+		{"*", "anything/at/all", true},
+		{"a*", "abc", true},
+		{"*c", "abc", true},
+		{"a*c", "ac", true},
+		{"a*c", "abcbd", false},
+		{"a*b*c", "axxbyyc", true},
+		{"*a*a*", "banana", true},
+		{"*x*", "banana", false},
+		{"?", "a", true},
+		{"?", "", false},
+		{"a?c", "abc", true},
+		{"a??", "ab", false},
+		{"[abc]", "b", true},
+		{"[abc]", "d", false},
+		{"[a-c]x", "bx", true},
+		{"[!a-c]", "d", true},
+		{"[^a-c]", "b", false},
+		{"[]]", "]", true},
+		{"[!]]", "a", true},
+		{"[a-]", "-", true},
+		{"[abc", "[abc", true},
+		{"[abc", "a", false},
+		{`\*`, "*", true},
+		{`\*`, "a", false},
+		{`a\?`, "a?", true},
+		{`\[a]`, "[a]", true},
+		{`\\`, `\`, true},
+	}
+	for _, test := range tests {
+		if got := Match(test.pattern, test.s); got != test.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", test.pattern, test.s, got, test.want)
+		}
+	}
+}
+
+func TestHasMeta(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"plain", false},
+		{"a*", true},
+		{"a?", true},
+		{"[ab]", true},
+		{"[", false},
+		{"[[", false},
+		{`\*`, false},
+		{`\\*`, true},
+	}
+	for _, test := range tests {
+		if got := HasMeta(test.pattern); got != test.want {
+			t.Errorf("HasMeta(%q) = %v, want %v", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestEscapeRoundTrip(t *testing.T) {
+	for _, s := range []string{"", "plain", "a*b", "what?", "[x]", `back\slash`, `*?[\`} {
+		escaped := Escape(s)
+		if got := Unescape(escaped); got != s {
+			t.Errorf("Unescape(Escape(%q)) = %q", s, got)
+		}
+		if !Match(escaped, s) {
+			t.Errorf("Match(Escape(%q), %q) = false", s, s)
+		}
+		if HasMeta(escaped) {
+			t.Errorf("HasMeta(Escape(%q)) = true", s)
+		}
+	}
+}
@@ -41,19 +41,24 @@ install_readline_if_missing() {
   esac
 }
 
-# 🔧 Install Readline if needed
-install_readline_if_missing
+# 🔧 GNU Readline is optional: SHELLY_READLINE=1 builds with it instead of
+# the line editor written in Go
+BUILD_TAGS=""
+if [ "$SHELLY_READLINE" = 1 ]; then
+  install_readline_if_missing
+  export CGO_ENABLED=1
+  BUILD_TAGS="-tags readline"
+fi
 
 
 
-echo "Building Go project with CGO enabled..."
-export CGO_ENABLED=1
+echo "Building Go project..."
 
 # 🛠 Compile your shell
 (
   cd "$(dirname "$0")"
 
-  go build -o /tmp/codecrafters-build-shell-go ./app
+  go build $BUILD_TAGS -o /tmp/codecrafters-build-shell-go ./app
 )
 
 # Copied from .codecrafters/run.sh